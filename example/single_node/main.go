@@ -1,24 +1,29 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/medyagh/kic/example/single_node/mycmder"
 	"github.com/medyagh/kic/pkg/action"
 	"github.com/medyagh/kic/pkg/assets"
+	"github.com/medyagh/kic/pkg/cluster"
+	"github.com/medyagh/kic/pkg/command"
 	"github.com/medyagh/kic/pkg/config/cri"
+	"github.com/medyagh/kic/pkg/dryrun"
 	"github.com/medyagh/kic/pkg/image"
 	"github.com/medyagh/kic/pkg/node"
 	"github.com/medyagh/kic/pkg/oci"
-	"github.com/phayes/freeport"
+	"github.com/medyagh/kic/pkg/ports"
 	"k8s.io/klog"
 )
 
@@ -28,7 +33,7 @@ func main() {
 	start := flag.Bool("start", false, "to start")
 	hostIP := flag.String("host-ip", "127.0.0.1", "node's ip")
 	cpus := flag.String("cpu", "2", "number of cpus to dedicate to the node")
-	memory := flag.String("memory", "2000m", "memory")
+	memory := flag.String("memory", "2000m", "memory of the node, eg 2000m, 4g or 4Gi")
 	kubeVersion := flag.String("kubernetes-version", "v1.15.0", "kuberentes version")
 	userImg := flag.String("image", "", "image to load")
 	load := flag.Bool("load", false, "to load an image")
@@ -38,23 +43,81 @@ func main() {
 	dest := flag.String("dest", "", "destination to copy file/folder ")
 	pause := flag.Bool("pause", false, "pause all processes within one or more containers")
 	stop := flag.Bool("stop", false, "stop a container")
+	resume := flag.Bool("resume", false, "start a stopped node")
+	unpause := flag.Bool("unpause", false, "unpause a paused node")
+	restart := flag.Bool("restart", false, "restart a node")
 	status := flag.Bool("status", false, "shows status")
+	persist := flag.Bool("persist", false, "keep the node's /var in a named volume")
+	keepVolume := flag.Bool("keep-volume", false, "keep the node's /var volume when removing it")
+	logs := flag.String("logs", "", "print logs of the node, a systemd unit (kubelet, containerd) or a kubernetes container (eg kube-apiserver)")
+	follow := flag.Bool("follow", false, "follow the logs")
+	workers := flag.Int("workers", 0, "number of worker nodes to join to the control plane")
+	controlPlanes := flag.Int("control-planes", 1, "number of control plane nodes, more than 1 adds a load balancer in front of them")
+	clusterConfig := flag.String("config", "", "cluster config file with kubeadm config patches")
+	removeNode := flag.String("remove-node", "", "remove a node of the cluster, eg p1-control-plane2")
+	export := flag.String("export", "", "export a diagnostic bundle of the cluster to a directory or a .tar.gz file")
+	ociBin := flag.String("oci", oci.DefaultOCI, "container engine to use (docker, podman or docker-api)")
+	dryRun := flag.Bool("dry-run", false, "print the commands as a bash script instead of running them")
 
 	flag.Parse()
-	p, err := freeport.GetFreePort()
-	hostPort := int32(p)
+	var engine oci.Engine
+	var plan *dryrun.Plan
+	var err error
+	if *dryRun {
+		plan = dryrun.NewPlan()
+		engine = plan.Engine(*ociBin)
+		defer func() {
+			if err := plan.WriteScript(os.Stdout); err != nil {
+				klog.Errorf("error writing the dry-run plan: %v", err)
+			}
+		}()
+	} else {
+		engine, err = oci.NewEngine(*ociBin)
+		if err != nil {
+			klog.Fatal(err)
+		}
+	}
+
+	// cancel everything in flight on Ctrl-C
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		<-sigs
+		fmt.Println("Interrupted, cancelling ...")
+		cancel()
+	}()
+
+	portsPath := ports.DefaultPath()
+	if *dryRun {
+		// a dry-run must not keep ports reserved
+		tmp, err := ioutil.TempDir("", "kic-dry-run")
+		if err != nil {
+			klog.Fatal(err)
+		}
+		defer os.RemoveAll(tmp)
+		portsPath = filepath.Join(tmp, "ports.json")
+	}
+	allocator, err := ports.NewAllocator(portsPath, ports.DefaultMin, ports.DefaultMax)
 	if err != nil {
 		klog.Fatal(err)
 	}
 
+	var clusterCfg *cluster.Config
+	if *clusterConfig != "" {
+		clusterCfg, err = cluster.LoadConfig(*clusterConfig)
+		if err != nil {
+			klog.Fatal(err)
+		}
+	}
+
 	imgSha, err := image.NameForVersion(*kubeVersion)
 	if err != nil {
 		klog.Errorf("Error getting image %s", imgSha)
 	}
-	envs, err := getProxyEnvs()
-	if err != nil {
-		klog.Errorf("Error getting proxy details %v", envs)
-	}
+	const podNetworkCIDR = "10.244.0.0/16"
+	const serviceCIDR = "10.96.0.0/12"
 	nodeName := *profile + "-control-plane"
 	ns := &node.Spec{
 		Profile:           *profile,
@@ -62,123 +125,309 @@ func main() {
 		Image:             imgSha,
 		CPUs:              *cpus,
 		Memory:            *memory,
-		Role:              "control-plane",
+		Role:              node.ControlPlaneRole,
 		ExtraMounts:       []cri.Mount{},
 		ExtraPortMappings: []cri.PortMapping{},
 		APIServerAddress:  *hostIP,
-		APIServerPort:     hostPort,
 		IPv6:              false,
-		Envs:              envs,
+		PodSubnet:         podNetworkCIDR,
+		ServiceSubnet:     serviceCIDR,
+		PersistVar:        *persist,
+		// re-running -start for the same profile reuses the existing node
+		ConflictPolicy: oci.ConflictReuseIfMatching,
+		Ports:          allocator,
 	}
 
-	runner := mycmder.New(ns.Name, "docker")
+	runner := command.NewContainerRunner(engine, ns.Name)
 
 	if *start {
-		fmt.Printf("Starting on port %d\n ", hostPort)
-		err := oci.PullIfNotPresent(imgSha, false, time.Minute*3)
+		// the port is kept for the profile, re-running -start reuses it
+		hostPort, err := allocator.Reserve(*profile, "apiserver", *hostIP)
 		if err != nil {
-			klog.Errorf("Error pulling image %s", imgSha)
+			klog.Fatalf("Error reserving the api server port: %v", err)
+		}
+		ns.APIServerPort = hostPort
+		if !*dryRun {
+			fmt.Printf("Starting on port %d\n ", hostPort)
+		}
+		pullOpts := oci.PullOptions{MaxWait: time.Minute * 3}
+		if !*dryRun {
+			pullOpts.Progress = pullProgress()
+		}
+		err = oci.PullImage(ctx, engine, imgSha, pullOpts)
+		if !*dryRun {
+			fmt.Println()
+		}
+		if err != nil {
+			klog.Errorf("Error pulling image %s: %v", imgSha, err)
+		}
+
+		// create the cluster network first, its subnet must not be proxied
+		ns.Network, err = node.EnsureNetwork(ctx, engine, *profile, ns.IPv6, podNetworkCIDR, serviceCIDR)
+		if err != nil {
+			klog.Fatalf("Error creating network for %s: %v", *profile, err)
+		}
+		ns.Envs, err = getProxyEnvs(ctx, engine, ns.Network)
+		if err != nil {
+			klog.Errorf("Error getting proxy details %v", ns.Envs)
+		}
+
+		// several control planes are only reachable through a load balancer
+		var lb *node.Node
+		if *controlPlanes > 1 {
+			err = oci.PullImage(ctx, engine, action.LoadBalancerImage, oci.PullOptions{MaxWait: time.Minute * 3})
+			if err != nil {
+				klog.Errorf("Error pulling image %s: %v", action.LoadBalancerImage, err)
+			}
+			lbs := *ns
+			lbs.Name = *profile + "-external-load-balancer"
+			lbs.Role = node.ExternalLoadBalancerRole
+			lbs.Image = action.LoadBalancerImage
+			lbs.CPUs, lbs.Memory = "", ""
+			lbs.PersistVar = false
+			lb, err = lbs.CreateContext(ctx, engine, command.NewContainerRunner(engine, lbs.Name))
+			if err != nil {
+				klog.Fatalf("Error Creating node %s %v", lbs.Name, err)
+			}
+			// only the load balancer publishes the api server
+			ns.APIServerPort = 0
 		}
 
 		// create node
-		node, err := ns.Create(runner)
+		cp, err := ns.CreateContext(ctx, engine, runner)
 		if err != nil {
 			klog.Errorf("Error Creating node %s %v", ns.Name, err)
 		}
 
-		ip, _, err := node.IP()
+		ip, _, err := cp.IPContext(ctx)
 		if err != nil {
 			klog.Errorf("Error getting node ip: %s error: %v", ip, err)
 		}
-
-		podNetworkCIDR := "10.244.0.0/16"
+		endpoint := ip + ":6443"
+
+		cps := []*node.Node{cp}
+		for i := 2; i <= *controlPlanes; i++ {
+			cs := *ns
+			cs.Name = fmt.Sprintf("%s%d", nodeName, i)
+			c, err := cs.CreateContext(ctx, engine, command.NewContainerRunner(engine, cs.Name))
+			if err != nil {
+				klog.Errorf("Error Creating node %s %v", cs.Name, err)
+				continue
+			}
+			cps = append(cps, c)
+		}
+		var initOpts []action.InitOpt
+		var certificateKey string
+		if lb != nil {
+			if err := action.UpdateLoadBalancerContext(ctx, lb, cps); err != nil {
+				klog.Fatalf("failed to configure the load balancer : %v", err)
+			}
+			lbIP, _, err := lb.IPContext(ctx)
+			if err != nil {
+				klog.Fatalf("Error getting load balancer ip: %v", err)
+			}
+			endpoint = lbIP + ":6443"
+			// the other control planes join with the certificates of the first one
+			certificateKey, err = action.NewCertificateKey()
+			if err != nil {
+				klog.Fatal(err)
+			}
+			initOpts = append(initOpts, action.UploadCerts())
+		}
 
 		cfg := action.ConfigData{
 			ClusterName:          *profile,
 			KubernetesVersion:    *kubeVersion,
-			ControlPlaneEndpoint: ip + ":6443",
+			ControlPlaneEndpoint: endpoint,
 			APIBindPort:          6443,
 			APIServerAddress:     *hostIP,
-			Token:                "abcdef.0123456789abcdef",
+			NodeAddress:          ip,
+			Token:                action.Token,
+			CertificateKey:       certificateKey,
 			PodSubnet:            podNetworkCIDR,
-			ServiceSubnet:        "10.96.0.0/12",
+			ServiceSubnet:        serviceCIDR,
 			ControlPlane:         true,
 			IPv6:                 false,
 		}
 
-		kCfg, err := action.KubeAdmCfg(cfg)
+		kCfg, err := action.KubeAdmCfg(cfg, clusterCfg)
 		if err != nil {
 			klog.Errorf("failed to generate kubeaddm  error: %v , kCfg :\n %+v", err, kCfg)
 		}
 		kaCfgPath := "/kic/kubeadm.conf"
 		// copy the config to the node
-		if err := node.WriteFile(kaCfgPath, kCfg, "644"); err != nil {
+		if err := cp.WriteFileContext(ctx, kaCfgPath, kCfg, "644"); err != nil {
 			klog.Fatalf("failed to copy kubeadm config to node : %v", err)
 		}
 
-		err = action.RunKubeadmInit(node.R, kaCfgPath, *profile)
+		err = action.RunKubeadmInitContext(ctx, cp.R, kaCfgPath, *profile, initOpts...)
 		if err != nil {
 			klog.Errorf("failed to RunKubeadmInit : %v", err)
 		}
 
-		err = action.RemoveMasterTaint(node.R)
+		err = action.RemoveMasterTaintContext(ctx, cp.R)
 		if err != nil {
 			klog.Errorf("failed to RunTaint : %v", err)
 		}
 
-		cniManifest, err := action.GetDefaultCNIManifest(node.R, podNetworkCIDR)
-		if err != nil {
+		cniManifest, err := action.GetDefaultCNIManifestContext(ctx, cp.R, podNetworkCIDR)
+		switch {
+		case err == nil:
+			err = action.ApplyCNIManifestContext(ctx, cp.R, cniManifest)
+			if err != nil {
+				klog.Errorf("failed to ApplyCNI : %v", err)
+			}
+		case *dryRun:
+			// the manifest is templated from a file of the node, unknown to a dry-run
+			plan.Unrenderable(fmt.Sprintf("applying the CNI manifest templated from /kind/manifests/default-cni.yaml of %s with the pod subnet %s", cp.Name(), podNetworkCIDR))
+		default:
 			klog.Errorf("failed to InstallCNI : %v", err)
 		}
 
-		err = action.ApplyCNIManifest(node.R, cniManifest)
+		// control planes join one at a time, each adds an etcd member
+		for _, c := range cps[1:] {
+			cCfg := cfg
+			cCfg.NodeAddress, _, err = c.IPContext(ctx)
+			if err == nil {
+				err = action.RunKubeadmJoinContext(ctx, c.R, cCfg, clusterCfg)
+			}
+			if err != nil {
+				klog.Errorf("failed to join control plane %s : %v", c.Name(), err)
+			}
+		}
+
+		// create the workers, then join them all at once
+		var joining []*node.Node
+		for i := 1; i <= *workers; i++ {
+			ws := *ns
+			ws.Name = workerName(*profile, i)
+			ws.Role = node.WorkerRole
+			ws.CPUs, ws.Memory = "", ""
+			ws.APIServerPort = 0
+			w, err := ws.CreateContext(ctx, engine, command.NewContainerRunner(engine, ws.Name))
+			if err != nil {
+				klog.Errorf("Error Creating node %s %v", ws.Name, err)
+				continue
+			}
+			joining = append(joining, w)
+		}
+		_, err = node.FanOut(ctx, joining, 0, func(ctx context.Context, w *node.Node) (*command.RunResult, error) {
+			wCfg := cfg
+			wCfg.ControlPlane = false
+			ip, _, err := w.IPContext(ctx)
+			if err != nil {
+				return nil, err
+			}
+			wCfg.NodeAddress = ip
+			return nil, action.RunKubeadmJoinContext(ctx, w.R, wCfg, clusterCfg)
+		})
 		if err != nil {
-			klog.Errorf("failed to ApplyCNI : %v", err)
+			klog.Errorf("failed to join workers : %v", err)
 		}
 
 		if len(*userImg) != 0 {
-			loadImage(*userImg, node)
+			nodes := append(cps, joining...)
+			loadImage(ctx, engine, *userImg, nodes...)
 		}
 
-		c, err := action.GenerateKubeConfig(node.R, *hostIP, hostPort, *profile) // generates from the /etc/ inside container
+		c, err := action.GenerateKubeConfigContext(ctx, cp.R, *hostIP, hostPort, *profile) // generates from the /etc/ inside container
 		if err != nil {
 			klog.Errorf("failed to GenerateKubeConfig : %v", err)
 		}
 
-		// kubeconfig for end-user
-		err = action.WriteKubeConfig(c, *profile)
-		if err != nil {
-			klog.Errorf("failed to WriteKubeConfig : %v", err)
+		// kubeconfig for end-user, a dry-run doesn't get a real one
+		if !*dryRun {
+			err = action.WriteKubeConfig(c, *profile)
+			if err != nil {
+				klog.Errorf("failed to WriteKubeConfig : %v", err)
+			}
 		}
 
 	}
 
 	if *remove {
 		fmt.Printf("Removing ... %s\n", *profile)
-		node, err := node.Find(nodeName, runner)
+		nodes, err := profileNodes(ctx, engine, ns)
 		if err != nil {
-			klog.Errorf("error reading image (%s) from disk : %v", *userImg, err)
+			klog.Errorf("error listing nodes of %s: %v", *profile, err)
 			os.Exit(1)
 		}
 
-		err = node.Remove()
+		var opts []node.RemoveOpt
+		if *keepVolume {
+			opts = append(opts, node.KeepVolume())
+		}
+		_, err = node.FanOut(ctx, nodes, 0, func(ctx context.Context, n *node.Node) (*command.RunResult, error) {
+			return nil, n.RemoveContext(ctx, opts...)
+		})
 		if err != nil {
 			klog.Errorf("failed to remove cluster %s : %v", *profile, err)
 		}
+		if err := allocator.Release(*profile); err != nil {
+			klog.Errorf("failed to release the ports of %s : %v", *profile, err)
+		}
 
 	}
 
+	if *removeNode != "" {
+		nodes, err := profileNodes(ctx, engine, ns)
+		if err != nil {
+			klog.Errorf("error listing nodes of %s: %v", *profile, err)
+			os.Exit(1)
+		}
+		var lb, removed *node.Node
+		var rest []*node.Node
+		for _, n := range nodes {
+			switch {
+			case n.Name() == *removeNode:
+				removed = n
+			case n.Role() == node.ExternalLoadBalancerRole:
+				lb = n
+			default:
+				rest = append(rest, n)
+			}
+		}
+		if removed == nil {
+			klog.Errorf("no node %s in %s", *removeNode, *profile)
+			os.Exit(1)
+		}
+		if removed.Role() != node.ExternalLoadBalancerRole {
+			// leave the cluster first, removing the etcd member of a control plane
+			if err := action.RunKubeadmResetContext(ctx, removed.R); err != nil {
+				klog.Errorf("failed to reset node %s : %v", *removeNode, err)
+			}
+			for _, n := range rest {
+				if n.Role() != node.ControlPlaneRole {
+					continue
+				}
+				if err := action.DeleteNodeContext(ctx, n.R, removed.Name()); err != nil {
+					klog.Errorf("failed to delete node %s : %v", *removeNode, err)
+				}
+				break
+			}
+		}
+		if err := removed.RemoveContext(ctx, node.ReleasePorts(allocator, *profile)); err != nil {
+			klog.Errorf("failed to remove node %s : %v", *removeNode, err)
+		}
+		// the load balancer must stop sending requests to a removed control plane
+		if lb != nil && removed.Role() == node.ControlPlaneRole {
+			if err := action.UpdateLoadBalancerContext(ctx, lb, rest); err != nil {
+				klog.Errorf("failed to update the load balancer : %v", err)
+			}
+		}
+	}
+
 	if *load && len(*userImg) != 0 {
-		node, err := node.Find(nodeName, runner)
+		nodes, err := profileNodes(ctx, engine, ns)
 		if err != nil {
-			klog.Errorf("error reading image (%s) from disk : %v", *userImg, err)
+			klog.Errorf("error listing nodes of %s: %v", *profile, err)
 			os.Exit(1)
 		}
-		loadImage(*userImg, node)
+		loadImage(ctx, engine, *userImg, nodes...)
 	}
 
 	if *copy {
-		node, err := node.Find(nodeName, runner)
+		node, err := node.FindContext(ctx, engine, nodeName, runner)
 		if err != nil {
 			klog.Errorf("error finding node %s: %v", *userImg, err)
 			os.Exit(1)
@@ -191,7 +440,7 @@ func main() {
 	}
 
 	if *rmFile {
-		_, err := node.Find(nodeName, runner)
+		_, err := node.FindContext(ctx, engine, nodeName, runner)
 		if err != nil {
 			klog.Errorf("error finding node %s: %v", *userImg, err)
 			os.Exit(1)
@@ -205,7 +454,7 @@ func main() {
 	}
 
 	if *pause {
-		node, err := node.Find(nodeName, runner)
+		node, err := node.FindContext(ctx, engine, nodeName, runner)
 		if err != nil {
 			klog.Errorf("error finding node %s: %v", *userImg, err)
 			os.Exit(1)
@@ -218,7 +467,7 @@ func main() {
 	}
 
 	if *stop {
-		node, err := node.Find(nodeName, runner)
+		node, err := node.FindContext(ctx, engine, nodeName, runner)
 		if err != nil {
 			klog.Errorf("error finding node %s: %v", *userImg, err)
 			os.Exit(1)
@@ -230,25 +479,116 @@ func main() {
 		}
 	}
 
+	if *resume || *unpause || *restart {
+		node, err := node.FindContext(ctx, engine, nodeName, runner)
+		if err != nil {
+			klog.Errorf("error finding node %s: %v", nodeName, err)
+			os.Exit(1)
+		}
+
+		switch {
+		case *resume:
+			err = node.StartContext(ctx)
+		case *unpause:
+			err = node.UnpauseContext(ctx)
+		case *restart:
+			err = node.RestartContext(ctx)
+		}
+		if err != nil {
+			klog.Errorf("Error bringing back node %s %v", ns.Name, err)
+		}
+	}
+
 	if *status {
 		fmt.Printf("Status for: %s\n", *profile)
-		node, err := node.Find(nodeName, runner)
+		node, err := node.FindContext(ctx, engine, nodeName, runner)
 		if err != nil {
 			klog.Errorf("error getting node %v", err)
 			os.Exit(1)
 		}
 
-		s, err := node.Status()
-		fmt.Println(s)
+		s, err := node.StateContext(ctx)
 		if err != nil {
 			fmt.Printf("error is %v", err)
 		}
+		fmt.Println(s.MachineState())
+		switch {
+		case s.CrashLooping():
+			fmt.Printf("node is crash-looping: restarted %d times, last exit code %d\n", s.RestartCount, s.ExitCode)
+		case s.NeverStarted():
+			fmt.Println("node was created but never started")
+		case s.OOMKilled:
+			fmt.Println("node was killed because it ran out of memory")
+		}
 
 	}
+
+	if *export != "" {
+		nodes, err := profileNodes(ctx, engine, ns)
+		if err != nil {
+			klog.Fatalf("error listing nodes of %s: %v", *profile, err)
+		}
+		if err := action.ExportLogsContext(ctx, nodes, *export); err != nil {
+			klog.Fatalf("error exporting the diagnostics of %s: %v", *profile, err)
+		}
+		fmt.Printf("Exported the diagnostics of %s to %s\n", *profile, *export)
+	}
+
+	if *logs != "" {
+		n, err := node.FindContext(ctx, engine, nodeName, runner)
+		if err != nil {
+			klog.Errorf("error getting node %v", err)
+			os.Exit(1)
+		}
+		opts := oci.LogsOptions{Follow: *follow}
+		var r io.ReadCloser
+		switch *logs {
+		case "node":
+			r, err = n.LogsContext(ctx, opts)
+		case "kubelet", "containerd":
+			r, err = n.UnitLogsContext(ctx, *logs, opts)
+		default:
+			r, err = n.ContainerLogsContext(ctx, *logs, opts)
+		}
+		if err != nil {
+			klog.Fatalf("error getting %s logs: %v", *logs, err)
+		}
+		defer r.Close()
+		if _, err := io.Copy(os.Stdout, r); err != nil && ctx.Err() == nil {
+			klog.Errorf("error reading %s logs: %v", *logs, err)
+		}
+	}
+}
+
+// workerName returns the name of the i-th worker of a profile, from 1
+func workerName(profile string, i int) string {
+	if i == 1 {
+		return profile + "-worker"
+	}
+	return fmt.Sprintf("%s-worker%d", profile, i)
+}
+
+// profileNodes returns the nodes of the profile of ns
+func profileNodes(ctx context.Context, engine oci.Engine, ns *node.Spec) ([]*node.Node, error) {
+	names, err := ns.ListNodesContext(ctx, engine)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []*node.Node
+	for _, name := range names {
+		n, err := node.FindContext(ctx, engine, name, command.NewContainerRunner(engine, name))
+		if err != nil {
+			klog.Errorf("error getting node %s: %v", name, err)
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
 }
 
-func loadImage(image string, node *node.Node) {
-	_, err := oci.ImageID(image)
+// loadImage loads a local image into nodes, all at once
+func loadImage(ctx context.Context, engine oci.Engine, image string, nodes ...*node.Node) {
+	_, err := oci.ImageID(ctx, engine, image)
 	if err != nil {
 		klog.Errorf("error getting image not present locally %s: %v", image, err)
 		os.Exit(1)
@@ -264,30 +604,23 @@ func loadImage(image string, node *node.Node) {
 	imageTarPath := filepath.Join(dir, "image.tar")
 	fmt.Println(imageTarPath)
 	fmt.Printf("Saving image archive %s\n", image)
-	err = oci.Save(oci.DefaultOCI, image, imageTarPath)
+	err = engine.Save(ctx, image, imageTarPath)
 	if err != nil {
 		klog.Errorf("error saving image archive %s: %v", image, err)
 		os.Exit(1)
 	}
 
-	f, err := os.Open(imageTarPath)
+	fmt.Printf("Loading image %s into %d nodes\n", image, len(nodes))
+	err = node.LoadImageArchiveAll(ctx, nodes, 0, imageTarPath)
 	if err != nil {
-		klog.Errorf("error reading image (%s) from disk : %v", image, err)
-		os.Exit(1)
-	}
-	defer f.Close()
-
-	fmt.Printf("Loading image %s\n", image)
-	err = node.LoadImageArchive(f)
-	if err != nil {
-		klog.Errorf("error loading (%s) into the node : %v", image, err)
+		klog.Errorf("error loading (%s) into the nodes : %v", image, err)
 		os.Exit(1)
 	}
 }
 
 // getProxyEnvs returns a struct with the host environment proxy settings
 // that should be passed to the nodes
-func getProxyEnvs() (map[string]string, error) {
+func getProxyEnvs(ctx context.Context, engine oci.Engine, network string) (map[string]string, error) {
 	const httpProxy = "HTTP_PROXY"
 	const httpsProxy = "HTTPS_PROXY"
 	const noProxy = "NO_PROXY"
@@ -313,9 +646,9 @@ func getProxyEnvs() (map[string]string, error) {
 		}
 	}
 
-	// Specifically add the docker network subnets to NO_PROXY if we are using proxies
+	// Specifically add the node network subnets to NO_PROXY if we are using proxies
 	if proxySupport {
-		subnets, err := oci.GetSubnets(node.DefaultNetwork)
+		subnets, err := oci.GetSubnets(ctx, engine, network)
 		if err != nil {
 			return nil, err
 		}
@@ -327,6 +660,42 @@ func getProxyEnvs() (map[string]string, error) {
 	return envs, nil
 }
 
+// pullProgress returns a PullProgress printing the download progress of
+// all the layers of an image on one line
+func pullProgress() oci.PullProgress {
+	type layer struct {
+		current, total int64
+		done           bool
+	}
+	layers := map[string]*layer{}
+	return func(e oci.PullEvent) {
+		if e.Layer == "" {
+			return
+		}
+		l, ok := layers[e.Layer]
+		if !ok {
+			l = &layer{}
+			layers[e.Layer] = l
+		}
+		switch e.Status {
+		case "Downloading":
+			l.current, l.total = e.Current, e.Total
+		case "Download complete", "Pull complete", "Already exists":
+			l.current, l.done = l.total, true
+		}
+		var current, total int64
+		done := 0
+		for _, l := range layers {
+			current += l.current
+			total += l.total
+			if l.done {
+				done++
+			}
+		}
+		fmt.Printf("\rPulling image: %d/%d layers, %d/%d MB", done, len(layers), current>>20, total>>20)
+	}
+}
+
 func copyAsset(n *node.Node, src, dest string) error {
 	fileInfo, err := os.Stat(src)
 	if err != nil {
@@ -344,5 +713,5 @@ func copyAsset(n *node.Node, src, dest string) error {
 		Permissions: "0777",
 	}
 
-	return n.Copy(oci.DefaultOCI, asset)
+	return n.Copy(asset)
 }
@@ -11,7 +11,6 @@ require (
 	github.com/golang/protobuf v1.3.1 // indirect
 	github.com/googleapis/gnostic v0.3.0 // indirect
 	github.com/mailru/easyjson v0.0.0-20190620125010-da37f6c1e481 // indirect
-	github.com/phayes/freeport v0.0.0-20180830031419-95f893ade6f2
 	github.com/pkg/errors v0.8.1
 	github.com/spf13/cobra v0.0.5 // indirect
 	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4
@@ -23,4 +22,5 @@ require (
 	k8s.io/client-go v11.0.0+incompatible
 	k8s.io/klog v0.3.3
 	sigs.k8s.io/kustomize v2.0.3+incompatible
+	sigs.k8s.io/yaml v1.1.0
 )
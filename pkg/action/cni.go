@@ -2,6 +2,7 @@ package action
 
 import (
 	"bytes"
+	"context"
 	"html/template"
 	"os/exec"
 	"strings"
@@ -12,12 +13,17 @@ import (
 
 // GetDefaultCNIManifest returns the default CNI manifest
 func GetDefaultCNIManifest(r command.Runner, subnet string) ([]byte, error) {
+	return GetDefaultCNIManifestContext(context.Background(), r, subnet)
+}
+
+// GetDefaultCNIManifestContext is like GetDefaultCNIManifest but gives up when ctx is done
+func GetDefaultCNIManifestContext(ctx context.Context, r command.Runner, subnet string) ([]byte, error) {
 	// read the manifest from the node
 	var raw bytes.Buffer
 	cmd := exec.Command("cat", "/kind/manifests/default-cni.yaml")
 	cmd.Stdout = &raw
 
-	if _, err := r.RunCmd(cmd); err != nil {
+	if _, err := command.RunCmdContext(ctx, r, cmd); err != nil {
 		return nil, errors.Wrap(err, "failed to read CNI manifest")
 	}
 	manifest := raw.String()
@@ -47,12 +53,20 @@ func GetDefaultCNIManifest(r command.Runner, subnet string) ([]byte, error) {
 
 // ApplyCNIManifest applies a CNI manifest
 func ApplyCNIManifest(r command.Runner, manifest []byte) error {
+	return ApplyCNIManifestContext(context.Background(), r, manifest)
+}
+
+// ApplyCNIManifestContext is like ApplyCNIManifest but gives up when ctx is done.
+// kubectl is retried while the api server is settling, see command.APIServerRetryPolicy
+func ApplyCNIManifestContext(ctx context.Context, r command.Runner, manifest []byte) error {
 	cmd := exec.Command(
-		"kubectl", "create", "--kubeconfig=/etc/kubernetes/admin.conf",
+		// apply rather than create, an attempt that failed after creating
+		// some of the objects is retried
+		"kubectl", "apply", "--kubeconfig=/etc/kubernetes/admin.conf",
 		"-f", "-",
 	)
 	cmd.Stdin = bytes.NewReader(manifest)
-	if _, err := r.RunCmd(cmd); err != nil {
+	if _, err := command.RunCmdContext(ctx, apiServerRunner(r), cmd); err != nil {
 		return errors.Wrap(err, "failed to apply overlay network")
 	}
 	return nil
@@ -0,0 +1,42 @@
+package action
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/medyagh/kic/pkg/command"
+	"github.com/medyagh/kic/pkg/command/fake"
+)
+
+func TestApplyCNIManifest(t *testing.T) {
+	r := fake.NewRunner()
+	r.On("kubectl", "apply", fake.AnyArgs)
+	manifest := []byte("kind: DaemonSet\n")
+	if err := ApplyCNIManifestContext(context.Background(), r, manifest); err != nil {
+		t.Fatalf("ApplyCNIManifestContext: %v", err)
+	}
+	calls := r.Calls()
+	if len(calls) != 1 || calls[0].String() != "kubectl apply --kubeconfig=/etc/kubernetes/admin.conf -f -" || string(calls[0].Stdin) != string(manifest) {
+		t.Errorf("calls = %v, want the manifest to be applied", calls)
+	}
+}
+
+func TestApplyCNIManifestRetryingRunner(t *testing.T) {
+	r := fake.NewRunner()
+	r.On("kubectl", fake.AnyArgs).ExitCode(1).Stderr("The connection to the server was refused - connection refused")
+	policy := command.RetryPolicy{
+		StderrPatterns:  []*regexp.Regexp{regexp.MustCompile(`connection refused`)},
+		InitialInterval: time.Millisecond,
+		MaxAttempts:     2,
+	}
+	retrying := command.Chain(r, command.Logging(command.NopLogger, "p1-control-plane"), command.Retry(policy))
+	if err := ApplyCNIManifestContext(context.Background(), retrying, []byte("kind: DaemonSet\n")); err == nil {
+		t.Fatal("applying a manifest with the api server down succeeded")
+	}
+	// the retries of the chain are not retried again
+	if n := len(r.Calls()); n != 2 {
+		t.Errorf("kubectl ran %d times, want the 2 attempts of the chained policy", n)
+	}
+}
@@ -27,6 +27,9 @@ type ConfigData struct {
 	NodeAddress string
 	// The Token for TLS bootstrap
 	Token string
+	// CertificateKey encrypts the control plane certificates kubeadm init
+	// uploads for the control planes joining the cluster, see NewCertificateKey
+	CertificateKey string
 	// The subnet used for pods
 	PodSubnet string
 	// The subnet used for services
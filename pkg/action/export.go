@@ -0,0 +1,319 @@
+package action
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/medyagh/kic/pkg/command"
+	"github.com/medyagh/kic/pkg/node"
+	"github.com/medyagh/kic/pkg/oci"
+	"github.com/pkg/errors"
+)
+
+// ManifestFile is the name of the file listing the content of a bundle
+const ManifestFile = "manifest.json"
+
+// Manifest describes the content of a diagnostic bundle
+type Manifest struct {
+	Created time.Time       `json:"created"`
+	Entries []ManifestEntry `json:"entries"`
+}
+
+// ManifestEntry is a file of a diagnostic bundle
+type ManifestEntry struct {
+	Path        string `json:"path"`
+	Node        string `json:"node,omitempty"`
+	Description string `json:"description"`
+	// Error is why collecting the file failed, the file may then be partial
+	Error string `json:"error,omitempty"`
+}
+
+// ExportLogs collects the diagnostics of the nodes of a cluster into dest,
+// see ExportLogsContext
+func ExportLogs(nodes []*node.Node, dest string) error {
+	return ExportLogsContext(context.Background(), nodes, dest)
+}
+
+// ExportLogsContext collects for every node its inspect output, container
+// logs, kubelet and containerd journals, static pod manifests, kubeadm config,
+// crictl containers and images, and the cluster events, like "kind export
+// logs". dest is a directory, or a tar.gz archive if it ends with .tar.gz.
+// Collecting is best effort, failures are recorded in the manifest. Each file
+// is written as it is collected, without holding the logs in memory.
+func ExportLogsContext(ctx context.Context, nodes []*node.Node, dest string) (err error) {
+	created := time.Now()
+	var s sink = dirSink(dest)
+	if strings.HasSuffix(dest, ".tar.gz") {
+		if s, err = newArchiveSink(dest, created); err != nil {
+			return err
+		}
+	}
+	defer func() {
+		if cerr := s.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	b := &bundle{sink: s, manifest: Manifest{Created: created}}
+	for _, n := range nodes {
+		b.collectNode(ctx, n)
+	}
+	// the events of the cluster are the same on every control plane
+	for _, n := range nodes {
+		if n.Role() == node.ControlPlaneRole {
+			b.run(ctx, n, "events.txt", "kubectl get events -A",
+				"kubectl", "--kubeconfig=/etc/kubernetes/admin.conf", "get", "events", "-A")
+			break
+		}
+	}
+	if b.err != nil {
+		return b.err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	manifest, err := json.MarshalIndent(b.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	w, err := s.Create(ManifestFile)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(manifest); err != nil {
+		w.Close()
+		return errors.Wrapf(err, "failed to write %s", ManifestFile)
+	}
+	return w.Close()
+}
+
+// bundle writes the collected files to its sink and lists them in its manifest
+type bundle struct {
+	sink     sink
+	manifest Manifest
+	// err is the first failure to write to the sink, which stops collecting
+	err error
+}
+
+func (b *bundle) collectNode(ctx context.Context, n *node.Node) {
+	name := n.Name()
+	b.add(name, "inspect.json", n.Engine().Name()+" inspect", func(w io.Writer) error {
+		lines, err := n.Engine().Inspect(ctx, name, "{{json .}}")
+		if _, werr := io.WriteString(w, strings.Join(lines, "\n")); werr != nil {
+			return werr
+		}
+		return err
+	})
+
+	b.stream(name, "container.log", "node container logs", func() (io.ReadCloser, error) {
+		return n.LogsContext(ctx, oci.LogsOptions{})
+	})
+	for _, unit := range []string{"kubelet", "containerd"} {
+		unit := unit
+		b.stream(name, unit+".log", "journalctl -u "+unit, func() (io.ReadCloser, error) {
+			return n.UnitLogsContext(ctx, unit, oci.LogsOptions{})
+		})
+	}
+
+	b.run(ctx, n, filepath.Join(name, "kubeadm.conf"), "rendered kubeadm config", "cat", "/kic/kubeadm.conf")
+	b.run(ctx, n, filepath.Join(name, "crictl-ps.txt"), "crictl ps -a", "crictl", "ps", "-a")
+	b.run(ctx, n, filepath.Join(name, "crictl-images.txt"), "crictl images", "crictl", "images")
+
+	const manifestsDir = "/etc/kubernetes/manifests"
+	cmd := exec.Command("ls", "-1", manifestsDir)
+	rr, err := command.RunCmdContext(ctx, n.R, cmd)
+	if err != nil {
+		b.add(name, "manifests", "static pod manifests", func(w io.Writer) error {
+			return errors.Wrap(err, rr.Output())
+		})
+		return
+	}
+	for _, f := range strings.Fields(rr.Stdout.String()) {
+		b.run(ctx, n, filepath.Join(name, "manifests", f), "static pod manifest", "cat", manifestsDir+"/"+f)
+	}
+}
+
+// run collects the output of a command run on a node, which the runner
+// writes to the bundle without keeping it
+func (b *bundle) run(ctx context.Context, n *node.Node, path, description string, args ...string) {
+	b.addPath(n.Name(), path, description, func(w io.Writer) error {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdout = w
+		cmd.Stderr = w
+		_, err := command.RunCmdContext(command.Unbuffered(ctx), n.R, cmd)
+		return err
+	})
+}
+
+// stream collects the content of a log stream
+func (b *bundle) stream(nodeName, file, description string, open func() (io.ReadCloser, error)) {
+	b.add(nodeName, file, description, func(w io.Writer) error {
+		r, err := open()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		_, err = io.Copy(w, r)
+		return err
+	})
+}
+
+func (b *bundle) add(nodeName, file, description string, collect func(w io.Writer) error) {
+	b.addPath(nodeName, filepath.Join(nodeName, file), description, collect)
+}
+
+// addPath writes the file at path with collect and lists it in the
+// manifest, along with the error of collect
+func (b *bundle) addPath(nodeName, path, description string, collect func(w io.Writer) error) {
+	if b.err != nil {
+		return
+	}
+	path = filepath.ToSlash(path)
+	f, err := b.sink.Create(path)
+	if err != nil {
+		b.err = err
+		return
+	}
+	w := &sinkWriter{w: f}
+	err = collect(w)
+	if cerr := f.Close(); w.err == nil {
+		w.err = cerr
+	}
+	if w.err != nil {
+		b.err = errors.Wrapf(w.err, "failed to write %s", path)
+		return
+	}
+	entry := ManifestEntry{Path: path, Node: nodeName, Description: description}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	b.manifest.Entries = append(b.manifest.Entries, entry)
+}
+
+// sinkWriter records the first failure to write to the sink, to tell it
+// apart from the failures to collect the content
+type sinkWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (s *sinkWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	return n, err
+}
+
+// sink is where the files of a bundle are written, one at a time
+type sink interface {
+	// Create returns a writer for the file at path, a slash separated path
+	// relative to the bundle, the file is complete once it is closed
+	Create(path string) (io.WriteCloser, error)
+	io.Closer
+}
+
+// dirSink writes the files of a bundle under a directory
+type dirSink string
+
+func (d dirSink) Create(path string) (io.WriteCloser, error) {
+	p := filepath.Join(string(d), filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return nil, errors.Wrap(err, "failed to create bundle directory")
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create %s", p)
+	}
+	return f, nil
+}
+
+func (d dirSink) Close() error {
+	return nil
+}
+
+// archiveSink writes the files of a bundle to a tar.gz archive. A tar entry
+// starts with its size, so each file is spooled to a temporary file first.
+type archiveSink struct {
+	f       *os.File
+	gz      *gzip.Writer
+	tw      *tar.Writer
+	modTime time.Time
+}
+
+func newArchiveSink(dest string, modTime time.Time) (*archiveSink, error) {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return nil, errors.Wrap(err, "failed to create bundle directory")
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create bundle")
+	}
+	gz := gzip.NewWriter(f)
+	return &archiveSink{f: f, gz: gz, tw: tar.NewWriter(gz), modTime: modTime}, nil
+}
+
+func (a *archiveSink) Create(path string) (io.WriteCloser, error) {
+	spool, err := ioutil.TempFile("", "kic-export")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create a temporary file")
+	}
+	return &archiveEntry{sink: a, path: path, spool: spool}, nil
+}
+
+func (a *archiveSink) Close() error {
+	err := a.tw.Close()
+	if gzErr := a.gz.Close(); err == nil {
+		err = gzErr
+	}
+	if fErr := a.f.Close(); err == nil {
+		err = fErr
+	}
+	return err
+}
+
+// archiveEntry is a file of an archiveSink, archived when it is closed
+type archiveEntry struct {
+	sink  *archiveSink
+	path  string
+	spool *os.File
+}
+
+func (e *archiveEntry) Write(p []byte) (int, error) {
+	return e.spool.Write(p)
+}
+
+func (e *archiveEntry) Close() error {
+	defer os.Remove(e.spool.Name())
+	defer e.spool.Close()
+	size, err := e.spool.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := e.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	hdr := &tar.Header{
+		Name:    e.path,
+		Mode:    0644,
+		Size:    size,
+		ModTime: e.sink.modTime,
+	}
+	if err := e.sink.tw.WriteHeader(hdr); err != nil {
+		return errors.Wrapf(err, "failed to archive %s", e.path)
+	}
+	if _, err := io.Copy(e.sink.tw, e.spool); err != nil {
+		return errors.Wrapf(err, "failed to archive %s", e.path)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package action
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/medyagh/kic/pkg/command/fake"
+	"github.com/medyagh/kic/pkg/node"
+	ocifake "github.com/medyagh/kic/pkg/oci/fake"
+)
+
+// newExportNodes returns a control plane whose diagnostics are collected,
+// a worker whose containerd journal fails, and a node whose container is
+// gone, so all of its diagnostics fail
+func newExportNodes(t *testing.T) []*node.Node {
+	t.Helper()
+	e := ocifake.NewEngine()
+	cp := fake.NewRunner()
+	cp.On("journalctl", "--no-pager", "-u", "kubelet").Stdout("Started kubelet\n")
+	cp.On("journalctl", "--no-pager", "-u", "containerd").Stdout("Started containerd\n")
+	cp.On("cat", "/kic/kubeadm.conf").Stdout("kind: ClusterConfiguration\n")
+	cp.On("crictl", "ps", "-a").Stdout("CONTAINER ID\n")
+	cp.On("crictl", "images").Stdout("IMAGE\n")
+	cp.On("ls", "-1", "/etc/kubernetes/manifests").Stdout("etcd.yaml\nkube-apiserver.yaml\n")
+	cp.On("cat", "/etc/kubernetes/manifests/*").Stdout("kind: Pod\n")
+	cp.On("kubectl", fake.AnyArgs).Stdout("LAST SEEN   TYPE\n")
+
+	worker := fake.NewRunner()
+	worker.On("journalctl", "--no-pager", "-u", "kubelet").Stdout("Started kubelet\n")
+	worker.On("journalctl", "--no-pager", "-u", "containerd").Stdout("-- Logs begin --\n").Stderr("Failed to iterate through journal").ExitCode(1)
+	worker.On("cat", "/kic/kubeadm.conf").Stdout("kind: JoinConfiguration\n")
+	worker.On("crictl", fake.AnyArgs).Stdout("\n")
+	worker.On("ls", "-1", "/etc/kubernetes/manifests")
+
+	nodes := []*node.Node{
+		createNode(t, e, "p1-control-plane", node.ControlPlaneRole, cp),
+		createNode(t, e, "p1-worker", node.WorkerRole, worker),
+		createNode(t, e, "p1-worker2", node.WorkerRole, fake.NewRunner()),
+	}
+	e.SetLogs("p1-control-plane", "control plane booted\n")
+	e.SetLogs("p1-worker", "worker booted\n")
+	if err := e.Remove(context.Background(), "p1-worker2"); err != nil {
+		t.Fatal(err)
+	}
+	return nodes
+}
+
+// checkBundle checks the files of an exported bundle and its manifest
+func checkBundle(t *testing.T, files map[string]string) {
+	t.Helper()
+	want := map[string]string{
+		"p1-control-plane/container.log":                 "control plane booted\n",
+		"p1-control-plane/kubelet.log":                   "Started kubelet\n",
+		"p1-control-plane/containerd.log":                "Started containerd\n",
+		"p1-control-plane/kubeadm.conf":                  "kind: ClusterConfiguration\n",
+		"p1-control-plane/crictl-ps.txt":                 "CONTAINER ID\n",
+		"p1-control-plane/crictl-images.txt":             "IMAGE\n",
+		"p1-control-plane/manifests/etcd.yaml":           "kind: Pod\n",
+		"p1-control-plane/manifests/kube-apiserver.yaml": "kind: Pod\n",
+		"p1-worker/container.log":                        "worker booted\n",
+		"p1-worker/containerd.log":                       "-- Logs begin --\n",
+		"p1-worker/kubeadm.conf":                         "kind: JoinConfiguration\n",
+		"events.txt":                                     "LAST SEEN   TYPE\n",
+	}
+	for path, content := range want {
+		got, ok := files[path]
+		if !ok {
+			t.Errorf("%s is missing from the bundle", path)
+			continue
+		}
+		if got != content {
+			t.Errorf("%s = %q, want %q", path, got, content)
+		}
+	}
+	if !strings.Contains(files["p1-control-plane/inspect.json"], `"Name":"/p1-control-plane"`) {
+		t.Errorf("p1-control-plane/inspect.json = %q", files["p1-control-plane/inspect.json"])
+	}
+
+	var m Manifest
+	if err := json.Unmarshal([]byte(files[ManifestFile]), &m); err != nil {
+		t.Fatalf("decoding %s: %v", ManifestFile, err)
+	}
+	entries := map[string]ManifestEntry{}
+	for _, e := range m.Entries {
+		entries[e.Path] = e
+		if _, ok := files[e.Path]; !ok {
+			t.Errorf("%s is in the manifest but not in the bundle", e.Path)
+		}
+	}
+	for path := range files {
+		if _, ok := entries[path]; !ok && path != ManifestFile {
+			t.Errorf("%s is in the bundle but not in the manifest", path)
+		}
+	}
+	for path := range want {
+		if e := entries[path]; path != "p1-worker/containerd.log" && e.Error != "" {
+			t.Errorf("%s failed: %s", path, e.Error)
+		}
+	}
+	if e := entries["p1-worker/containerd.log"]; e.Node != "p1-worker" || !strings.Contains(e.Error, "Failed to iterate through journal") {
+		t.Errorf("manifest entry of the failed unit = %+v, want its failure", e)
+	}
+	for _, path := range []string{
+		"p1-worker2/inspect.json",
+		"p1-worker2/container.log",
+		"p1-worker2/kubelet.log",
+		"p1-worker2/kubeadm.conf",
+		"p1-worker2/manifests",
+	} {
+		if e, ok := entries[path]; !ok || e.Error == "" {
+			t.Errorf("manifest entry of %s = %+v, want the failure of the missing node", path, e)
+		}
+	}
+}
+
+func TestExportLogsDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "logs")
+
+	if err := ExportLogsContext(context.Background(), newExportNodes(t), dest); err != nil {
+		t.Fatalf("ExportLogsContext: %v", err)
+	}
+	files := map[string]string{}
+	err = filepath.Walk(dest, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dest, path)
+		files[filepath.ToSlash(rel)] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBundle(t, files)
+}
+
+func TestExportLogsArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "logs.tar.gz")
+
+	if err := ExportLogsContext(context.Background(), newExportNodes(t), dest); err != nil {
+		t.Fatalf("ExportLogsContext: %v", err)
+	}
+	f, err := os.Open(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	files := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name] = string(b)
+	}
+	checkBundle(t, files)
+}
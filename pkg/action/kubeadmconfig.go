@@ -8,9 +8,25 @@ import (
 	"github.com/medyagh/kic/pkg/config/kustomize"
 )
 
-// KubeAdmCfg returns the kubeadm config
-func KubeAdmCfg(cd ConfigData) (string, error) {
-	clusterCfg := &cluster.Config{}
+// PatchError is returned when a patch of the kubeadm config can not be applied
+type PatchError struct {
+	// Patch names the failed patch after its cluster.Config field, eg kubeadmConfigPatches[1]
+	Patch string
+	Err   error
+}
+
+func (e *PatchError) Error() string {
+	return fmt.Sprintf("failed to apply %s to the kubeadm config: %v", e.Patch, e.Err)
+}
+
+// KubeAdmCfg returns the kubeadm config, with the KubeadmConfigPatches and
+// KubeadmConfigPatchesJSON6902 of clusterCfg applied, if any. The apiserver
+// flags, kubelet and kube-proxy configs etc.. can be customized with them.
+// clusterCfg may be nil.
+func KubeAdmCfg(cd ConfigData, clusterCfg *cluster.Config) (string, error) {
+	if clusterCfg == nil {
+		clusterCfg = &cluster.Config{}
+	}
 	config, err := templateExec(cd)
 	if err != nil {
 		return "", err
@@ -23,12 +39,33 @@ func KubeAdmCfg(cd ConfigData) (string, error) {
 	// apply patches
 	patched, err := kustomize.Build([]string{config}, patches, jsonPatches)
 	if err != nil {
-		return "", err
+		return "", patchError(config, patches, jsonPatches, err)
 	}
 
 	return removeMetadata(patched), nil
 }
 
+// patchError finds the patch that failed to apply, by applying the patches
+// one more at a time in the order kustomize does: the strategic merge ones,
+// then the json 6902 ones
+func patchError(config string, patches []string, jsonPatches []kustomize.PatchJSON6902, err error) error {
+	for i := range patches {
+		if _, perr := kustomize.Build([]string{config}, patches[:i+1], nil); perr != nil {
+			return &PatchError{Patch: fmt.Sprintf("kubeadmConfigPatches[%d]", i), Err: perr}
+		}
+	}
+	for i, p := range jsonPatches {
+		if _, perr := kustomize.Build([]string{config}, patches, jsonPatches[:i+1]); perr != nil {
+			return &PatchError{
+				Patch: fmt.Sprintf("kubeadmConfigPatchesJson6902[%d] (%s)", i, p.Kind),
+				Err:   perr,
+			}
+		}
+	}
+	// only the combination of patches fails
+	return &PatchError{Patch: "kubeadmConfigPatches", Err: err}
+}
+
 // trims out the metadata.name we put in the config for kustomize matching,
 // kubeadm will complain about this otherwise
 func removeMetadata(kustomized string) string {
@@ -53,8 +90,8 @@ func setPatchNames(patches []string, jsonPatches []kustomize.PatchJSON6902) ([]s
 	fixedPatches := make([]string, len(patches))
 	fixedJSONPatches := make([]kustomize.PatchJSON6902, len(jsonPatches))
 	for i, patch := range patches {
-		// insert the generated name metadata
-		fixedPatches[i] = fmt.Sprintf("metadata:\nname: %s\n%s", ObjectName, patch)
+		// append the generated name metadata, the patch may not end with a newline
+		fixedPatches[i] = fmt.Sprintf("%s\nmetadata:\n  name: %s\n", patch, ObjectName)
 	}
 	for i, patch := range jsonPatches {
 		// insert the generated name metadata
@@ -0,0 +1,204 @@
+package action
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/medyagh/kic/pkg/cluster"
+	"github.com/medyagh/kic/pkg/config/kustomize"
+)
+
+// configDoc returns the document of kind of a kubeadm config
+func configDoc(t *testing.T, config, kind string) string {
+	t.Helper()
+	for _, doc := range strings.Split(config, "\n---\n") {
+		if strings.Contains(doc, "kind: "+kind+"\n") {
+			return doc
+		}
+	}
+	t.Fatalf("the kubeadm config has no %s:\n%s", kind, config)
+	return ""
+}
+
+func TestKubeAdmCfgPatches(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       ConfigData
+		clusterCfg *cluster.Config
+		kind       string
+		want       []string
+	}{
+		{
+			name: "strategic merge patch of the ClusterConfiguration",
+			data: joinConfigData(true),
+			clusterCfg: &cluster.Config{KubeadmConfigPatches: []string{`apiVersion: kubeadm.k8s.io/v1beta2
+kind: ClusterConfiguration
+apiServer:
+  extraArgs:
+    enable-admission-plugins: NodeRestriction,PodSecurityPolicy`}},
+			kind: "ClusterConfiguration",
+			// the generated fields are kept
+			want: []string{"enable-admission-plugins: NodeRestriction,PodSecurityPolicy", "certSANs:", "clusterName: p1"},
+		},
+		{
+			name: "strategic merge patch of the JoinConfiguration",
+			data: joinConfigData(false),
+			clusterCfg: &cluster.Config{KubeadmConfigPatches: []string{`apiVersion: kubeadm.k8s.io/v1beta2
+kind: JoinConfiguration
+nodeRegistration:
+  kubeletExtraArgs:
+    node-labels: "ingress-ready=true"
+`}},
+			kind: "JoinConfiguration",
+			want: []string{"node-labels: ingress-ready=true", "node-ip: 172.18.0.3"},
+		},
+		{
+			name: "JSON 6902 patch",
+			data: joinConfigData(true),
+			clusterCfg: &cluster.Config{KubeadmConfigPatchesJSON6902: []kustomize.PatchJSON6902{{
+				Group:   "kubeadm.k8s.io",
+				Version: "v1beta2",
+				Kind:    "ClusterConfiguration",
+				Patch: `- op: add
+  path: /apiServer/extraArgs
+  value:
+    audit-log-maxage: "30"`,
+			}}},
+			kind: "ClusterConfiguration",
+			want: []string{`audit-log-maxage: "30"`, "certSANs:"},
+		},
+		{
+			name: "patch with metadata",
+			data: joinConfigData(true),
+			clusterCfg: &cluster.Config{KubeadmConfigPatches: []string{`apiVersion: kubeproxy.config.k8s.io/v1alpha1
+kind: KubeProxyConfiguration
+metadata:
+  name: my-proxy-config
+mode: ipvs
+`}},
+			kind: "KubeProxyConfiguration",
+			want: []string{"mode: ipvs"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := KubeAdmCfg(tc.data, tc.clusterCfg)
+			if err != nil {
+				t.Fatalf("KubeAdmCfg: %v", err)
+			}
+			doc := configDoc(t, config, tc.kind)
+			for _, s := range tc.want {
+				if !strings.Contains(doc, s) {
+					t.Errorf("%s does not contain %q:\n%s", tc.kind, s, doc)
+				}
+			}
+			// the name kustomize matches the patches with is removed
+			if strings.Contains(config, "metadata:") {
+				t.Errorf("the kubeadm config has metadata:\n%s", config)
+			}
+		})
+	}
+}
+
+func TestKubeAdmCfgPatchError(t *testing.T) {
+	valid := "kind: ClusterConfiguration\napiVersion: kubeadm.k8s.io/v1beta2\nclusterName: p2\n"
+	tests := []struct {
+		name       string
+		clusterCfg *cluster.Config
+		patch      string
+	}{
+		{
+			name:       "malformed strategic merge patch",
+			clusterCfg: &cluster.Config{KubeadmConfigPatches: []string{valid, "kind: ["}},
+			patch:      "kubeadmConfigPatches[1]",
+		},
+		{
+			name: "JSON 6902 patch of a missing path",
+			clusterCfg: &cluster.Config{
+				KubeadmConfigPatches: []string{valid},
+				KubeadmConfigPatchesJSON6902: []kustomize.PatchJSON6902{
+					{Group: "kubeadm.k8s.io", Version: "v1beta2", Kind: "ClusterConfiguration", Patch: "- op: add\n  path: /clusterName\n  value: p3"},
+					{Group: "kubeadm.k8s.io", Version: "v1beta2", Kind: "InitConfiguration", Patch: "- op: replace\n  path: /missing/field\n  value: 1"},
+				},
+			},
+			patch: "kubeadmConfigPatchesJson6902[1] (InitConfiguration)",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := KubeAdmCfg(joinConfigData(true), tc.clusterCfg)
+			perr, ok := errors.Cause(err).(*PatchError)
+			if !ok {
+				t.Fatalf("KubeAdmCfg = %v, want a *PatchError", err)
+			}
+			if perr.Patch != tc.patch || perr.Err == nil {
+				t.Errorf("PatchError = %+v, want one of %s", perr, tc.patch)
+			}
+			if !strings.Contains(err.Error(), "failed to apply "+tc.patch) {
+				t.Errorf("error %q does not name %s", err, tc.patch)
+			}
+		})
+	}
+}
+
+func TestLoadConfigPatches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	path := write("config.yaml", `kind: Cluster
+kubeadmConfigPatches:
+- |
+  apiVersion: kubeadm.k8s.io/v1beta2
+  kind: ClusterConfiguration
+  apiServer:
+    extraArgs:
+      v: "4"
+kubeadmConfigPatchesJson6902:
+- group: kubeadm.k8s.io
+  version: v1beta2
+  kind: ClusterConfiguration
+  patch: |
+    - op: add
+      path: /controllerManager/extraArgs/v
+      value: "2"
+`)
+	clusterCfg, err := cluster.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	config, err := KubeAdmCfg(joinConfigData(true), clusterCfg)
+	if err != nil {
+		t.Fatalf("KubeAdmCfg: %v", err)
+	}
+	doc := configDoc(t, config, "ClusterConfiguration")
+	for _, s := range []string{`v: "4"`, `v: "2"`} {
+		if !strings.Contains(doc, s) {
+			t.Errorf("ClusterConfiguration does not contain %q:\n%s", s, doc)
+		}
+	}
+
+	// a misspelled field is an error rather than a patch silently ignored
+	path = write("misspelled.yaml", `kind: Cluster
+kubeadmConfigPatch:
+- |
+  kind: ClusterConfiguration
+`)
+	if _, err := cluster.LoadConfig(path); err == nil || !strings.Contains(err.Error(), "kubeadmConfigPatch") {
+		t.Errorf("LoadConfig of an unknown field = %v, want an error naming it", err)
+	}
+}
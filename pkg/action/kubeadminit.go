@@ -1,15 +1,57 @@
 package action
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"os/exec"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/medyagh/kic/pkg/command"
 )
 
+// initOpts are the options of RunKubeadmInit
+type initOpts struct {
+	UploadCerts bool
+}
+
+// InitOpt is an option of RunKubeadmInit
+type InitOpt func(*initOpts) *initOpts
+
+// UploadCerts uploads the control plane certificates to the cluster,
+// encrypted with the CertificateKey of the config, so more control planes
+// can join it. It needs kubernetes v1.15 or later.
+func UploadCerts() InitOpt {
+	return func(o *initOpts) *initOpts {
+		o.UploadCerts = true
+		return o
+	}
+}
+
+// NewCertificateKey returns a random key for ConfigData.CertificateKey
+func NewCertificateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", errors.Wrap(err, "failed to generate certificate key")
+	}
+	return hex.EncodeToString(key), nil
+}
+
 // RunKubeadmInit runs kubeadm init on a node
-func RunKubeadmInit(r command.Runner, kubeadmCfgPath, profile string) error { // run kubeadm
+func RunKubeadmInit(r command.Runner, kubeadmCfgPath, profile string, opts ...InitOpt) error {
+	return RunKubeadmInitContext(context.Background(), r, kubeadmCfgPath, profile, opts...)
+}
+
+// RunKubeadmInitContext is like RunKubeadmInit but kills kubeadm when ctx is done.
+// Killing the docker exec running kubeadm leaves kubeadm running in the node,
+// so it is killed with a best effort pkill, given killTimeout to complete.
+func RunKubeadmInitContext(ctx context.Context, r command.Runner, kubeadmCfgPath, profile string, opts ...InitOpt) error { // run kubeadm
+	o := &initOpts{}
+	for _, opt := range opts {
+		o = opt(o)
+	}
 	cmd := exec.Command(
 		// init because this is the control plane node
 		"kubeadm", "init",
@@ -20,17 +62,45 @@ func RunKubeadmInit(r command.Runner, kubeadmCfgPath, profile string) error { //
 		// increase verbosity for debugging
 		"--v=6",
 	)
-	_, err := r.RunCmd(cmd)
+	if o.UploadCerts {
+		cmd.Args = append(cmd.Args, "--upload-certs")
+	}
+	_, err := command.RunCmdContext(ctx, r, cmd)
 	if err != nil {
+		if ctx.Err() != nil {
+			killCancelled(r, "kubeadm init")
+		}
 		return errors.Wrap(err, "failed to init node with kubeadm")
 	}
 
 	return nil
 }
 
+// killTimeout bounds killing the command of a cancelled context in the node
+var killTimeout = 10 * time.Second
+
+// killCancelled kills the processes matching pattern on the node. Killing the
+// docker exec of a cancelled command does not kill the command in the node,
+// this is the only thing stopping it.
+func killCancelled(r command.Runner, pattern string) {
+	// ctx is done, the kill gets its own deadline so an unresponsive node
+	// does not hang the caller
+	ctx, cancel := context.WithTimeout(context.Background(), killTimeout)
+	defer cancel()
+	cmd := exec.Command("pkill", "-f", pattern)
+	// best effort, the process may already be gone
+	_, _ = command.RunCmdContext(ctx, r, cmd)
+}
+
 // RemoveMasterTaint removes the master node taint.
 // This allows pods to be scheduled on the master node.
 func RemoveMasterTaint(r command.Runner) error {
+	return RemoveMasterTaintContext(context.Background(), r)
+}
+
+// RemoveMasterTaintContext is like RemoveMasterTaint but gives up when ctx is done.
+// kubectl is retried while the api server is settling, see command.APIServerRetryPolicy
+func RemoveMasterTaintContext(ctx context.Context, r command.Runner) error {
 	// if we are only provisioning one node, remove the master taint
 	// https://kubernetes.io/docs/setup/independent/create-cluster-kubeadm/#master-isolation
 	cmd := exec.Command(
@@ -38,8 +108,17 @@ func RemoveMasterTaint(r command.Runner) error {
 		"taint", "nodes", "--all", "node-role.kubernetes.io/master-",
 	)
 
-	if _, err := r.RunCmd(cmd); err != nil {
+	if _, err := command.RunCmdContext(ctx, apiServerRunner(r), cmd); err != nil {
 		return errors.Wrap(err, "failed to remove master taint")
 	}
 	return nil
 }
+
+// apiServerRunner retries the kubectl commands of r that fail because the
+// api server is still settling, unless r retries commands already
+func apiServerRunner(r command.Runner) command.Runner {
+	if command.Retries(r) {
+		return r
+	}
+	return command.NewRetryRunner(r, command.APIServerRetryPolicy)
+}
@@ -0,0 +1,106 @@
+package action
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/medyagh/kic/pkg/command"
+	"github.com/medyagh/kic/pkg/command/fake"
+)
+
+// replayer returns a Runner replaying the transcript testdata/name
+func replayer(t *testing.T, name string) *command.Replayer {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	transcript, err := command.LoadTranscript(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return command.NewReplayer(transcript)
+}
+
+// TestKubeadmInitReplay replays the commands recorded while initializing the
+// control plane of a cluster of several control planes
+func TestKubeadmInitReplay(t *testing.T) {
+	ctx := context.Background()
+	r := replayer(t, "kubeadm-init.json")
+
+	if err := RunKubeadmInitContext(ctx, r, KubeAdmCfgPath, "p1", UploadCerts()); err != nil {
+		t.Fatalf("RunKubeadmInitContext: %v", err)
+	}
+	if err := RemoveMasterTaintContext(ctx, r); err != nil {
+		t.Fatalf("RemoveMasterTaintContext: %v", err)
+	}
+	manifest, err := GetDefaultCNIManifestContext(ctx, r, "10.244.0.0/16")
+	if err != nil {
+		t.Fatalf("GetDefaultCNIManifestContext: %v", err)
+	}
+	if err := ApplyCNIManifestContext(ctx, r, manifest); err != nil {
+		t.Fatalf("ApplyCNIManifestContext: %v", err)
+	}
+	if err := r.Done(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestKubeadmInitReplayCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := replayer(t, "kubeadm-init.json")
+	if err := RunKubeadmInitContext(ctx, r, KubeAdmCfgPath, "p1", UploadCerts()); err == nil {
+		t.Error("kubeadm init succeeded with a cancelled context")
+	}
+	if err := r.Done(); err == nil {
+		t.Error("a cancelled kubeadm init was replayed")
+	}
+}
+
+// hangingKillRunner never completes pkill, like an unresponsive node, until
+// the context of the kill is done
+type hangingKillRunner struct {
+	*fake.Runner
+}
+
+func (h hangingKillRunner) RunCmdContext(ctx context.Context, cmd *exec.Cmd) (*command.RunResult, error) {
+	if cmd.Args[0] == "pkill" {
+		<-ctx.Done()
+		return &command.RunResult{Args: cmd.Args, ExitCode: -1}, ctx.Err()
+	}
+	return h.Runner.RunCmdContext(ctx, cmd)
+}
+
+func TestKillCancelledTimeout(t *testing.T) {
+	defer func(d time.Duration) { killTimeout = d }(killTimeout)
+	killTimeout = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := fake.NewRunner()
+	r.On("kubeadm", "init", fake.AnyArgs).Do(func(*exec.Cmd) error {
+		cancel()
+		return ctx.Err()
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- RunKubeadmInitContext(ctx, hangingKillRunner{r}, KubeAdmCfgPath, "p1")
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("a cancelled kubeadm init succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("killing the cancelled kubeadm init hangs on an unresponsive node")
+	}
+	if !r.Called("kubeadm", "init", fake.AnyArgs) {
+		t.Errorf("kubeadm init did not run, calls: %v", r.Calls())
+	}
+}
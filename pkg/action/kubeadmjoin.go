@@ -0,0 +1,70 @@
+package action
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/medyagh/kic/pkg/cluster"
+	"github.com/medyagh/kic/pkg/command"
+)
+
+// RunKubeadmJoin joins a node to the cluster of cfg.ControlPlaneEndpoint. It
+// renders the kubeadm config of the node, with its cfg.NodeAddress, to
+// KubeAdmCfgPath on the node, with the patches of clusterCfg, and runs
+// kubeadm join with it.
+// The node joins as a control plane if cfg.ControlPlane is set, with the
+// certificates uploaded by kubeadm init with UploadCerts and cfg.CertificateKey.
+func RunKubeadmJoin(r command.Runner, cfg ConfigData, clusterCfg *cluster.Config) error {
+	return RunKubeadmJoinContext(context.Background(), r, cfg, clusterCfg)
+}
+
+// RunKubeadmJoinContext is like RunKubeadmJoin but kills kubeadm when ctx is done.
+// Like RunKubeadmInitContext, kubeadm keeps running in the node after its docker
+// exec is killed and is stopped with a best effort pkill.
+func RunKubeadmJoinContext(ctx context.Context, r command.Runner, cfg ConfigData, clusterCfg *cluster.Config) error {
+	if cfg.ControlPlaneEndpoint == "" {
+		return errors.New("failed to join node with kubeadm: no control plane endpoint")
+	}
+	if cfg.Token == "" {
+		cfg.Token = Token
+	}
+	kCfg, err := KubeAdmCfg(cfg, clusterCfg)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate kubeadm join config")
+	}
+	if err := writeFile(ctx, r, KubeAdmCfgPath, kCfg); err != nil {
+		return errors.Wrap(err, "failed to copy kubeadm join config to node")
+	}
+
+	cmd := exec.Command(
+		"kubeadm", "join",
+		// the node joins with the JoinConfiguration of the generated config file
+		"--config="+KubeAdmCfgPath,
+		"--ignore-preflight-errors=all",
+		// increase verbosity for debugging
+		"--v=6",
+	)
+	if _, err := command.RunCmdContext(ctx, r, cmd); err != nil {
+		if ctx.Err() != nil {
+			killCancelled(r, "kubeadm join")
+		}
+		return errors.Wrap(err, "failed to join node with kubeadm")
+	}
+	return nil
+}
+
+// writeFile writes content to dest on the node of r
+func writeFile(ctx context.Context, r command.Runner, dest, content string) error {
+	cmd := exec.Command("mkdir", "-p", filepath.Dir(dest))
+	if _, err := command.RunCmdContext(ctx, r, cmd); err != nil {
+		return err
+	}
+	cmd = exec.Command("cp", "/dev/stdin", dest)
+	cmd.Stdin = strings.NewReader(content)
+	_, err := command.RunCmdContext(ctx, r, cmd)
+	return err
+}
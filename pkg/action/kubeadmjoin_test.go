@@ -0,0 +1,161 @@
+package action
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/medyagh/kic/pkg/cluster"
+	"github.com/medyagh/kic/pkg/command/fake"
+)
+
+func joinConfigData(controlPlane bool) ConfigData {
+	return ConfigData{
+		ClusterName:          "p1",
+		KubernetesVersion:    "v1.16.3",
+		ControlPlaneEndpoint: "172.18.0.2:6443",
+		APIBindPort:          APIServerPort,
+		ControlPlane:         controlPlane,
+		NodeAddress:          "172.18.0.3",
+		CertificateKey:       "0123456789abcdef",
+		PodSubnet:            "10.244.0.0/16",
+		ServiceSubnet:        "10.96.0.0/12",
+	}
+}
+
+// joinRunner returns a Runner answering the commands of a kubeadm join
+func joinRunner() *fake.Runner {
+	r := fake.NewRunner()
+	r.On("mkdir", "-p", "/kic")
+	r.On("cp", "/dev/stdin", KubeAdmCfgPath)
+	r.On("kubeadm", "join", fake.AnyArgs)
+	return r
+}
+
+// writtenJoinConfig returns the JoinConfiguration of the kubeadm config
+// written by the join
+func writtenJoinConfig(t *testing.T, r *fake.Runner) string {
+	t.Helper()
+	for _, c := range r.Calls() {
+		if c.String() != "cp /dev/stdin "+KubeAdmCfgPath {
+			continue
+		}
+		for _, doc := range strings.Split(string(c.Stdin), "\n---\n") {
+			if strings.Contains(doc, "kind: JoinConfiguration") {
+				return doc
+			}
+		}
+		t.Fatalf("the kubeadm config has no JoinConfiguration:\n%s", c.Stdin)
+	}
+	t.Fatalf("the kubeadm config was not written, calls: %v", r.Calls())
+	return ""
+}
+
+func TestRunKubeadmJoin(t *testing.T) {
+	tests := []struct {
+		name         string
+		controlPlane bool
+		want         []string
+		notWant      []string
+	}{
+		{
+			name:    "worker",
+			want:    []string{"apiServerEndpoint: 172.18.0.2:6443", "node-ip: 172.18.0.3"},
+			notWant: []string{"controlPlane:", "certificateKey"},
+		},
+		{
+			name:         "control plane",
+			controlPlane: true,
+			want:         []string{"apiServerEndpoint: 172.18.0.2:6443", "controlPlane:", "certificateKey: 0123456789abcdef", "advertiseAddress: 172.18.0.3"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := joinRunner()
+			if err := RunKubeadmJoinContext(context.Background(), r, joinConfigData(tc.controlPlane), nil); err != nil {
+				t.Fatalf("RunKubeadmJoinContext: %v", err)
+			}
+			if !r.Called("kubeadm", "join", "--config="+KubeAdmCfgPath, "--ignore-preflight-errors=all", "--v=6") {
+				t.Errorf("kubeadm join was not run, calls: %v", r.Calls())
+			}
+			config := writtenJoinConfig(t, r)
+			for _, s := range tc.want {
+				if !strings.Contains(config, s) {
+					t.Errorf("config does not contain %q:\n%s", s, config)
+				}
+			}
+			for _, s := range tc.notWant {
+				if strings.Contains(config, s) {
+					t.Errorf("config contains %q:\n%s", s, config)
+				}
+			}
+		})
+	}
+}
+
+func TestRunKubeadmJoinPatches(t *testing.T) {
+	r := joinRunner()
+	clusterCfg := &cluster.Config{KubeadmConfigPatches: []string{`apiVersion: kubeadm.k8s.io/v1beta2
+kind: JoinConfiguration
+nodeRegistration:
+  kubeletExtraArgs:
+    node-labels: "ingress-ready=true"
+`}}
+	if err := RunKubeadmJoinContext(context.Background(), r, joinConfigData(false), clusterCfg); err != nil {
+		t.Fatalf("RunKubeadmJoinContext: %v", err)
+	}
+	if config := writtenJoinConfig(t, r); !strings.Contains(config, "node-labels: ingress-ready=true") {
+		t.Errorf("the patch was not applied:\n%s", config)
+	}
+
+	clusterCfg.KubeadmConfigPatches = append(clusterCfg.KubeadmConfigPatches, "kind: [")
+	err := RunKubeadmJoinContext(context.Background(), joinRunner(), joinConfigData(false), clusterCfg)
+	if perr, ok := errors.Cause(err).(*PatchError); !ok || perr.Patch != "kubeadmConfigPatches[1]" {
+		t.Errorf("RunKubeadmJoinContext = %v, want a PatchError of kubeadmConfigPatches[1]", err)
+	}
+}
+
+func TestRunKubeadmJoinErrors(t *testing.T) {
+	cfg := joinConfigData(false)
+	cfg.ControlPlaneEndpoint = ""
+	r := joinRunner()
+	if err := RunKubeadmJoinContext(context.Background(), r, cfg, nil); err == nil {
+		t.Error("joining without a control plane endpoint succeeded")
+	}
+	if len(r.Calls()) != 0 {
+		t.Errorf("commands were run without a control plane endpoint: %v", r.Calls())
+	}
+
+	r = fake.NewRunner()
+	r.On("mkdir", fake.AnyArgs)
+	r.On("cp", fake.AnyArgs)
+	r.On("kubeadm", "join", fake.AnyArgs).ExitCode(1).Stderr("error execution phase preflight")
+	if err := RunKubeadmJoinContext(context.Background(), r, joinConfigData(false), nil); err == nil {
+		t.Error("a failed kubeadm join succeeded")
+	}
+	if r.Called("pkill", fake.AnyArgs) {
+		t.Error("a failed kubeadm join was killed")
+	}
+}
+
+func TestRunKubeadmJoinCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := fake.NewRunner()
+	r.On("mkdir", fake.AnyArgs)
+	r.On("cp", fake.AnyArgs)
+	r.On("kubeadm", "join", fake.AnyArgs).Do(func(*exec.Cmd) error {
+		cancel()
+		return ctx.Err()
+	})
+	r.On("pkill", "-f", "kubeadm join")
+	if err := RunKubeadmJoinContext(ctx, r, joinConfigData(false), nil); err == nil {
+		t.Fatal("a cancelled kubeadm join succeeded")
+	}
+	if !r.Called("pkill", "-f", "kubeadm join") {
+		t.Errorf("the cancelled kubeadm join was not killed, calls: %v", r.Calls())
+	}
+}
@@ -0,0 +1,57 @@
+package action
+
+import (
+	"context"
+	"os/exec"
+
+	"github.com/pkg/errors"
+
+	"github.com/medyagh/kic/pkg/command"
+)
+
+// RunKubeadmReset reverts the kubeadm init or join of a node before it is
+// removed. The etcd member of a control plane is removed from the cluster, so
+// the remaining control planes keep their quorum.
+func RunKubeadmReset(r command.Runner) error {
+	return RunKubeadmResetContext(context.Background(), r)
+}
+
+// RunKubeadmResetContext is like RunKubeadmReset but kills kubeadm when ctx is done,
+// with a best effort pkill as for RunKubeadmInitContext
+func RunKubeadmResetContext(ctx context.Context, r command.Runner) error {
+	cmd := exec.Command(
+		"kubeadm", "reset",
+		// do not ask for a confirmation
+		"--force",
+		// increase verbosity for debugging
+		"--v=6",
+	)
+	if _, err := command.RunCmdContext(ctx, r, cmd); err != nil {
+		if ctx.Err() != nil {
+			killCancelled(r, "kubeadm reset")
+		}
+		return errors.Wrap(err, "failed to reset node with kubeadm")
+	}
+	return nil
+}
+
+// DeleteNode deletes the kubernetes node nodeName with the control plane of r,
+// which must not be the node being deleted
+func DeleteNode(r command.Runner, nodeName string) error {
+	return DeleteNodeContext(context.Background(), r, nodeName)
+}
+
+// DeleteNodeContext is like DeleteNode but gives up when ctx is done.
+// kubectl is retried while the api server is settling, see command.APIServerRetryPolicy
+func DeleteNodeContext(ctx context.Context, r command.Runner, nodeName string) error {
+	cmd := exec.Command(
+		"kubectl", "--kubeconfig=/etc/kubernetes/admin.conf",
+		"delete", "node", nodeName,
+		// deleting is retried, a node deleted by an earlier attempt is gone
+		"--ignore-not-found",
+	)
+	if _, err := command.RunCmdContext(ctx, apiServerRunner(r), cmd); err != nil {
+		return errors.Wrapf(err, "failed to delete node %s", nodeName)
+	}
+	return nil
+}
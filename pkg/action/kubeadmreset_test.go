@@ -0,0 +1,60 @@
+package action
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+
+	"github.com/medyagh/kic/pkg/command/fake"
+)
+
+func TestRunKubeadmReset(t *testing.T) {
+	r := fake.NewRunner()
+	r.On("kubeadm", "reset", fake.AnyArgs)
+	if err := RunKubeadmResetContext(context.Background(), r); err != nil {
+		t.Fatalf("RunKubeadmResetContext: %v", err)
+	}
+	if !r.Called("kubeadm", "reset", "--force", "--v=6") {
+		t.Errorf("kubeadm reset was not forced, calls: %v", r.Calls())
+	}
+
+	r = fake.NewRunner()
+	r.On("kubeadm", "reset", fake.AnyArgs).ExitCode(1).Stderr("failed to remove etcd member")
+	if err := RunKubeadmResetContext(context.Background(), r); err == nil {
+		t.Error("a failed kubeadm reset succeeded")
+	}
+}
+
+func TestRunKubeadmResetCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := fake.NewRunner()
+	r.On("kubeadm", "reset", fake.AnyArgs).Do(func(*exec.Cmd) error {
+		cancel()
+		return ctx.Err()
+	})
+	r.On("pkill", "-f", "kubeadm reset")
+	if err := RunKubeadmResetContext(ctx, r); err == nil {
+		t.Fatal("a cancelled kubeadm reset succeeded")
+	}
+	if !r.Called("pkill", "-f", "kubeadm reset") {
+		t.Errorf("the cancelled kubeadm reset was not killed, calls: %v", r.Calls())
+	}
+}
+
+func TestDeleteNode(t *testing.T) {
+	r := fake.NewRunner()
+	r.On("kubectl", fake.AnyArgs)
+	if err := DeleteNodeContext(context.Background(), r, "p1-control-plane2"); err != nil {
+		t.Fatalf("DeleteNodeContext: %v", err)
+	}
+	if !r.Called("kubectl", "--kubeconfig=/etc/kubernetes/admin.conf", "delete", "node", "p1-control-plane2", "--ignore-not-found") {
+		t.Errorf("the node was not deleted, calls: %v", r.Calls())
+	}
+
+	r = fake.NewRunner()
+	r.On("kubectl", fake.AnyArgs).ExitCode(1).Stderr(`nodes "p1-control-plane2" is forbidden`)
+	if err := DeleteNodeContext(context.Background(), r, "p1-control-plane2"); err == nil {
+		t.Error("a failed kubectl delete succeeded")
+	}
+}
@@ -3,6 +3,7 @@ package action
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -18,11 +19,16 @@ import (
 
 // rename generate based on /etc/...
 func GenerateKubeConfig(r command.Runner, hostIP string, hostPort int32, profile string) ([]byte, error) {
+	return GenerateKubeConfigContext(context.Background(), r, hostIP, hostPort, profile)
+}
+
+// GenerateKubeConfigContext is like GenerateKubeConfig but gives up when ctx is done
+func GenerateKubeConfigContext(ctx context.Context, r command.Runner, hostIP string, hostPort int32, profile string) ([]byte, error) {
 	cmd := exec.Command("cat", "/etc/kubernetes/admin.conf")
 	var buff bytes.Buffer
 	cmd.Stdout = &buff
 	cmd.Stderr = &buff
-	_, err := r.RunCmd(cmd)
+	_, err := command.RunCmdContext(ctx, r, cmd)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get kubeconfig from node")
 	}
@@ -0,0 +1,124 @@
+package action
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/medyagh/kic/pkg/command"
+	"github.com/medyagh/kic/pkg/node"
+)
+
+// LoadBalancerImage is the image of the external load balancer node
+const LoadBalancerImage = "kindest/haproxy:2.1.1-alpine"
+
+// LoadBalancerConfigPath is the path of the haproxy config in the load balancer node
+const LoadBalancerConfigPath = "/usr/local/etc/haproxy/haproxy.cfg"
+
+// LoadBalancerConfigData is supplied to the load balancer config template
+type LoadBalancerConfigData struct {
+	// ControlPlanePort is the port the load balancer listens on
+	ControlPlanePort int
+	// BackendServers are the api server addresses, as host:port, by node name
+	BackendServers map[string]string
+	IPv6           bool
+}
+
+// LoadBalancerConfigTemplate is the haproxy config of the load balancer
+const LoadBalancerConfigTemplate = `# config generated by kic
+global
+  log /dev/log local0
+  log /dev/log local1 notice
+  daemon
+
+resolvers docker
+  nameserver dns 127.0.0.11:53
+
+defaults
+  log global
+  mode tcp
+  option dontlognull
+  timeout connect 5000
+  timeout client 50000
+  timeout server 50000
+  # the backends are resolved when they are up, not at startup
+  default-server init-addr none
+
+frontend control-plane
+  bind *:{{ .ControlPlanePort }}
+  {{ if .IPv6 -}}
+  bind :::{{ .ControlPlanePort }}
+  {{- end }}
+  default_backend kube-apiservers
+
+backend kube-apiservers
+  option httpchk GET /healthz
+  # the api servers have self signed certificates
+  {{- range $server, $address := .BackendServers }}
+  server {{ $server }} {{ $address }} check check-ssl verify none resolvers docker resolve-prefer {{ if $.IPv6 -}} ipv6 {{- else -}} ipv4 {{- end }}
+  {{- end }}
+`
+
+// LoadBalancerCfg returns the haproxy config of the load balancer
+func LoadBalancerCfg(data LoadBalancerConfigData) (string, error) {
+	t, err := template.New("loadbalancer-config").Parse(LoadBalancerConfigTemplate)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse load balancer config template")
+	}
+	var buff bytes.Buffer
+	if err := t.Execute(&buff, data); err != nil {
+		return "", errors.Wrap(err, "error executing load balancer config template")
+	}
+	return buff.String(), nil
+}
+
+// UpdateLoadBalancer regenerates the backends of the load balancer node lb
+// from the control planes among nodes, and reloads it. It must run every
+// time a control plane is added to or removed from the cluster.
+func UpdateLoadBalancer(lb *node.Node, nodes []*node.Node) error {
+	return UpdateLoadBalancerContext(context.Background(), lb, nodes)
+}
+
+// UpdateLoadBalancerContext is like UpdateLoadBalancer but gives up when ctx is done
+func UpdateLoadBalancerContext(ctx context.Context, lb *node.Node, nodes []*node.Node) error {
+	data := LoadBalancerConfigData{
+		ControlPlanePort: APIServerPort,
+		BackendServers:   map[string]string{},
+	}
+	for _, n := range nodes {
+		if n.Role() != node.ControlPlaneRole {
+			continue
+		}
+		ipv4, ipv6, err := n.IPContext(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get the address of control plane %s", n.Name())
+		}
+		if ipv4 == "" && ipv6 == "" {
+			return errors.Errorf("control plane %s has no address", n.Name())
+		}
+		address := ipv4
+		if address == "" {
+			data.IPv6 = true
+			address = "[" + ipv6 + "]"
+		}
+		data.BackendServers[n.Name()] = fmt.Sprintf("%s:%d", address, APIServerPort)
+	}
+
+	cfg, err := LoadBalancerCfg(data)
+	if err != nil {
+		return err
+	}
+	if err := lb.WriteFileContext(ctx, LoadBalancerConfigPath, cfg, "644"); err != nil {
+		return errors.Wrap(err, "failed to copy load balancer config to node")
+	}
+	// haproxy reloads its config on SIGHUP
+	cmd := exec.Command("kill", "-s", "HUP", "1")
+	if _, err := command.RunCmdContext(ctx, lb.R, cmd); err != nil {
+		return errors.Wrap(err, "failed to reload load balancer")
+	}
+	return nil
+}
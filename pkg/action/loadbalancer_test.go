@@ -0,0 +1,83 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/medyagh/kic/pkg/command/fake"
+	"github.com/medyagh/kic/pkg/node"
+	"github.com/medyagh/kic/pkg/oci"
+	ocifake "github.com/medyagh/kic/pkg/oci/fake"
+)
+
+// createNode creates a node of the p1 profile on e, running its commands with r
+func createNode(t *testing.T, e oci.Engine, name, role string, r *fake.Runner) *node.Node {
+	t.Helper()
+	spec := node.Spec{Name: name, Profile: "p1", Role: role, Image: "kindest/node:v1.16.3"}
+	n, err := spec.CreateContext(context.Background(), e, r)
+	if err != nil {
+		t.Fatalf("creating node %s: %v", name, err)
+	}
+	return n
+}
+
+func TestUpdateLoadBalancer(t *testing.T) {
+	ctx := context.Background()
+	e := ocifake.NewEngine()
+	lbRunner := fake.NewRunner()
+	lbRunner.On("mkdir", "-p", "/usr/local/etc/haproxy")
+	lbRunner.On("cp", "/dev/stdin", LoadBalancerConfigPath)
+	lbRunner.On("chmod", "644", LoadBalancerConfigPath)
+	lbRunner.On("kill", "-s", "HUP", "1")
+	lb := createNode(t, e, "p1-lb", node.ExternalLoadBalancerRole, lbRunner)
+	nodes := []*node.Node{
+		createNode(t, e, "p1-control-plane", node.ControlPlaneRole, fake.NewRunner()),
+		createNode(t, e, "p1-control-plane2", node.ControlPlaneRole, fake.NewRunner()),
+		createNode(t, e, "p1-worker", node.WorkerRole, fake.NewRunner()),
+	}
+
+	if err := UpdateLoadBalancerContext(ctx, lb, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancerContext: %v", err)
+	}
+	var config string
+	for _, c := range lbRunner.Calls() {
+		if c.String() == "cp /dev/stdin "+LoadBalancerConfigPath {
+			config = string(c.Stdin)
+		}
+	}
+	for _, n := range nodes {
+		ipv4, _, err := n.IPContext(ctx)
+		if err != nil {
+			t.Fatalf("IP of %s: %v", n.Name(), err)
+		}
+		backend := fmt.Sprintf("server %s %s:%d ", n.Name(), ipv4, APIServerPort)
+		if want := n.Role() == node.ControlPlaneRole; strings.Contains(config, backend) != want {
+			t.Errorf("config has backend %q: %v, want %v:\n%s", backend, !want, want, config)
+		}
+	}
+	if !strings.Contains(config, fmt.Sprintf("bind *:%d", APIServerPort)) {
+		t.Errorf("config does not listen on the api server port:\n%s", config)
+	}
+	calls := lbRunner.Calls()
+	if last := calls[len(calls)-1].String(); last != "kill -s HUP 1" {
+		t.Errorf("last command = %q, want the load balancer to be reloaded after writing its config", last)
+	}
+}
+
+func TestUpdateLoadBalancerReloadError(t *testing.T) {
+	e := ocifake.NewEngine()
+	lbRunner := fake.NewRunner()
+	lbRunner.On("mkdir", fake.AnyArgs)
+	lbRunner.On("cp", fake.AnyArgs)
+	lbRunner.On("chmod", fake.AnyArgs)
+	lbRunner.On("kill", fake.AnyArgs).ExitCode(1).Stderr("kill: (1) - No such process")
+	lb := createNode(t, e, "p1-lb", node.ExternalLoadBalancerRole, lbRunner)
+	cp := createNode(t, e, "p1-control-plane", node.ControlPlaneRole, fake.NewRunner())
+
+	err := UpdateLoadBalancerContext(context.Background(), lb, []*node.Node{cp})
+	if err == nil || !strings.Contains(err.Error(), "failed to reload load balancer") {
+		t.Errorf("UpdateLoadBalancerContext = %v, want a reload error", err)
+	}
+}
@@ -310,6 +310,10 @@ metadata:
 # we use a well know token for TLS bootstrap
 bootstrapTokens:
 - token: "{{ .Token }}"
+{{ if .CertificateKey -}}
+# the key encrypting the control plane certificates uploaded for joining control planes
+certificateKey: "{{ .CertificateKey }}"
+{{ end -}}
 # we use a well know port for making the API server discoverable inside docker network. 
 # from the host machine such port will be accessible via a random local port instead.
 localAPIEndpoint:
@@ -331,6 +335,9 @@ controlPlane:
   localAPIEndpoint:
     advertiseAddress: "{{ .NodeAddress }}"
     bindPort: {{.APIBindPort}}
+  {{- if .CertificateKey }}
+  certificateKey: "{{ .CertificateKey }}"
+  {{- end }}
 {{- end }}
 nodeRegistration:
   criSocket: "/run/containerd/containerd.sock"
@@ -1,10 +1,14 @@
 package cluster
 
 import (
+	"io/ioutil"
+
 	"github.com/medyagh/kic/pkg/config/kustomize"
 	"github.com/medyagh/kic/pkg/node"
+	"github.com/pkg/errors"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
 )
 
 // Config contains cluster configuration
@@ -66,3 +70,17 @@ const (
 	// IPv6Family sets IPFamily to ipv6
 	IPv6Family IPFamily = "ipv6"
 )
+
+// LoadConfig reads a cluster config from a yaml or json file, unknown
+// fields are an error so misspelled patch fields are not silently ignored
+func LoadConfig(path string) (*Config, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading cluster config")
+	}
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(raw, cfg); err != nil {
+		return nil, errors.Wrapf(err, "decoding cluster config %s", path)
+	}
+	return cfg, nil
+}
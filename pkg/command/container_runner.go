@@ -0,0 +1,71 @@
+package command
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/medyagh/kic/pkg/oci"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// ContainerRunner runs commands in a container, for example a node
+type ContainerRunner struct {
+	engine   oci.Engine
+	nameOrID string
+	// User to run the commands as, the container's user by default
+	User string
+	// Privileged runs the commands with extended privileges, so they can remount etc..
+	Privileged bool
+	Logger     Logger
+}
+
+// NewContainerRunner returns a Runner running privileged commands in a container
+func NewContainerRunner(e oci.Engine, containerNameOrID string) *ContainerRunner {
+	return &ContainerRunner{
+		engine:     e,
+		nameOrID:   containerNameOrID,
+		Privileged: true,
+		Logger:     DefaultLogger,
+	}
+}
+
+// RunCmd runs cmd in the container. The environment and working directory of
+// cmd apply inside the container.
+func (c *ContainerRunner) RunCmd(cmd *exec.Cmd) (*RunResult, error) {
+	return c.RunCmdContext(context.Background(), cmd)
+}
+
+// RunCmdContext runs cmd in the container, killing it when ctx is done
+func (c *ContainerRunner) RunCmdContext(ctx context.Context, cmd *exec.Cmd) (*RunResult, error) {
+	rr := &RunResult{Args: cmd.Args}
+	opts := oci.ExecOptions{
+		Cmd:        cmd.Args,
+		Env:        cmd.Env,
+		WorkingDir: cmd.Dir,
+		User:       c.User,
+		Stdin:      cmd.Stdin,
+		Stdout:     tee(ctx, cmd.Stdout, &rr.Stdout),
+		Stderr:     tee(ctx, cmd.Stderr, &rr.Stderr),
+		// if the command is hooked up to the processes's output we want a tty
+		TTY:        isTerminal(cmd.Stdout) || isTerminal(cmd.Stderr),
+		Privileged: c.Privileged,
+	}
+	start := time.Now()
+	code, err := c.engine.Exec(ctx, c.nameOrID, opts)
+	if code > 0 {
+		// the engine's error only repeats the exit code
+		err = nil
+	}
+	return rr, finish(logger(c.Logger), "ContainerRunner", rr, code, err, time.Since(start))
+}
+
+// isTerminal returns true if the writer w is a terminal
+func isTerminal(w io.Writer) bool {
+	if v, ok := (w).(*os.File); ok {
+		return terminal.IsTerminal(int(v.Fd()))
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package command
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// slowCommand is how long a command runs before it is worth logging
+const slowCommand = time.Second
+
+// ExecRunner runs commands on the host
+type ExecRunner struct {
+	Logger Logger
+}
+
+// NewExecRunner returns a Runner running commands on the host
+func NewExecRunner() *ExecRunner {
+	return &ExecRunner{Logger: DefaultLogger}
+}
+
+// RunCmd runs cmd on the host
+func (e *ExecRunner) RunCmd(cmd *exec.Cmd) (*RunResult, error) {
+	return e.RunCmdContext(context.Background(), cmd)
+}
+
+// RunCmdContext runs cmd on the host, killing it when ctx is done
+func (e *ExecRunner) RunCmdContext(ctx context.Context, cmd *exec.Cmd) (*RunResult, error) {
+	rr := &RunResult{Args: cmd.Args}
+	cmd2 := exec.CommandContext(ctx, cmd.Args[0], cmd.Args[1:]...)
+	cmd2.Path = cmd.Path
+	cmd2.Env = cmd.Env
+	cmd2.Dir = cmd.Dir
+	cmd2.Stdin = cmd.Stdin
+	cmd2.Stdout = tee(ctx, cmd.Stdout, &rr.Stdout)
+	cmd2.Stderr = tee(ctx, cmd.Stderr, &rr.Stderr)
+
+	start := time.Now()
+	err := cmd2.Run()
+	return rr, finish(logger(e.Logger), "ExecRunner", rr, cmdExitCode(err), err, time.Since(start))
+}
+
+// cmdExitCode returns the exit code of a finished command, -1 if it didn't run
+func cmdExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitError, ok := err.(*exec.ExitError); ok {
+		return exitError.ExitCode()
+	}
+	return -1
+}
+
+// finish records the exit code of a command, logs it and returns its error
+func finish(l Logger, name string, rr *RunResult, code int, err error, elapsed time.Duration) error {
+	rr.ExitCode = code
+	if err == nil && code == 0 {
+		// Reduce log spam
+		if elapsed > slowCommand {
+			l.Infof("(%s) Done: %v: (%s)", name, rr.Args, elapsed)
+		}
+		return nil
+	}
+	if err == nil {
+		err = errors.Errorf("exit status %d", code)
+	}
+	l.Warningf("(%s) Non-zero exit: %v: %v (%s)\n%s", name, rr.Args, err, elapsed, rr.Output())
+	return errors.Wrapf(err, "command failed: %s", rr.Args)
+}
+
+// tee writes to w, if set, and to the buffer of a RunResult unless ctx is Unbuffered
+func tee(ctx context.Context, w io.Writer, buf io.Writer) io.Writer {
+	if isUnbuffered(ctx) {
+		if w == nil {
+			return ioutil.Discard
+		}
+		return w
+	}
+	if w == nil {
+		return buf
+	}
+	return io.MultiWriter(w, buf)
+}
+
+func logger(l Logger) Logger {
+	if l == nil {
+		return NopLogger
+	}
+	return l
+}
@@ -0,0 +1,114 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingLogger keeps the lines logged by a runner
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) Infof(format string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Warningf(format string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func TestExecRunner(t *testing.T) {
+	r := NewExecRunner()
+	r.Logger = NopLogger
+
+	var stdout bytes.Buffer
+	cmd := exec.Command("sh", "-c", "cat; echo \"$KIC_TEST\"; pwd; echo err >&2")
+	cmd.Stdin = strings.NewReader("in\n")
+	cmd.Env = []string{"KIC_TEST=env"}
+	cmd.Dir = "/"
+	cmd.Stdout = &stdout
+	rr, err := r.RunCmdContext(context.Background(), cmd)
+	if err != nil {
+		t.Fatalf("RunCmdContext: %v", err)
+	}
+	if rr.Stdout.String() != "in\nenv\n/\n" || rr.Stderr.String() != "err\n" {
+		t.Errorf("output = %q %q, want the stdin, env and dir of the command", rr.Stdout.String(), rr.Stderr.String())
+	}
+	if stdout.String() != rr.Stdout.String() {
+		t.Errorf("cmd.Stdout = %q, want the output to be written there too", stdout.String())
+	}
+	if rr.ExitCode != 0 {
+		t.Errorf("exit code = %d, want 0", rr.ExitCode)
+	}
+}
+
+func TestExecRunnerExitCode(t *testing.T) {
+	l := &recordingLogger{}
+	r := &ExecRunner{Logger: l}
+	rr, err := r.RunCmd(exec.Command("sh", "-c", "echo failed >&2; exit 3"))
+	if err == nil {
+		t.Fatal("a failing command succeeded")
+	}
+	if rr.ExitCode != 3 {
+		t.Errorf("exit code = %d, want 3", rr.ExitCode)
+	}
+	if len(l.lines) != 1 || !strings.Contains(l.lines[0], "Non-zero exit") || !strings.Contains(l.lines[0], "failed") {
+		t.Errorf("logged %q, want the failure with its stderr", l.lines)
+	}
+
+	rr, err = r.RunCmd(exec.Command("kic-no-such-binary"))
+	if err == nil || rr.ExitCode != -1 {
+		t.Errorf("running a missing binary = %d %v, want exit code -1 and an error", rr.ExitCode, err)
+	}
+}
+
+func TestExecRunnerCancel(t *testing.T) {
+	r := NewExecRunner()
+	r.Logger = NopLogger
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := r.RunCmdContext(ctx, exec.Command("sleep", "10")); err == nil {
+		t.Fatal("a cancelled command succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the command ran for %s after its context was done", elapsed)
+	}
+}
+
+func TestExecRunnerUnbuffered(t *testing.T) {
+	r := NewExecRunner()
+	r.Logger = NopLogger
+	var stdout bytes.Buffer
+	cmd := exec.Command("sh", "-c", "echo out; echo err >&2")
+	cmd.Stdout = &stdout
+	rr, err := r.RunCmdContext(Unbuffered(context.Background()), cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr.Stdout.Len() != 0 || rr.Stderr.Len() != 0 || stdout.String() != "out\n" {
+		t.Errorf("unbuffered output = %q %q, written %q, want the output written only", rr.Stdout.String(), rr.Stderr.String(), stdout.String())
+	}
+}
+
+func TestRetryRunnerUnbuffered(t *testing.T) {
+	er := NewExecRunner()
+	er.Logger = NopLogger
+	r := Chain(er, Retry(RetryPolicy{InitialInterval: time.Millisecond, MaxAttempts: 3}), Timeout(time.Minute))
+
+	var stdout bytes.Buffer
+	cmd := exec.Command("sh", "-c", "echo line; exit 1")
+	cmd.Stdout = &stdout
+	if _, err := r.RunCmdContext(Unbuffered(context.Background()), cmd); err == nil {
+		t.Fatal("a failing command succeeded")
+	}
+	if stdout.String() != "line\n" {
+		t.Errorf("output = %q, want the command to run once and stream its output", stdout.String())
+	}
+}
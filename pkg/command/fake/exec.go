@@ -0,0 +1,35 @@
+package fake
+
+import (
+	"context"
+	"os/exec"
+
+	"github.com/medyagh/kic/pkg/command"
+	"github.com/medyagh/kic/pkg/oci"
+	ocifake "github.com/medyagh/kic/pkg/oci/fake"
+	"github.com/pkg/errors"
+)
+
+// ExecWith returns an ExecHandler of a fake oci engine running the commands
+// with r, for example a Runner scripting the commands run in the nodes
+func ExecWith(r command.Runner) ocifake.ExecFunc {
+	return func(ctx context.Context, container string, opts oci.ExecOptions) (int, error) {
+		if len(opts.Cmd) == 0 {
+			return -1, errors.New("no command to exec")
+		}
+		cmd := exec.Command(opts.Cmd[0], opts.Cmd[1:]...)
+		cmd.Env = opts.Env
+		cmd.Dir = opts.WorkingDir
+		cmd.Stdin = opts.Stdin
+		cmd.Stdout = opts.Stdout
+		cmd.Stderr = opts.Stderr
+		rr, err := command.RunCmdContext(ctx, r, cmd)
+		if rr != nil && rr.ExitCode > 0 {
+			return rr.ExitCode, nil
+		}
+		if err != nil {
+			return -1, err
+		}
+		return 0, nil
+	}
+}
@@ -0,0 +1,221 @@
+// Package fake provides a scriptable command.Runner for unit tests
+package fake
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/medyagh/kic/pkg/command"
+	"github.com/pkg/errors"
+)
+
+// AnyArgs matches the remaining arguments of a command, whatever they are
+const AnyArgs = "**"
+
+// Call is a command run by a Runner
+type Call struct {
+	Args  []string
+	Env   []string
+	Dir   string
+	Stdin []byte
+}
+
+// String returns the command line of the call
+func (c Call) String() string {
+	return strings.Join(c.Args, " ")
+}
+
+// Response is what a Runner answers to the commands matching a pattern
+type Response struct {
+	pattern  []string
+	stdout   string
+	stderr   string
+	exitCode int
+	err      error
+	times    int // 0 for unlimited
+	calls    int
+	do       func(cmd *exec.Cmd) error
+}
+
+// Stdout sets the output of the command
+func (r *Response) Stdout(s string) *Response {
+	r.stdout = s
+	return r
+}
+
+// Stderr sets the error output of the command
+func (r *Response) Stderr(s string) *Response {
+	r.stderr = s
+	return r
+}
+
+// ExitCode sets the exit code of the command, a non-zero code fails it
+func (r *Response) ExitCode(code int) *Response {
+	r.exitCode = code
+	return r
+}
+
+// Error makes the command fail to run with err, like a missing binary
+func (r *Response) Error(err error) *Response {
+	r.err = err
+	return r
+}
+
+// Times limits how many commands the response answers, after which the
+// next matching response is used
+func (r *Response) Times(n int) *Response {
+	r.times = n
+	return r
+}
+
+// Do calls f with the command, for example to consume its stdin, and fails
+// the command if f returns an error
+func (r *Response) Do(f func(cmd *exec.Cmd) error) *Response {
+	r.do = f
+	return r
+}
+
+// matches tells if args match the pattern, every element of which is a
+// path.Match pattern for the argument at the same position
+func (r *Response) matches(args []string) bool {
+	for i, p := range r.pattern {
+		if p == AnyArgs {
+			return true
+		}
+		if i >= len(args) {
+			return false
+		}
+		if ok, err := path.Match(p, args[i]); err != nil || !ok {
+			return false
+		}
+	}
+	return len(args) == len(r.pattern)
+}
+
+// Runner is a command.Runner answering commands with scripted responses
+// and recording them. Commands no response matches fail.
+type Runner struct {
+	mu        sync.Mutex
+	responses []*Response
+	calls     []Call
+}
+
+// NewRunner returns a Runner without responses
+func NewRunner() *Runner {
+	return &Runner{}
+}
+
+// On adds a response to the commands matching pattern. Every element of the
+// pattern is a path.Match pattern for the argument at the same position, and
+// AnyArgs matches all the remaining arguments. Responses are tried in the
+// order they were added, for example:
+//
+//	r.On("kubeadm", "init", fake.AnyArgs).Stdout("done")
+//	r.On("systemctl", "is-active", "*").ExitCode(3)
+func (r *Runner) On(pattern ...string) *Response {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	resp := &Response{pattern: pattern}
+	r.responses = append(r.responses, resp)
+	return resp
+}
+
+// Calls returns the commands run so far
+func (r *Runner) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// Called tells if a command matching pattern was run, see On for the patterns
+func (r *Runner) Called(pattern ...string) bool {
+	match := &Response{pattern: pattern}
+	for _, c := range r.Calls() {
+		if match.matches(c.Args) {
+			return true
+		}
+	}
+	return false
+}
+
+// RunCmd answers cmd with the first matching response
+func (r *Runner) RunCmd(cmd *exec.Cmd) (*command.RunResult, error) {
+	return r.RunCmdContext(context.Background(), cmd)
+}
+
+// RunCmdContext answers cmd with the first matching response, failing if ctx is done
+func (r *Runner) RunCmdContext(ctx context.Context, cmd *exec.Cmd) (*command.RunResult, error) {
+	rr := &command.RunResult{Args: cmd.Args}
+	call := Call{Args: cmd.Args, Env: cmd.Env, Dir: cmd.Dir}
+	if cmd.Stdin != nil {
+		stdin, err := ioutil.ReadAll(cmd.Stdin)
+		if err != nil {
+			return rr, errors.Wrap(err, "reading stdin")
+		}
+		call.Stdin = stdin
+		// let Do handlers read stdin again
+		cmd.Stdin = strings.NewReader(string(stdin))
+	}
+
+	r.mu.Lock()
+	r.calls = append(r.calls, call)
+	resp := r.match(cmd.Args)
+	r.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		rr.ExitCode = -1
+		return rr, err
+	}
+	if resp == nil {
+		rr.ExitCode = -1
+		return rr, fmt.Errorf("fake runner: unexpected command: %s", call)
+	}
+	if resp.err != nil {
+		rr.ExitCode = -1
+		return rr, errors.Wrapf(resp.err, "command failed: %s", cmd.Args)
+	}
+	if resp.do != nil {
+		if err := resp.do(cmd); err != nil {
+			rr.ExitCode = -1
+			return rr, errors.Wrapf(err, "command failed: %s", cmd.Args)
+		}
+	}
+
+	rr.Stdout.WriteString(resp.stdout)
+	rr.Stderr.WriteString(resp.stderr)
+	if cmd.Stdout != nil {
+		if _, err := io.WriteString(cmd.Stdout, resp.stdout); err != nil {
+			return rr, err
+		}
+	}
+	if cmd.Stderr != nil {
+		if _, err := io.WriteString(cmd.Stderr, resp.stderr); err != nil {
+			return rr, err
+		}
+	}
+	rr.ExitCode = resp.exitCode
+	if resp.exitCode != 0 {
+		return rr, errors.Errorf("command failed: %s: exit status %d", cmd.Args, resp.exitCode)
+	}
+	return rr, nil
+}
+
+// match returns the first response matching args that is not used up
+func (r *Runner) match(args []string) *Response {
+	for _, resp := range r.responses {
+		if resp.times > 0 && resp.calls >= resp.times {
+			continue
+		}
+		if resp.matches(args) {
+			resp.calls++
+			return resp
+		}
+	}
+	return nil
+}
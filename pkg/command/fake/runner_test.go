@@ -0,0 +1,125 @@
+package fake
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestRunnerPatterns(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern []string
+		args    []string
+		want    bool
+	}{
+		{"exact", []string{"kubectl", "get", "nodes"}, []string{"kubectl", "get", "nodes"}, true},
+		{"exact mismatch", []string{"kubectl", "get", "nodes"}, []string{"kubectl", "get", "pods"}, false},
+		{"more args", []string{"kubectl", "get"}, []string{"kubectl", "get", "nodes"}, false},
+		{"less args", []string{"kubectl", "get", "nodes"}, []string{"kubectl", "get"}, false},
+		{"glob", []string{"kubeadm", "init", "--v=*"}, []string{"kubeadm", "init", "--v=6"}, true},
+		{"glob mismatch", []string{"kubeadm", "init", "--v=*"}, []string{"kubeadm", "init", "--config=kubeadm.conf"}, false},
+		{"glob path", []string{"kubectl", "--kubeconfig=/etc/kubernetes/*"}, []string{"kubectl", "--kubeconfig=/etc/kubernetes/admin.conf"}, true},
+		{"glob crossing slashes", []string{"kubectl", "--kubeconfig=*"}, []string{"kubectl", "--kubeconfig=/etc/kubernetes/admin.conf"}, false},
+		{"any args", []string{"kubeadm", "init", AnyArgs}, []string{"kubeadm", "init", "--config=/kind/kubeadm.conf", "--v=6"}, true},
+		{"any args none", []string{"kubeadm", "init", AnyArgs}, []string{"kubeadm", "init"}, true},
+		{"any args prefix mismatch", []string{"kubeadm", "join", AnyArgs}, []string{"kubeadm", "init", "--v=6"}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRunner()
+			r.On(tc.pattern...).Stdout("ok")
+			rr, err := r.RunCmd(exec.Command(tc.args[0], tc.args[1:]...))
+			if got := err == nil; got != tc.want {
+				t.Fatalf("matched = %v, want %v (err: %v)", got, tc.want, err)
+			}
+			if tc.want && rr.Stdout.String() != "ok" {
+				t.Errorf("stdout = %q, want %q", rr.Stdout.String(), "ok")
+			}
+		})
+	}
+}
+
+func TestRunnerResponses(t *testing.T) {
+	r := NewRunner()
+	r.On("systemctl", "is-active", "kubelet").ExitCode(3).Stderr("inactive").Times(1)
+	r.On("systemctl", "is-active", "kubelet").Stdout("active")
+	r.On("crictl", AnyArgs).Error(errors.New("executable file not found"))
+
+	rr, err := r.RunCmd(exec.Command("systemctl", "is-active", "kubelet"))
+	if err == nil || rr.ExitCode != 3 || rr.Stderr.String() != "inactive" {
+		t.Errorf("first call = %d %q %v, want exit code 3 and stderr", rr.ExitCode, rr.Stderr.String(), err)
+	}
+	rr, err = r.RunCmd(exec.Command("systemctl", "is-active", "kubelet"))
+	if err != nil || rr.ExitCode != 0 || rr.Stdout.String() != "active" {
+		t.Errorf("second call = %d %q %v, want the next response", rr.ExitCode, rr.Stdout.String(), err)
+	}
+	if rr, err = r.RunCmd(exec.Command("crictl", "ps")); err == nil || rr.ExitCode != -1 {
+		t.Errorf("crictl = %d %v, want it to fail to run", rr.ExitCode, err)
+	}
+	if _, err = r.RunCmd(exec.Command("kubectl", "version")); err == nil || !strings.Contains(err.Error(), "unexpected command: kubectl version") {
+		t.Errorf("unexpected command error = %v", err)
+	}
+}
+
+func TestRunnerCalls(t *testing.T) {
+	r := NewRunner()
+	var consumed string
+	r.On("tee", AnyArgs).Do(func(cmd *exec.Cmd) error {
+		var b bytes.Buffer
+		_, err := b.ReadFrom(cmd.Stdin)
+		consumed = b.String()
+		return err
+	})
+	r.On("kubectl", AnyArgs)
+
+	cmd := exec.Command("tee", "/kind/kubeadm.conf")
+	cmd.Stdin = strings.NewReader("kind: ClusterConfiguration\n")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if _, err := r.RunCmd(cmd); err != nil {
+		t.Fatalf("tee: %v", err)
+	}
+	cmd = exec.Command("kubectl", "get", "nodes")
+	cmd.Env = []string{"KUBECONFIG=/etc/kubernetes/admin.conf"}
+	cmd.Dir = "/kind"
+	if _, err := r.RunCmd(cmd); err != nil {
+		t.Fatalf("kubectl: %v", err)
+	}
+
+	want := []Call{
+		{Args: []string{"tee", "/kind/kubeadm.conf"}, Stdin: []byte("kind: ClusterConfiguration\n")},
+		{Args: []string{"kubectl", "get", "nodes"}, Env: []string{"KUBECONFIG=/etc/kubernetes/admin.conf"}, Dir: "/kind"},
+	}
+	if got := r.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Calls() = %+v, want %+v", got, want)
+	}
+	if consumed != "kind: ClusterConfiguration\n" {
+		t.Errorf("Do read stdin %q", consumed)
+	}
+	if !r.Called("kubectl", "get", "*") {
+		t.Error("Called(kubectl get *) = false")
+	}
+	if r.Called("kubectl", "delete", AnyArgs) {
+		t.Error("Called(kubectl delete **) = true")
+	}
+}
+
+func TestRunnerContext(t *testing.T) {
+	r := NewRunner()
+	r.On(AnyArgs)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rr, err := r.RunCmdContext(ctx, exec.Command("sleep", "1"))
+	if err != context.Canceled || rr.ExitCode != -1 {
+		t.Errorf("RunCmdContext = %d %v, want %v", rr.ExitCode, err, context.Canceled)
+	}
+	if len(r.Calls()) != 1 {
+		t.Errorf("cancelled command was not recorded")
+	}
+}
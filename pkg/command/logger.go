@@ -0,0 +1,32 @@
+package command
+
+import (
+	"k8s.io/klog"
+)
+
+// Logger is where runners report the commands they run
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Warningf(format string, args ...interface{})
+}
+
+// DefaultLogger logs with klog
+var DefaultLogger Logger = klogLogger{}
+
+type klogLogger struct{}
+
+func (klogLogger) Infof(format string, args ...interface{}) {
+	klog.Infof(format, args...)
+}
+
+func (klogLogger) Warningf(format string, args ...interface{}) {
+	klog.Warningf(format, args...)
+}
+
+// NopLogger discards everything
+var NopLogger Logger = nopLogger{}
+
+type nopLogger struct{}
+
+func (nopLogger) Infof(format string, args ...interface{})    {}
+func (nopLogger) Warningf(format string, args ...interface{}) {}
@@ -0,0 +1,78 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// LoggingRunner logs every command it runs as key=value fields: the
+// command, its exit code, how long it ran, the size of its output and its
+// error, if any. Failures are logged as warnings.
+type LoggingRunner struct {
+	Runner Runner
+	Logger Logger
+	// Name is logged as the runner field, eg the node the commands run in
+	Name string
+}
+
+// NewLoggingRunner returns a LoggingRunner logging the commands of r with l
+func NewLoggingRunner(r Runner, l Logger, name string) *LoggingRunner {
+	return &LoggingRunner{Runner: r, Logger: l, Name: name}
+}
+
+// Logging is a Middleware logging commands with l
+func Logging(l Logger, name string) Middleware {
+	return func(r Runner) ContextRunner {
+		return NewLoggingRunner(r, l, name)
+	}
+}
+
+// RunCmd runs cmd and logs it
+func (l *LoggingRunner) RunCmd(cmd *exec.Cmd) (*RunResult, error) {
+	return l.RunCmdContext(context.Background(), cmd)
+}
+
+// RunCmdContext runs cmd, killing it when ctx is done, and logs it
+func (l *LoggingRunner) RunCmdContext(ctx context.Context, cmd *exec.Cmd) (*RunResult, error) {
+	start := time.Now()
+	rr, err := RunCmdContext(ctx, l.Runner, cmd)
+	fields := []interface{}{
+		"runner", l.Name,
+		"cmd", strings.Join(cmd.Args, " "),
+		"duration", time.Since(start).Round(time.Millisecond),
+	}
+	if rr != nil {
+		fields = append(fields,
+			"exit_code", rr.ExitCode,
+			"stdout_bytes", rr.Stdout.Len(),
+			"stderr_bytes", rr.Stderr.Len(),
+		)
+	}
+	if err != nil {
+		fields = append(fields, "error", err)
+		logger(l.Logger).Warningf("command failed %s", keyValues(fields))
+		return rr, err
+	}
+	logger(l.Logger).Infof("command done %s", keyValues(fields))
+	return rr, nil
+}
+
+// keyValues formats alternating keys and values as key=value pairs,
+// quoting the values that contain spaces
+func keyValues(fields []interface{}) string {
+	var sb strings.Builder
+	for i := 0; i+1 < len(fields); i += 2 {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		v := fmt.Sprint(fields[i+1])
+		if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+			v = fmt.Sprintf("%q", v)
+		}
+		fmt.Fprintf(&sb, "%s=%s", fields[i], v)
+	}
+	return sb.String()
+}
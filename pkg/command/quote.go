@@ -0,0 +1,17 @@
+package command
+
+import (
+	"regexp"
+	"strings"
+)
+
+// safeShellArg matches the arguments that don't need quoting
+var safeShellArg = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// ShellQuote quotes s for a POSIX shell, leaving it as is when it is safe
+func ShellQuote(s string) string {
+	if safeShellArg.MatchString(s) {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'"'"'`, -1) + "'"
+}
@@ -0,0 +1,188 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Transcript is the record of the commands run by a Recorder
+type Transcript struct {
+	Commands []RecordedCommand `json:"commands"`
+}
+
+// RecordedCommand is a command recorded in a Transcript
+type RecordedCommand struct {
+	Args []string `json:"args"`
+	// StdinDigest is the sha256 of the stdin of the command, if it had one
+	StdinDigest string        `json:"stdinDigest,omitempty"`
+	Stdout      string        `json:"stdout"`
+	Stderr      string        `json:"stderr"`
+	ExitCode    int           `json:"exitCode"`
+	Error       string        `json:"error,omitempty"`
+	Duration    time.Duration `json:"duration"`
+}
+
+// LoadTranscript decodes a transcript written by Recorder.Save
+func LoadTranscript(r io.Reader) (*Transcript, error) {
+	var t Transcript
+	if err := json.NewDecoder(r).Decode(&t); err != nil {
+		return nil, errors.Wrap(err, "decoding transcript")
+	}
+	return &t, nil
+}
+
+// Recorder is a Runner recording the commands run by another Runner
+type Recorder struct {
+	r  Runner
+	mu sync.Mutex
+	t  Transcript
+}
+
+// NewRecorder returns a Runner recording the commands run by r
+func NewRecorder(r Runner) *Recorder {
+	return &Recorder{r: r}
+}
+
+// RunCmd runs cmd with the recorded Runner and records it
+func (rec *Recorder) RunCmd(cmd *exec.Cmd) (*RunResult, error) {
+	return rec.RunCmdContext(context.Background(), cmd)
+}
+
+// RunCmdContext runs cmd with the recorded Runner and records it
+func (rec *Recorder) RunCmdContext(ctx context.Context, cmd *exec.Cmd) (*RunResult, error) {
+	c := RecordedCommand{Args: cmd.Args}
+	var stdin hash.Hash
+	if cmd.Stdin != nil {
+		// hash stdin while the command consumes it
+		stdin = sha256.New()
+		cmd.Stdin = io.TeeReader(cmd.Stdin, stdin)
+	}
+
+	start := time.Now()
+	rr, err := RunCmdContext(ctx, rec.r, cmd)
+	c.Duration = time.Since(start)
+	if rr != nil {
+		c.Stdout, c.Stderr, c.ExitCode = rr.Stdout.String(), rr.Stderr.String(), rr.ExitCode
+	}
+	if err != nil {
+		c.Error = err.Error()
+	}
+	if stdin != nil {
+		c.StdinDigest = fmt.Sprintf("sha256:%x", stdin.Sum(nil))
+	}
+	rec.mu.Lock()
+	rec.t.Commands = append(rec.t.Commands, c)
+	rec.mu.Unlock()
+	return rr, err
+}
+
+// Transcript returns the commands recorded so far
+func (rec *Recorder) Transcript() *Transcript {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return &Transcript{Commands: append([]RecordedCommand(nil), rec.t.Commands...)}
+}
+
+// Save writes the transcript as json to w
+func (rec *Recorder) Save(w io.Writer) error {
+	b, err := json.MarshalIndent(rec.Transcript(), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// Replayer is a Runner serving the results of the commands of a Transcript
+// without running them. Commands must be run in the order of the transcript,
+// with the same arguments and stdin, any divergence fails the command.
+type Replayer struct {
+	mu   sync.Mutex
+	t    *Transcript
+	next int
+}
+
+// NewReplayer returns a Runner replaying t
+func NewReplayer(t *Transcript) *Replayer {
+	return &Replayer{t: t}
+}
+
+// RunCmd serves the result of the next command of the transcript
+func (rp *Replayer) RunCmd(cmd *exec.Cmd) (*RunResult, error) {
+	return rp.RunCmdContext(context.Background(), cmd)
+}
+
+// RunCmdContext serves the result of the next command of the transcript,
+// unless ctx is done, like a runner killing the command would
+func (rp *Replayer) RunCmdContext(ctx context.Context, cmd *exec.Cmd) (*RunResult, error) {
+	rr := &RunResult{Args: cmd.Args}
+	if err := ctx.Err(); err != nil {
+		rr.ExitCode = -1
+		return rr, err
+	}
+	digest := ""
+	if cmd.Stdin != nil {
+		stdin, err := ioutil.ReadAll(cmd.Stdin)
+		if err != nil {
+			return rr, errors.Wrap(err, "reading stdin")
+		}
+		digest = fmt.Sprintf("sha256:%x", sha256.Sum256(stdin))
+	}
+
+	rp.mu.Lock()
+	if rp.next >= len(rp.t.Commands) {
+		rp.mu.Unlock()
+		return rr, errors.Errorf("replay: unexpected command %d %v, the transcript has %d commands", rp.next+1, cmd.Args, len(rp.t.Commands))
+	}
+	c := rp.t.Commands[rp.next]
+	rp.next++
+	n := rp.next
+	rp.mu.Unlock()
+
+	if strings.Join(c.Args, "\x00") != strings.Join(cmd.Args, "\x00") {
+		return rr, errors.Errorf("replay: command %d is %v, expected %v", n, cmd.Args, c.Args)
+	}
+	if c.StdinDigest != digest {
+		return rr, errors.Errorf("replay: command %d %v has a different stdin", n, cmd.Args)
+	}
+
+	rr.Stdout.WriteString(c.Stdout)
+	rr.Stderr.WriteString(c.Stderr)
+	rr.ExitCode = c.ExitCode
+	for _, out := range []struct {
+		w io.Writer
+		s string
+	}{{cmd.Stdout, c.Stdout}, {cmd.Stderr, c.Stderr}} {
+		if out.w != nil {
+			if _, err := io.Copy(out.w, bytes.NewBufferString(out.s)); err != nil {
+				return rr, err
+			}
+		}
+	}
+	if c.Error != "" {
+		return rr, errors.New(c.Error)
+	}
+	return rr, nil
+}
+
+// Done checks that all the commands of the transcript were replayed
+func (rp *Replayer) Done() error {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	if rp.next < len(rp.t.Commands) {
+		return errors.Errorf("replay: %d commands of the transcript were not run, the next one is %v", len(rp.t.Commands)-rp.next, rp.t.Commands[rp.next].Args)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	rec := NewRecorder(&flakyRunner{failures: 1, stderr: "connection refused"})
+	cmd := exec.Command("kubectl", "apply", "-f", "-")
+	cmd.Stdin = strings.NewReader("kind: DaemonSet\n")
+	if _, err := rec.RunCmd(cmd); err == nil {
+		t.Fatal("the first command of the flaky runner succeeded")
+	}
+	if _, err := rec.RunCmd(exec.Command("kubectl", "get", "nodes")); err != nil {
+		t.Fatal(err)
+	}
+	var saved bytes.Buffer
+	if err := rec.Save(&saved); err != nil {
+		t.Fatal(err)
+	}
+	transcript, err := LoadTranscript(&saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rp := NewReplayer(transcript)
+	cmd = exec.Command("kubectl", "apply", "-f", "-")
+	cmd.Stdin = strings.NewReader("kind: DaemonSet\n")
+	rr, err := rp.RunCmd(cmd)
+	if err == nil || rr.ExitCode != 1 || rr.Stderr.String() != "connection refused" {
+		t.Errorf("replayed %d %q %v, want the recorded failure", rr.ExitCode, rr.Stderr.String(), err)
+	}
+	if err := rp.Done(); err == nil {
+		t.Error("Done succeeded with a command left")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := rp.RunCmdContext(ctx, exec.Command("kubectl", "get", "nodes")); err != context.Canceled {
+		t.Errorf("replaying with a cancelled context = %v, want %v", err, context.Canceled)
+	}
+	if _, err := rp.RunCmd(exec.Command("kubectl", "get", "nodes")); err != nil {
+		t.Errorf("the command cancelled before running was not replayed again: %v", err)
+	}
+	if err := rp.Done(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReplayDivergence(t *testing.T) {
+	rp := NewReplayer(&Transcript{Commands: []RecordedCommand{{Args: []string{"kubeadm", "init"}}}})
+	cmd := exec.Command("kubeadm", "init")
+	cmd.Stdin = strings.NewReader("unexpected")
+	if _, err := rp.RunCmd(cmd); err == nil || !strings.Contains(err.Error(), "different stdin") {
+		t.Errorf("replaying a command with another stdin = %v", err)
+	}
+	if _, err := rp.RunCmd(exec.Command("kubeadm", "reset")); err == nil || !strings.Contains(err.Error(), "unexpected command") {
+		t.Errorf("replaying past the transcript = %v", err)
+	}
+}
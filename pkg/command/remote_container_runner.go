@@ -0,0 +1,73 @@
+package command
+
+import (
+	"context"
+	"os/exec"
+)
+
+// RemoteContainerRunner runs commands in a container with the container
+// engine binary of the host of another Runner, for example a node on a
+// remote docker host reached with an SSHRunner
+type RemoteContainerRunner struct {
+	// Runner runs the engine binary on the host
+	Runner Runner
+	// Bin is the container engine binary, docker or podman
+	Bin      string
+	nameOrID string
+	// User to run the commands as, the container's user by default
+	User string
+	// Privileged runs the commands with extended privileges, so they can remount etc..
+	Privileged bool
+}
+
+// NewRemoteContainerRunner returns a Runner running privileged commands in
+// a container with the engine binary bin, run by r
+func NewRemoteContainerRunner(r Runner, bin, containerNameOrID string) *RemoteContainerRunner {
+	return &RemoteContainerRunner{
+		Runner:     r,
+		Bin:        bin,
+		nameOrID:   containerNameOrID,
+		Privileged: true,
+	}
+}
+
+// RunCmd runs cmd in the container. The environment and working directory of
+// cmd apply inside the container.
+func (c *RemoteContainerRunner) RunCmd(cmd *exec.Cmd) (*RunResult, error) {
+	return c.RunCmdContext(context.Background(), cmd)
+}
+
+// RunCmdContext runs cmd in the container, killing the engine command when ctx is done
+func (c *RemoteContainerRunner) RunCmdContext(ctx context.Context, cmd *exec.Cmd) (*RunResult, error) {
+	args := []string{c.Bin, "exec"}
+	if c.Privileged {
+		args = append(args, "--privileged")
+	}
+	if cmd.Stdin != nil {
+		args = append(args, "-i")
+	}
+	for _, env := range cmd.Env {
+		args = append(args, "-e", env)
+	}
+	if cmd.Dir != "" {
+		args = append(args, "--workdir", cmd.Dir)
+	}
+	if c.User != "" {
+		args = append(args, "--user", c.User)
+	}
+	args = append(args, c.nameOrID)
+	args = append(args, cmd.Args...)
+
+	engineCmd := &exec.Cmd{
+		Path:   c.Bin,
+		Args:   args,
+		Stdin:  cmd.Stdin,
+		Stdout: cmd.Stdout,
+		Stderr: cmd.Stderr,
+	}
+	rr, err := RunCmdContext(ctx, c.Runner, engineCmd)
+	if rr != nil {
+		rr.Args = cmd.Args
+	}
+	return rr, err
+}
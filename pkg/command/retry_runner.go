@@ -0,0 +1,195 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"regexp"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy is which failed commands a RetryRunner retries, and how
+type RetryPolicy struct {
+	// ExitCodes are the exit codes worth retrying
+	ExitCodes []int
+	// StderrPatterns match the stderr of the failures worth retrying
+	StderrPatterns []*regexp.Regexp
+	// Timeouts retries the commands killed by a TimeoutRunner
+	Timeouts bool
+
+	// MaxAttempts is how many times a command runs at most, 0 means no limit
+	MaxAttempts int
+	// InitialInterval is the wait before the first retry, it grows exponentially
+	InitialInterval time.Duration
+	// MaxInterval caps the wait between retries
+	MaxInterval time.Duration
+	// MaxElapsedTime is when to stop retrying, 0 means DefaultMaxElapsedTime
+	MaxElapsedTime time.Duration
+}
+
+// DefaultMaxElapsedTime is when a RetryPolicy without a MaxElapsedTime stops retrying
+const DefaultMaxElapsedTime = time.Minute
+
+// APIServerRetryPolicy retries kubectl commands that fail while the api
+// server is still settling, eg right after kubeadm init
+var APIServerRetryPolicy = RetryPolicy{
+	StderrPatterns: []*regexp.Regexp{
+		regexp.MustCompile(`connection refused`),
+		regexp.MustCompile(`connection reset by peer`),
+		regexp.MustCompile(`Unable to connect to the server`),
+		regexp.MustCompile(`TLS handshake timeout`),
+		regexp.MustCompile(`the server is currently unable to handle the request`),
+		regexp.MustCompile(`the server was unable to return a response in the time allotted`),
+		regexp.MustCompile(`etcdserver: request timed out`),
+		regexp.MustCompile(`etcdserver: leader changed`),
+	},
+	Timeouts:        true,
+	InitialInterval: time.Second,
+	MaxInterval:     10 * time.Second,
+	MaxElapsedTime:  2 * time.Minute,
+}
+
+// Retryable returns true if the failure of a command is worth retrying. If
+// the policy has neither exit codes nor stderr patterns, every command
+// that ran and exited with a non-zero code is.
+func (p RetryPolicy) Retryable(rr *RunResult, err error) bool {
+	if err == nil {
+		return false
+	}
+	if IsTimeout(err) {
+		return p.Timeouts
+	}
+	if rr == nil {
+		return false
+	}
+	if len(p.ExitCodes) == 0 && len(p.StderrPatterns) == 0 {
+		return rr.ExitCode > 0
+	}
+	for _, code := range p.ExitCodes {
+		if rr.ExitCode == code {
+			return true
+		}
+	}
+	for _, re := range p.StderrPatterns {
+		if re.Match(rr.Stderr.Bytes()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p RetryPolicy) backOff() backoff.BackOff {
+	b := backoff.NewExponentialBackOff()
+	if p.InitialInterval > 0 {
+		b.InitialInterval = p.InitialInterval
+	}
+	if p.MaxInterval > 0 {
+		b.MaxInterval = p.MaxInterval
+	}
+	b.MaxElapsedTime = p.MaxElapsedTime
+	if b.MaxElapsedTime <= 0 {
+		b.MaxElapsedTime = DefaultMaxElapsedTime
+	}
+	if p.MaxAttempts > 0 {
+		return backoff.WithMaxRetries(b, uint64(p.MaxAttempts-1))
+	}
+	return b
+}
+
+// RetryRunner runs commands again, with an exponential backoff, when they
+// fail in a way the Policy says is worth retrying.
+// The input of a command is read before its first attempt, and its output
+// is only written to cmd.Stdout and cmd.Stderr once the last attempt is done.
+type RetryRunner struct {
+	Runner Runner
+	Policy RetryPolicy
+	Logger Logger
+}
+
+// NewRetryRunner returns a RetryRunner retrying the commands of r according to policy
+func NewRetryRunner(r Runner, policy RetryPolicy) *RetryRunner {
+	return &RetryRunner{Runner: r, Policy: policy, Logger: DefaultLogger}
+}
+
+// Retry is a Middleware retrying commands according to policy
+func Retry(policy RetryPolicy) Middleware {
+	return func(r Runner) ContextRunner {
+		return NewRetryRunner(r, policy)
+	}
+}
+
+// Retries returns true if r retries the commands it runs, because it is a
+// RetryRunner or decorates one, eg a runner built by Chain with Retry
+func Retries(r Runner) bool {
+	switch d := r.(type) {
+	case *RetryRunner:
+		return true
+	case *TimeoutRunner:
+		return Retries(d.Runner)
+	case *LoggingRunner:
+		return Retries(d.Runner)
+	case *Recorder:
+		return Retries(d.r)
+	case plainRunner:
+		return Retries(d.Runner)
+	}
+	return false
+}
+
+// RunCmd runs cmd until it succeeds or is not worth retrying
+func (r *RetryRunner) RunCmd(cmd *exec.Cmd) (*RunResult, error) {
+	return r.RunCmdContext(context.Background(), cmd)
+}
+
+// RunCmdContext runs cmd until it succeeds, is not worth retrying or ctx is
+// done. It runs cmd once if ctx is Unbuffered.
+func (r *RetryRunner) RunCmdContext(ctx context.Context, cmd *exec.Cmd) (*RunResult, error) {
+	if isUnbuffered(ctx) {
+		return RunCmdContext(ctx, r.Runner, cmd)
+	}
+	var stdin []byte
+	if cmd.Stdin != nil {
+		var err error
+		if stdin, err = ioutil.ReadAll(cmd.Stdin); err != nil {
+			return &RunResult{Args: cmd.Args, ExitCode: -1}, errors.Wrap(err, "reading stdin")
+		}
+	}
+
+	attempt := 0
+	var rr *RunResult
+	op := func() error {
+		attempt++
+		c := copyCmd(cmd)
+		if stdin != nil {
+			c.Stdin = bytes.NewReader(stdin)
+		}
+		var err error
+		rr, err = RunCmdContext(ctx, r.Runner, c)
+		if err != nil && (ctx.Err() != nil || !r.Policy.Retryable(rr, err)) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}
+	notify := func(err error, next time.Duration) {
+		logger(r.Logger).Infof("(RetryRunner) attempt %d of %v failed, retrying in %s: %v", attempt, cmd.Args, next, err)
+	}
+	err := backoff.RetryNotify(op, backoff.WithContext(r.Policy.backOff(), ctx), notify)
+	if rr == nil {
+		rr = &RunResult{Args: cmd.Args}
+	}
+	if cmd.Stdout != nil {
+		if _, werr := cmd.Stdout.Write(rr.Stdout.Bytes()); werr != nil && err == nil {
+			err = errors.Wrap(werr, "writing stdout")
+		}
+	}
+	if cmd.Stderr != nil {
+		if _, werr := cmd.Stderr.Write(rr.Stderr.Bytes()); werr != nil && err == nil {
+			err = errors.Wrap(werr, "writing stderr")
+		}
+	}
+	return rr, err
+}
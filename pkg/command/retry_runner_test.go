@@ -0,0 +1,104 @@
+package command
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff"
+)
+
+// flakyRunner reads the stdin of commands, fails the first ones with
+// stderr, then succeeds
+type flakyRunner struct {
+	failures int
+	stderr   string
+	runs     int
+}
+
+func (f *flakyRunner) RunCmd(cmd *exec.Cmd) (*RunResult, error) {
+	f.runs++
+	rr := &RunResult{Args: cmd.Args}
+	if cmd.Stdin != nil {
+		if _, err := ioutil.ReadAll(cmd.Stdin); err != nil {
+			return rr, err
+		}
+	}
+	if f.runs <= f.failures {
+		rr.ExitCode = 1
+		rr.Stderr.WriteString(f.stderr)
+		return rr, &exitError{code: 1}
+	}
+	return rr, nil
+}
+
+type exitError struct{ code int }
+
+func (e *exitError) Error() string { return "exit status 1" }
+
+func TestRetryRunner(t *testing.T) {
+	policy := RetryPolicy{
+		StderrPatterns:  []*regexp.Regexp{regexp.MustCompile(`connection refused`)},
+		InitialInterval: time.Millisecond,
+		MaxAttempts:     3,
+	}
+	tests := []struct {
+		name     string
+		failures int
+		stderr   string
+		wantRuns int
+		wantErr  bool
+	}{
+		{"success", 0, "", 1, false},
+		{"transient failure", 2, "connection refused", 3, false},
+		{"too many failures", 5, "connection refused", 3, true},
+		{"permanent failure", 5, "AlreadyExists", 1, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &flakyRunner{failures: tc.failures, stderr: tc.stderr}
+			r := NewRetryRunner(f, policy)
+			r.Logger = NopLogger
+			_, err := r.RunCmd(exec.Command("kubectl", "get", "nodes"))
+			if f.runs != tc.wantRuns || (err != nil) != tc.wantErr {
+				t.Errorf("ran %d times = %v, want %d runs and error %v", f.runs, err, tc.wantRuns, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDefaultMaxElapsedTime(t *testing.T) {
+	b, ok := RetryPolicy{}.backOff().(*backoff.ExponentialBackOff)
+	if !ok {
+		t.Fatalf("backOff = %T, want an exponential backoff", RetryPolicy{}.backOff())
+	}
+	if b.MaxElapsedTime != DefaultMaxElapsedTime {
+		t.Errorf("a zero policy stops retrying after %s, want %s", b.MaxElapsedTime, DefaultMaxElapsedTime)
+	}
+	b = RetryPolicy{MaxElapsedTime: time.Second}.backOff().(*backoff.ExponentialBackOff)
+	if b.MaxElapsedTime != time.Second {
+		t.Errorf("MaxElapsedTime = %s, want 1s", b.MaxElapsedTime)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	f := &flakyRunner{}
+	tests := []struct {
+		name string
+		r    Runner
+		want bool
+	}{
+		{"plain runner", f, false},
+		{"retry runner", NewRetryRunner(f, RetryPolicy{}), true},
+		{"chain with retry", Chain(f, Logging(NopLogger, "node"), Retry(RetryPolicy{}), Timeout(time.Second)), true},
+		{"chain without retry", Chain(f, Logging(NopLogger, "node"), Timeout(time.Second)), false},
+		{"recorded retry runner", NewRecorder(NewRetryRunner(f, RetryPolicy{})), true},
+	}
+	for _, tc := range tests {
+		if got := Retries(tc.r); got != tc.want {
+			t.Errorf("%s: Retries = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package command
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os/exec"
 	"strings"
@@ -41,8 +42,90 @@ func (rr RunResult) Command() string {
 	return sb.String()
 }
 
+// Runner runs commands, for example inside a node
 type Runner interface {
 	// RunCmd runs a cmd of exec.Cmd type. allowing user to set cmd.Stdin, cmd.Stdout,...
 	// not all implementors are guaranteed to handle all the properties of cmd.
 	RunCmd(cmd *exec.Cmd) (*RunResult, error)
 }
+
+// ContextRunner is a Runner that can cancel the commands it runs. Commands
+// run with an Unbuffered ctx only have their output written to cmd.Stdout
+// and cmd.Stderr, runners must not keep it in the RunResult.
+type ContextRunner interface {
+	Runner
+	// RunCmdContext is like RunCmd but kills the command if ctx is done
+	// before the command completes on its own.
+	RunCmdContext(ctx context.Context, cmd *exec.Cmd) (*RunResult, error)
+}
+
+// RunCmdContext runs cmd with r, cancelling it when ctx is done if r is a ContextRunner.
+// Other runners can not interrupt a started command, ctx is only checked before it starts,
+// and keep the output of the commands even if ctx is Unbuffered.
+func RunCmdContext(ctx context.Context, r Runner, cmd *exec.Cmd) (*RunResult, error) {
+	if err := ctx.Err(); err != nil {
+		return &RunResult{Args: cmd.Args}, err
+	}
+	if cr, ok := r.(ContextRunner); ok {
+		return cr.RunCmdContext(ctx, cmd)
+	}
+	return r.RunCmd(cmd)
+}
+
+type unbufferedKey struct{}
+
+// Unbuffered returns a ctx in which runners only write the output of the
+// commands to cmd.Stdout and cmd.Stderr, without keeping it in the
+// RunResult, so commands streaming their output for as long as they run,
+// eg journalctl --follow, don't grow the memory. A RetryRunner runs these
+// commands once, as their output can't be taken back to retry them.
+func Unbuffered(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unbufferedKey{}, true)
+}
+
+// isUnbuffered tells if the output of commands run with ctx is not kept
+func isUnbuffered(ctx context.Context) bool {
+	unbuffered, _ := ctx.Value(unbufferedKey{}).(bool)
+	return unbuffered
+}
+
+// Middleware decorates a Runner, for example to retry or time out the
+// commands it runs
+type Middleware func(Runner) ContextRunner
+
+// Chain decorates r with middlewares, the first one is the outermost, eg
+// Chain(r, Retry(p), Timeout(d)) retries commands that each time out after d
+func Chain(r Runner, middlewares ...Middleware) ContextRunner {
+	cr := asContextRunner(r)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		cr = middlewares[i](cr)
+	}
+	return cr
+}
+
+// asContextRunner returns r as a ContextRunner, runners that can not cancel
+// their commands only check ctx before starting them
+func asContextRunner(r Runner) ContextRunner {
+	if cr, ok := r.(ContextRunner); ok {
+		return cr
+	}
+	return plainRunner{r}
+}
+
+type plainRunner struct {
+	Runner
+}
+
+func (p plainRunner) RunCmdContext(ctx context.Context, cmd *exec.Cmd) (*RunResult, error) {
+	return RunCmdContext(ctx, p.Runner, cmd)
+}
+
+// copyCmd returns a cmd that runs like cmd, without its input and output
+func copyCmd(cmd *exec.Cmd) *exec.Cmd {
+	return &exec.Cmd{
+		Path: cmd.Path,
+		Args: cmd.Args,
+		Env:  cmd.Env,
+		Dir:  cmd.Dir,
+	}
+}
@@ -0,0 +1,285 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"k8s.io/client-go/util/homedir"
+)
+
+// SSHConfig is how an SSHRunner connects to a host
+type SSHConfig struct {
+	// Host is the host to connect to, as host or host:port, the port is 22 by default
+	Host string
+	// User is the user to log in as
+	User string
+	// KeyPaths are the private keys to authenticate with, they must not be
+	// protected by a passphrase, use the agent for those
+	KeyPaths []string
+	// UseAgent authenticates with the keys of the agent listening on $SSH_AUTH_SOCK
+	UseAgent bool
+	// KnownHostsPath is the known_hosts file checking the key of the host,
+	// ~/.ssh/known_hosts by default
+	KnownHostsPath string
+	// HostKeyCallback checks the key of the host instead of KnownHostsPath,
+	// for example ssh.FixedHostKey to pin a key
+	HostKeyCallback ssh.HostKeyCallback
+	// DialTimeout is how long connecting may take, 30s by default
+	DialTimeout time.Duration
+}
+
+// DefaultKnownHostsPath returns the known_hosts file of the current user
+func DefaultKnownHostsPath() string {
+	return filepath.Join(homedir.HomeDir(), ".ssh", "known_hosts")
+}
+
+// SSHRunner runs commands on a host over SSH, for example a node reachable
+// only with SSH, or the host of a remote container engine.
+// It connects on the first command and reuses the connection until Close.
+type SSHRunner struct {
+	Logger Logger
+
+	addr         string
+	clientConfig *ssh.ClientConfig
+	dialTimeout  time.Duration
+
+	mu     sync.Mutex
+	client *ssh.Client
+	agent  net.Conn
+}
+
+// NewSSHRunner returns a Runner running commands on the host of cfg
+func NewSSHRunner(cfg SSHConfig) (*SSHRunner, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("ssh: no host to connect to")
+	}
+	addr := cfg.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	s := &SSHRunner{Logger: DefaultLogger, addr: addr, dialTimeout: cfg.DialTimeout}
+	if s.dialTimeout == 0 {
+		s.dialTimeout = 30 * time.Second
+	}
+
+	var signers []ssh.Signer
+	for _, p := range cfg.KeyPaths {
+		pem, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading ssh key")
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing ssh key %s", p)
+		}
+		signers = append(signers, signer)
+	}
+	var auth []ssh.AuthMethod
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+	if cfg.UseAgent {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if sock == "" {
+			return nil, errors.New("ssh: no agent, SSH_AUTH_SOCK is not set")
+		}
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			return nil, errors.Wrap(err, "connecting to the ssh agent")
+		}
+		s.agent = conn
+		auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("ssh: no keys to authenticate with, set KeyPaths or UseAgent")
+	}
+
+	hostKeyCallback := cfg.HostKeyCallback
+	if hostKeyCallback == nil {
+		path := cfg.KnownHostsPath
+		if path == "" {
+			path = DefaultKnownHostsPath()
+		}
+		var err error
+		hostKeyCallback, err = knownhosts.New(path)
+		if err != nil {
+			s.Close()
+			return nil, errors.Wrap(err, "reading known hosts")
+		}
+	}
+	s.clientConfig = &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+	}
+	return s, nil
+}
+
+// connect returns the connection to the host, connecting if needed
+func (s *SSHRunner) connect(ctx context.Context) (*ssh.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		return s.client, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.dialTimeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "connecting to %s", s.addr)
+	}
+	// the handshake does not take a context
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, s.addr, s.clientConfig)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "ssh handshake with %s", s.addr)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	s.client = ssh.NewClient(c, chans, reqs)
+	go func(client *ssh.Client) {
+		// forget a broken connection, the next command reconnects
+		_ = client.Wait()
+		s.mu.Lock()
+		if s.client == client {
+			s.client = nil
+		}
+		s.mu.Unlock()
+	}(s.client)
+	return s.client, nil
+}
+
+// Close closes the connection to the host and to the agent
+func (s *SSHRunner) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	if s.client != nil {
+		err = s.client.Close()
+		s.client = nil
+	}
+	if s.agent != nil {
+		s.agent.Close()
+		s.agent = nil
+	}
+	return err
+}
+
+// RunCmd runs cmd on the host. The environment and working directory of
+// cmd apply on the host.
+func (s *SSHRunner) RunCmd(cmd *exec.Cmd) (*RunResult, error) {
+	return s.RunCmdContext(context.Background(), cmd)
+}
+
+// RunCmdContext runs cmd on the host, killing it when ctx is done
+func (s *SSHRunner) RunCmdContext(ctx context.Context, cmd *exec.Cmd) (*RunResult, error) {
+	rr := &RunResult{Args: cmd.Args}
+	start := time.Now()
+	client, err := s.connect(ctx)
+	if err != nil {
+		return rr, finish(logger(s.Logger), "SSHRunner", rr, -1, err, time.Since(start))
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		return rr, finish(logger(s.Logger), "SSHRunner", rr, -1, errors.Wrap(err, "ssh session"), time.Since(start))
+	}
+	defer session.Close()
+	session.Stdin = cmd.Stdin
+	stdout := &stopWriter{w: tee(ctx, cmd.Stdout, &rr.Stdout)}
+	stderr := &stopWriter{w: tee(ctx, cmd.Stderr, &rr.Stderr)}
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	if err := session.Start(remoteCommand(cmd)); err != nil {
+		return rr, finish(logger(s.Logger), "SSHRunner", rr, -1, err, time.Since(start))
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// not every sshd delivers signals, closing the session hangs the command up
+		_ = session.Signal(ssh.SIGKILL)
+		session.Close()
+		// the session may still be copying output, which must not reach rr
+		stdout.stop()
+		stderr.stop()
+		err = ctx.Err()
+	}
+	return rr, finish(logger(s.Logger), "SSHRunner", rr, sshExitCode(err), err, time.Since(start))
+}
+
+// stopWriter writes to w until it is stopped
+type stopWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	stopped bool
+}
+
+func (s *stopWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return 0, io.ErrClosedPipe
+	}
+	return s.w.Write(p)
+}
+
+func (s *stopWriter) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+}
+
+// sshExitCode returns the exit code of a finished remote command, -1 if
+// it didn't run or exited without reporting its status
+func sshExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitError, ok := err.(*ssh.ExitError); ok {
+		return exitError.ExitStatus()
+	}
+	return -1
+}
+
+// remoteCommand returns the shell command line of cmd, in its environment
+// and working directory. sshd usually refuses the environment of sessions.
+func remoteCommand(cmd *exec.Cmd) string {
+	var sb strings.Builder
+	if cmd.Dir != "" {
+		fmt.Fprintf(&sb, "cd %s && ", ShellQuote(cmd.Dir))
+	}
+	if len(cmd.Env) > 0 {
+		sb.WriteString("env")
+		for _, e := range cmd.Env {
+			sb.WriteString(" " + ShellQuote(e))
+		}
+		sb.WriteString(" ")
+	}
+	for i, a := range cmd.Args {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(ShellQuote(a))
+	}
+	return sb.String()
+}
@@ -0,0 +1,355 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshHandler runs a command line received by the test server, and returns
+// its exit code or a negative value to exit without a status
+type sshHandler func(line string, ch ssh.Channel, signals <-chan string) int
+
+// sshServer is an in-process ssh server running commands with a handler
+type sshServer struct {
+	addr     string
+	hostKey  ssh.Signer
+	keyPath  string
+	dir      string
+	listener net.Listener
+
+	mu      sync.Mutex
+	lines   []string
+	signals []string
+}
+
+func newRSASigner(t *testing.T) (*rsa.PrivateKey, ssh.Signer) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, signer
+}
+
+// newSSHServer starts a server accepting the key written to its keyPath
+func newSSHServer(t *testing.T, handler sshHandler) *sshServer {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, hostKey := newRSASigner(t)
+	userKey, userSigner := newRSASigner(t)
+	keyPath := filepath.Join(dir, "id_rsa")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(userKey)})
+	if err := ioutil.WriteFile(keyPath, pemBytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(c ssh.ConnMetadata, k ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(k.Marshal(), userSigner.PublicKey().Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key for %s", c.User())
+		},
+	}
+	cfg.AddHostKey(hostKey)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &sshServer{addr: l.Addr().String(), hostKey: hostKey, keyPath: keyPath, dir: dir, listener: l}
+	go s.serve(cfg, handler)
+	return s
+}
+
+func (s *sshServer) close() {
+	s.listener.Close()
+	os.RemoveAll(s.dir)
+}
+
+// knownHosts writes a known_hosts file with the line of key for the server
+func (s *sshServer) knownHosts(t *testing.T, key ssh.PublicKey) string {
+	t.Helper()
+	path := filepath.Join(s.dir, fmt.Sprintf("known_hosts-%d", time.Now().UnixNano()))
+	var content string
+	if key != nil {
+		content = knownhosts.Line([]string{s.addr}, key) + "\n"
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// runner returns a runner for the server trusting its host key
+func (s *sshServer) runner(t *testing.T) *SSHRunner {
+	t.Helper()
+	r, err := NewSSHRunner(SSHConfig{
+		Host:           s.addr,
+		User:           "kic",
+		KeyPaths:       []string{s.keyPath},
+		KnownHostsPath: s.knownHosts(t, s.hostKey.PublicKey()),
+	})
+	if err != nil {
+		t.Fatalf("NewSSHRunner: %v", err)
+	}
+	r.Logger = NopLogger
+	return r
+}
+
+func (s *sshServer) serve(cfg *ssh.ServerConfig, handler sshHandler) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+			if err != nil {
+				return
+			}
+			go ssh.DiscardRequests(reqs)
+			for nc := range chans {
+				ch, creqs, err := nc.Accept()
+				if err != nil {
+					continue
+				}
+				go s.session(ch, creqs, handler)
+			}
+		}()
+	}
+}
+
+// session runs the exec request of a session with handler, and passes it
+// the signals sent to the session
+func (s *sshServer) session(ch ssh.Channel, reqs <-chan *ssh.Request, handler sshHandler) {
+	defer ch.Close()
+	signals := make(chan string, 1)
+	for req := range reqs {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		var payload struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			req.Reply(false, nil)
+			return
+		}
+		req.Reply(true, nil)
+		s.mu.Lock()
+		s.lines = append(s.lines, payload.Command)
+		s.mu.Unlock()
+
+		done := make(chan int, 1)
+		go func() {
+			done <- handler(payload.Command, ch, signals)
+		}()
+		for {
+			select {
+			case code := <-done:
+				if code >= 0 {
+					ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(code)}))
+				}
+				return
+			case req, ok := <-reqs:
+				if !ok {
+					close(signals)
+					<-done
+					return
+				}
+				if req.Type == "signal" {
+					var sig struct{ Signal string }
+					_ = ssh.Unmarshal(req.Payload, &sig)
+					s.mu.Lock()
+					s.signals = append(s.signals, sig.Signal)
+					s.mu.Unlock()
+					signals <- sig.Signal
+				}
+			}
+		}
+	}
+}
+
+func (s *sshServer) received() (lines, signals []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.lines...), append([]string(nil), s.signals...)
+}
+
+func TestSSHRunnerKnownHosts(t *testing.T) {
+	s := newSSHServer(t, func(string, ssh.Channel, <-chan string) int { return 0 })
+	defer s.close()
+	_, otherKey := newRSASigner(t)
+
+	tests := []struct {
+		name    string
+		key     ssh.PublicKey
+		wantErr bool
+	}{
+		{"known host", s.hostKey.PublicKey(), false},
+		{"unknown host", nil, true},
+		{"changed host key", otherKey.PublicKey(), true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewSSHRunner(SSHConfig{
+				Host:           s.addr,
+				User:           "kic",
+				KeyPaths:       []string{s.keyPath},
+				KnownHostsPath: s.knownHosts(t, tc.key),
+			})
+			if err != nil {
+				t.Fatalf("NewSSHRunner: %v", err)
+			}
+			defer r.Close()
+			r.Logger = NopLogger
+			_, err = r.RunCmd(exec.Command("true"))
+			if (err != nil) != tc.wantErr {
+				t.Errorf("RunCmd = %v, want error %v", err, tc.wantErr)
+			}
+			if tc.wantErr && !strings.Contains(err.Error(), "knownhosts") {
+				t.Errorf("RunCmd = %v, want the host key to be rejected", err)
+			}
+		})
+	}
+
+	if _, err := NewSSHRunner(SSHConfig{Host: s.addr, KeyPaths: []string{s.keyPath}, KnownHostsPath: filepath.Join(s.dir, "missing")}); err == nil {
+		t.Error("NewSSHRunner with a missing known_hosts file succeeded")
+	}
+}
+
+func TestSSHRunnerStdin(t *testing.T) {
+	s := newSSHServer(t, func(line string, ch ssh.Channel, _ <-chan string) int {
+		if _, err := io.Copy(ch, ch); err != nil {
+			return 1
+		}
+		fmt.Fprint(ch.Stderr(), "done")
+		return 0
+	})
+	defer s.close()
+	r := s.runner(t)
+	defer r.Close()
+
+	// larger than the ssh channel window, so it is streamed
+	input := strings.Repeat("kind: ClusterConfiguration\n", 100000)
+	cmd := exec.Command("cp", "/dev/stdin", "/kic/kubeadm.conf")
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Env = []string{"KUBECONFIG=/etc/kubernetes/admin.conf", "MSG=it's"}
+	cmd.Dir = "/kic dir"
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	rr, err := r.RunCmd(cmd)
+	if err != nil {
+		t.Fatalf("RunCmd: %v", err)
+	}
+	if rr.Stdout.String() != input || stdout.String() != input {
+		t.Errorf("stdout is %d bytes, %d written to cmd.Stdout, want the %d bytes of stdin", rr.Stdout.Len(), stdout.Len(), len(input))
+	}
+	if rr.Stderr.String() != "done" {
+		t.Errorf("stderr = %q, want done", rr.Stderr.String())
+	}
+	lines, _ := s.received()
+	want := `cd '/kic dir' && env KUBECONFIG=/etc/kubernetes/admin.conf 'MSG=it'"'"'s' cp /dev/stdin /kic/kubeadm.conf`
+	if len(lines) != 1 || lines[0] != want {
+		t.Errorf("remote commands = %q, want %q", lines, want)
+	}
+}
+
+func TestSSHRunnerExitCode(t *testing.T) {
+	s := newSSHServer(t, func(line string, ch ssh.Channel, _ <-chan string) int {
+		switch line {
+		case "true":
+			return 0
+		case "systemctl is-active kubelet":
+			fmt.Fprint(ch.Stderr(), "inactive")
+			return 3
+		}
+		// hung up without a status
+		return -1
+	})
+	defer s.close()
+	r := s.runner(t)
+	defer r.Close()
+
+	tests := []struct {
+		args    []string
+		code    int
+		wantErr bool
+	}{
+		{[]string{"true"}, 0, false},
+		{[]string{"systemctl", "is-active", "kubelet"}, 3, true},
+		{[]string{"kill", "-9", "$$"}, -1, true},
+	}
+	for _, tc := range tests {
+		rr, err := r.RunCmd(exec.Command(tc.args[0], tc.args[1:]...))
+		if rr.ExitCode != tc.code || (err != nil) != tc.wantErr {
+			t.Errorf("%v = %d %v, want exit code %d", tc.args, rr.ExitCode, err, tc.code)
+		}
+	}
+}
+
+func TestSSHRunnerCancel(t *testing.T) {
+	s := newSSHServer(t, func(line string, ch ssh.Channel, signals <-chan string) int {
+		if line == "true" {
+			return 0
+		}
+		// sleeps until killed or hung up
+		<-signals
+		return 137
+	})
+	defer s.close()
+	r := s.runner(t)
+	defer r.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	rr, err := r.RunCmdContext(ctx, exec.Command("sleep", "infinity"))
+	if errors.Cause(err) != context.DeadlineExceeded || rr.ExitCode != -1 {
+		t.Errorf("RunCmdContext = %d %v, want %v", rr.ExitCode, err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("RunCmdContext returned after %s", elapsed)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, signals := s.received(); len(signals) == 1 && signals[0] == string(ssh.SIGKILL) {
+			break
+		}
+		if time.Now().After(deadline) {
+			_, signals := s.received()
+			t.Fatalf("signals = %v, want the command to be killed", signals)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the connection is still usable
+	if _, err := r.RunCmd(exec.Command("true")); err != nil {
+		t.Errorf("RunCmd after a cancelled command: %v", err)
+	}
+}
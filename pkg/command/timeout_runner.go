@@ -0,0 +1,81 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TimeoutError is returned when a TimeoutRunner kills a command
+type TimeoutError struct {
+	Args    []string
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("command timed out after %s: %s: %v", e.Timeout, e.Args, e.Err)
+}
+
+// IsTimeout returns true if err is a *TimeoutError
+func IsTimeout(err error) bool {
+	_, ok := errors.Cause(err).(*TimeoutError)
+	return ok
+}
+
+// TimeoutRunner kills the commands that run for longer than their timeout.
+// Commands are only killed if Runner is a ContextRunner.
+type TimeoutRunner struct {
+	Runner Runner
+	// Timeout is the timeout of the commands, 0 means no timeout
+	Timeout time.Duration
+	// Commands are the timeouts of specific commands, by name, eg kubeadm,
+	// overriding Timeout
+	Commands map[string]time.Duration
+}
+
+// NewTimeoutRunner returns a TimeoutRunner killing the commands of r that run for longer than timeout
+func NewTimeoutRunner(r Runner, timeout time.Duration) *TimeoutRunner {
+	return &TimeoutRunner{Runner: r, Timeout: timeout}
+}
+
+// Timeout is a Middleware killing commands that run for longer than timeout
+func Timeout(timeout time.Duration) Middleware {
+	return func(r Runner) ContextRunner {
+		return NewTimeoutRunner(r, timeout)
+	}
+}
+
+// RunCmd runs cmd with a timeout
+func (t *TimeoutRunner) RunCmd(cmd *exec.Cmd) (*RunResult, error) {
+	return t.RunCmdContext(context.Background(), cmd)
+}
+
+// RunCmdContext runs cmd with a timeout, killing it early when ctx is done
+func (t *TimeoutRunner) RunCmdContext(ctx context.Context, cmd *exec.Cmd) (*RunResult, error) {
+	timeout := t.timeout(cmd.Args)
+	if timeout <= 0 {
+		return RunCmdContext(ctx, t.Runner, cmd)
+	}
+	tctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	rr, err := RunCmdContext(tctx, t.Runner, cmd)
+	// a cancelled ctx is not a timeout of the command
+	if err != nil && ctx.Err() == nil && tctx.Err() == context.DeadlineExceeded {
+		return rr, &TimeoutError{Args: cmd.Args, Timeout: timeout, Err: err}
+	}
+	return rr, err
+}
+
+func (t *TimeoutRunner) timeout(args []string) time.Duration {
+	if len(args) > 0 {
+		if d, ok := t.Commands[filepath.Base(args[0])]; ok {
+			return d
+		}
+	}
+	return t.Timeout
+}
@@ -0,0 +1,117 @@
+// Package resource parses and validates the resource limits of nodes
+package resource
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CPUs is a number of CPUs, which may be fractional
+type CPUs float64
+
+// Memory is an amount of memory in bytes
+type Memory int64
+
+// Memory units, like docker they are binary multiples
+const (
+	KiB Memory = 1 << (10 * (iota + 1))
+	MiB
+	GiB
+	TiB
+)
+
+// ParseCPUs parses a number of CPUs such as "2", "1.5" or "2000m", where
+// the m suffix means thousandths of a CPU like in kubernetes
+func ParseCPUs(s string) (CPUs, error) {
+	num := strings.TrimSpace(s)
+	div := 1.0
+	if strings.HasSuffix(num, "m") {
+		num, div = strings.TrimSuffix(num, "m"), 1000
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v <= 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0, fmt.Errorf("invalid number of cpus %q, expected eg 2, 1.5 or 1500m", s)
+	}
+	return CPUs(v / div), nil
+}
+
+// String returns the number of CPUs as accepted by "docker run --cpus"
+func (c CPUs) String() string {
+	return strconv.FormatFloat(float64(c), 'f', -1, 64)
+}
+
+// memoryRegexp matches docker and kubernetes style sizes, eg 4g, 4gb, 4Gi or 2000m
+var memoryRegexp = regexp.MustCompile(`^(\d+(?:\.\d+)?) ?([kmgt]?)(i?)(b?)$`)
+
+// ParseMemory parses an amount of memory such as "2000m", "4g", "4gb" or
+// "4Gi". Units are binary multiples, a number without unit is in bytes.
+func ParseMemory(s string) (Memory, error) {
+	m := memoryRegexp.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if m == nil || (m[2] == "" && m[3] != "") {
+		return 0, fmt.Errorf("invalid memory size %q, expected eg 2000m, 4g or 4Gi", s)
+	}
+	v, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory size %q: %v", s, err)
+	}
+	unit := Memory(1)
+	switch m[2] {
+	case "k":
+		unit = KiB
+	case "m":
+		unit = MiB
+	case "g":
+		unit = GiB
+	case "t":
+		unit = TiB
+	}
+	// float64(math.MaxInt64) rounds up to 2^63, which doesn't fit in a Memory
+	if v*float64(unit) >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid memory size %q: too large", s)
+	}
+	return Memory(v * float64(unit)), nil
+}
+
+// String returns the amount of memory as accepted by "docker run --memory",
+// in the largest unit that represents it exactly
+func (m Memory) String() string {
+	for _, u := range []struct {
+		size   Memory
+		suffix string
+	}{{TiB, "t"}, {GiB, "g"}, {MiB, "m"}, {KiB, "k"}} {
+		if m != 0 && m%u.size == 0 {
+			return fmt.Sprintf("%d%s", m/u.size, u.suffix)
+		}
+	}
+	return strconv.FormatInt(int64(m), 10)
+}
+
+// Host is the capacity of the machine running the container engine
+type Host struct {
+	CPUs   int
+	Memory Memory
+}
+
+// Validate checks that the limits fit in the host, zero limits are unlimited
+func Validate(cpus CPUs, memory Memory, host Host) error {
+	if cpus < 0 {
+		return fmt.Errorf("invalid number of cpus %s", cpus)
+	}
+	if host.CPUs > 0 && float64(cpus) > float64(host.CPUs) {
+		return fmt.Errorf("requested %s cpus but the container engine only has %d", cpus, host.CPUs)
+	}
+	if memory < 0 {
+		return fmt.Errorf("invalid memory size %s", memory)
+	}
+	// docker refuses containers with less than 6MB of memory
+	if memory > 0 && memory < 6*MiB {
+		return fmt.Errorf("requested %s of memory, the minimum is 6m", memory)
+	}
+	if host.Memory > 0 && memory > host.Memory {
+		return fmt.Errorf("requested %s of memory but the container engine only has %dm", memory, host.Memory/MiB)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package resource
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCPUs(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    CPUs
+		wantErr bool
+	}{
+		{in: "2", want: 2},
+		{in: "1.5", want: 1.5},
+		{in: "2000m", want: 2},
+		{in: "500m", want: 0.5},
+		{in: " 4 ", want: 4},
+		{in: "0", wantErr: true},
+		{in: "0m", wantErr: true},
+		{in: "-1", wantErr: true},
+		{in: "-500m", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "two", wantErr: true},
+		{in: "2cpus", wantErr: true},
+		{in: "NaN", wantErr: true},
+		{in: "Inf", wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := ParseCPUs(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseCPUs(%q) = %v, want an error", tc.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("ParseCPUs(%q) = %v %v, want %v", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Memory
+		wantErr bool
+	}{
+		{in: "512m", want: 512 * MiB},
+		{in: "4g", want: 4 * GiB},
+		{in: "4gb", want: 4 * GiB},
+		{in: "4Gi", want: 4 * GiB},
+		{in: "4G", want: 4 * GiB},
+		{in: "1.5g", want: 1536 * MiB},
+		{in: "2048k", want: 2 * MiB},
+		{in: "1t", want: TiB},
+		{in: "1073741824", want: GiB},
+		{in: "0", want: 0},
+		{in: "4i", wantErr: true},
+		{in: "-1g", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "lots", wantErr: true},
+		{in: "4 gigs", wantErr: true},
+		{in: "9223372036854775807", wantErr: true},
+		{in: "8388608t", wantErr: true},
+		{in: "99999999999999999999g", wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := ParseMemory(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseMemory(%q) = %v, want an error", tc.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("ParseMemory(%q) = %v %v, want %v", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	for _, c := range []CPUs{0.5, 1, 1.5, 2, 16} {
+		got, err := ParseCPUs(c.String())
+		if err != nil || got != c {
+			t.Errorf("ParseCPUs(%q) = %v %v, want %v", c.String(), got, err, c)
+		}
+	}
+	for _, tc := range []struct {
+		m    Memory
+		want string
+	}{
+		{m: 1000, want: "1000"},
+		{m: 2 * KiB, want: "2k"},
+		{m: 512 * MiB, want: "512m"},
+		{m: 1536 * MiB, want: "1536m"},
+		{m: 4 * GiB, want: "4g"},
+		{m: 2 * TiB, want: "2t"},
+	} {
+		if s := tc.m.String(); s != tc.want {
+			t.Errorf("Memory(%d).String() = %q, want %q", tc.m, s, tc.want)
+		}
+		got, err := ParseMemory(tc.m.String())
+		if err != nil || got != tc.m {
+			t.Errorf("ParseMemory(%q) = %v %v, want %d", tc.m.String(), got, err, tc.m)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	host := Host{CPUs: 4, Memory: 8 * GiB}
+	tests := []struct {
+		name    string
+		cpus    CPUs
+		memory  Memory
+		host    Host
+		wantErr string
+	}{
+		{name: "fits", cpus: 2, memory: 2 * GiB, host: host},
+		{name: "whole host", cpus: 4, memory: 8 * GiB, host: host},
+		{name: "unlimited", host: host},
+		{name: "unknown host", cpus: 64, memory: 64 * GiB},
+		{name: "too many cpus", cpus: 4.5, memory: 2 * GiB, host: host, wantErr: "only has 4"},
+		{name: "too much memory", cpus: 2, memory: 9 * GiB, host: host, wantErr: "only has 8192m"},
+		{name: "too little memory", cpus: 2, memory: 4 * MiB, host: host, wantErr: "minimum is 6m"},
+		{name: "negative cpus", cpus: -1, host: host, wantErr: "invalid number of cpus"},
+		{name: "negative memory", memory: -1, host: host, wantErr: "invalid memory size"},
+	}
+	for _, tc := range tests {
+		err := Validate(tc.cpus, tc.memory, tc.host)
+		if tc.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: Validate = %v, want no error", tc.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: Validate = %v, want an error containing %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package dryrun
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/medyagh/kic/pkg/assets"
+	"github.com/medyagh/kic/pkg/oci"
+	"github.com/medyagh/kic/pkg/oci/fake"
+	"github.com/pkg/errors"
+)
+
+// engine keeps the state of a dry-run in memory, so nodes can be found and
+// inspected after being "created", and adds the commands that change the
+// state to a plan
+type engine struct {
+	*fake.Engine
+	plan *Plan
+	bin  string
+}
+
+func newEngine(p *Plan, bin string) *engine {
+	return &engine{Engine: fake.NewEngine(), plan: p, bin: bin}
+}
+
+// Name returns the name of the engine the plan is for
+func (e *engine) Name() string {
+	return e.bin
+}
+
+func (e *engine) add(args ...string) {
+	e.plan.add(Step{Args: append([]string{e.bin}, args...)})
+}
+
+// CreateContainer adds the commands applying the conflict policy to an
+// existing container, found by comparing it before and after creating,
+// and the run command if a container was created
+func (e *engine) CreateContainer(ctx context.Context, image string, opts ...oci.CreateOpt) ([]string, error) {
+	run := oci.RunCommand(image, opts...)
+	name := runName(run)
+	var before *oci.ContainerInfo
+	if name != "" {
+		before, _ = e.ContainerInfo(ctx, name)
+	}
+	ids, err := e.Engine.CreateContainer(ctx, image, opts...)
+	if err != nil {
+		return ids, err
+	}
+	if before != nil {
+		if before.ID == ids[0] {
+			switch before.State.Status {
+			case "running":
+			case "paused":
+				e.add("unpause", name)
+			default:
+				e.add("start", name)
+			}
+			return ids, nil
+		}
+		e.add("rm", "-f", "-v", name)
+	}
+	e.add(run...)
+	return ids, nil
+}
+
+// runName returns the --name of run command args
+func runName(args []string) string {
+	for i, a := range args {
+		if a == "--name" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func (e *engine) Start(ctx context.Context, ociID string) error {
+	e.add("start", ociID)
+	return e.Engine.Start(ctx, ociID)
+}
+
+func (e *engine) Stop(ctx context.Context, ociID string) error {
+	e.add("stop", ociID)
+	return e.Engine.Stop(ctx, ociID)
+}
+
+func (e *engine) Restart(ctx context.Context, ociID string) error {
+	e.add("restart", ociID)
+	return e.Engine.Restart(ctx, ociID)
+}
+
+func (e *engine) Pause(ctx context.Context, ociID string) error {
+	e.add("pause", ociID)
+	return e.Engine.Pause(ctx, ociID)
+}
+
+func (e *engine) Unpause(ctx context.Context, ociID string) error {
+	e.add("unpause", ociID)
+	return e.Engine.Unpause(ctx, ociID)
+}
+
+func (e *engine) Remove(ctx context.Context, ociID string) error {
+	e.add("rm", "-f", "-v", ociID)
+	return e.Engine.Remove(ctx, ociID)
+}
+
+// Exec adds the command to the plan, with its stdin, and reports success.
+// The output of the command is a placeholder, so the commands using it can
+// be rendered as pipes.
+func (e *engine) Exec(ctx context.Context, ociID string, opts oci.ExecOptions) (int, error) {
+	args := []string{e.bin, "exec"}
+	if opts.Privileged {
+		args = append(args, "--privileged")
+	}
+	if opts.Stdin != nil {
+		args = append(args, "-i")
+	}
+	for _, env := range opts.Env {
+		args = append(args, "-e", env)
+	}
+	if opts.WorkingDir != "" {
+		args = append(args, "--workdir", opts.WorkingDir)
+	}
+	if opts.User != "" {
+		args = append(args, "--user", opts.User)
+	}
+	args = append(args, ociID)
+	args = append(args, opts.Cmd...)
+	s := Step{Args: args}
+	if opts.Stdin != nil {
+		stdin, err := ioutil.ReadAll(opts.Stdin)
+		if err != nil {
+			return -1, errors.Wrap(err, "reading stdin")
+		}
+		s.Stdin = stdin
+	}
+	output := e.plan.add(s)
+	if opts.Stdout != nil {
+		if _, err := opts.Stdout.Write(output); err != nil {
+			return -1, errors.Wrap(err, "writing stdout")
+		}
+	}
+	return e.Engine.Exec(ctx, ociID, oci.ExecOptions{})
+}
+
+func (e *engine) Copy(ctx context.Context, ociID string, asset assets.CopyAsset) error {
+	e.add("cp", asset.AssetName, fmt.Sprintf("%s:%s", ociID, asset.TargetPath()))
+	return e.Engine.Copy(ctx, ociID, asset)
+}
+
+func (e *engine) Pull(ctx context.Context, image string, progress oci.PullProgress) error {
+	e.add("pull", image)
+	return e.Engine.Pull(ctx, image, nil)
+}
+
+// Save adds the command to the plan, without writing dest
+func (e *engine) Save(ctx context.Context, image, dest string) error {
+	e.add("save", "-o", dest, image)
+	return nil
+}
+
+func (e *engine) CreateNetwork(ctx context.Context, name string, opts oci.NetworkOptions) error {
+	args := []string{"network", "create", "--driver=bridge"}
+	if opts.Subnet != "" {
+		args = append(args, "--subnet="+opts.Subnet)
+	}
+	if opts.IPv6Subnet != "" {
+		args = append(args, "--ipv6", "--subnet="+opts.IPv6Subnet)
+	}
+	args = append(args, labelArgs(opts.Labels)...)
+	e.add(append(args, name)...)
+	return e.Engine.CreateNetwork(ctx, name, opts)
+}
+
+func (e *engine) RemoveNetwork(ctx context.Context, name string) error {
+	e.add("network", "rm", name)
+	return e.Engine.RemoveNetwork(ctx, name)
+}
+
+func (e *engine) CreateVolume(ctx context.Context, name string, labels map[string]string) error {
+	args := append([]string{"volume", "create"}, labelArgs(labels)...)
+	e.add(append(args, name)...)
+	return e.Engine.CreateVolume(ctx, name, labels)
+}
+
+func (e *engine) RemoveVolume(ctx context.Context, name string) error {
+	e.add("volume", "rm", name)
+	return e.Engine.RemoveVolume(ctx, name)
+}
+
+// labelArgs returns the --label args of labels, sorted so the plan is stable
+func labelArgs(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var args []string
+	for _, k := range keys {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", k, labels[k]))
+	}
+	return args
+}
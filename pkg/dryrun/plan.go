@@ -0,0 +1,182 @@
+// Package dryrun records what provisioning a cluster would do instead of
+// doing it, as a plan of container engine and in-node commands that can be
+// printed as a bash script
+package dryrun
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/medyagh/kic/pkg/command"
+	"github.com/medyagh/kic/pkg/oci"
+)
+
+// Step is a command of a plan
+type Step struct {
+	// Args is the command, starting with the container engine binary
+	Args []string
+	// Stdin is the input of the command, for example a generated file
+	Stdin []byte
+	// Unrenderable describes why the step can not be rendered as a command,
+	// eg its input is computed from the output of an earlier command
+	Unrenderable string
+}
+
+// Plan is the ordered list of the commands a dry-run would have run
+type Plan struct {
+	mu    sync.Mutex
+	steps []Step
+}
+
+// NewPlan returns an empty plan
+func NewPlan() *Plan {
+	return &Plan{}
+}
+
+// Engine returns an Engine adding the commands the container engine name,
+// eg docker or podman, would run to the plan. The docker api engine is
+// planned as docker commands.
+func (p *Plan) Engine(name string) oci.Engine {
+	if name == oci.DockerAPI {
+		name = oci.Docker
+	}
+	return newEngine(p, name)
+}
+
+// Runner returns a Runner adding the commands run in a container of e to
+// the plan, e must be an Engine of the plan
+func (p *Plan) Runner(e oci.Engine, containerNameOrID string) command.ContextRunner {
+	r := command.NewContainerRunner(e, containerNameOrID)
+	r.Logger = command.NopLogger
+	return r
+}
+
+// add adds s to the plan and returns its output, which a dry-run does not
+// know, as a placeholder the script renders from the command when it can
+func (p *Plan) add(s Step) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.steps = append(p.steps, s)
+	return placeholder(len(p.steps) - 1)
+}
+
+// Unrenderable adds a step that can not be rendered as a command, the
+// script only describes it
+func (p *Plan) Unrenderable(description string) {
+	p.add(Step{Unrenderable: description})
+}
+
+// placeholder returns the output of the step i of a plan, its NUL bytes can
+// not occur in the output of the commands of the script
+func placeholder(i int) []byte {
+	return []byte(fmt.Sprintf("\x00kic-dry-run-output-%d\x00", i))
+}
+
+var placeholderRE = regexp.MustCompile("\x00kic-dry-run-output-([0-9]+)\x00")
+
+// Steps returns the commands of the plan, in order
+func (p *Plan) Steps() []Step {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Step(nil), p.steps...)
+}
+
+// heredoc is the delimiter of the inlined stdin of commands, suffixed with
+// a number when the stdin has a line equal to it
+const heredoc = "KIC_EOF"
+
+// WriteScript writes the plan as a bash script. The input of commands is
+// inlined as a heredoc, base64 encoded unless it is newline terminated text.
+// An input that is the output of an earlier command is piped from that
+// command, which runs again. The steps with an input computed from the
+// output of an earlier command can not be rendered, they are commented out.
+func (p *Plan) WriteScript(w io.Writer) error {
+	steps := p.Steps()
+	var sb strings.Builder
+	sb.WriteString("#!/usr/bin/env bash\n")
+	sb.WriteString("# generated by a kic dry-run\n")
+	sb.WriteString("set -o errexit -o nounset -o pipefail\n\n")
+	for _, s := range steps {
+		if s.Unrenderable != "" {
+			fmt.Fprintf(&sb, "# not rendered: %s\n", s.Unrenderable)
+			continue
+		}
+		line := commandLine(s.Args)
+		switch m := placeholderRE.FindSubmatchIndex(s.Stdin); {
+		case s.Stdin == nil:
+			sb.WriteString(line)
+		case m != nil:
+			i, _ := strconv.Atoi(string(s.Stdin[m[2]:m[3]]))
+			source := commandLine(steps[i].Args)
+			if m[0] != 0 || m[1] != len(s.Stdin) {
+				fmt.Fprintf(&sb, "# not rendered: the input is computed from the output of %s\n# %s", source, line)
+				break
+			}
+			fmt.Fprintf(&sb, "%s | %s", source, line)
+		case isText(s.Stdin):
+			delim := delimiter(s.Stdin)
+			fmt.Fprintf(&sb, "%s <<'%s'\n%s%s", line, delim, s.Stdin, delim)
+		default:
+			encoded := wrap(base64.StdEncoding.EncodeToString(s.Stdin), 76)
+			fmt.Fprintf(&sb, "base64 --decode <<'%s' | %s\n%s%s", heredoc, line, encoded, heredoc)
+		}
+		sb.WriteString("\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// commandLine returns args quoted for the shell
+func commandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = command.ShellQuote(a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// isText returns true if b can be inlined in a heredoc as is: newline
+// terminated utf-8 text without NUL bytes, heredocs always end with a newline
+func isText(b []byte) bool {
+	return len(b) > 0 && b[len(b)-1] == '\n' && utf8.Valid(b) && bytes.IndexByte(b, 0) < 0
+}
+
+// delimiter returns a heredoc delimiter that is not a line of text
+func delimiter(text []byte) string {
+	lines := map[string]bool{}
+	for _, l := range strings.Split(string(text), "\n") {
+		lines[l] = true
+	}
+	delim := heredoc
+	for i := 1; lines[delim]; i++ {
+		delim = fmt.Sprintf("%s_%d", heredoc, i)
+	}
+	return delim
+}
+
+// wrap splits s in newline terminated lines of width characters
+func wrap(s string, width int) string {
+	var sb strings.Builder
+	for len(s) > width {
+		sb.WriteString(s[:width] + "\n")
+		s = s[width:]
+	}
+	if s != "" {
+		sb.WriteString(s + "\n")
+	}
+	return sb.String()
+}
+
+// Script returns the plan as a bash script, see WriteScript
+func (p *Plan) Script() string {
+	var sb strings.Builder
+	_ = p.WriteScript(&sb)
+	return sb.String()
+}
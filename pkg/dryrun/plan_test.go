@@ -0,0 +1,106 @@
+package dryrun
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"flag"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/medyagh/kic/pkg/oci"
+)
+
+var update = flag.Bool("update", false, "update the golden files of testdata")
+
+// testPlan plans a node being created and given files of every kind
+func testPlan(t *testing.T) *Plan {
+	t.Helper()
+	ctx := context.Background()
+	p := NewPlan()
+	e := p.Engine(oci.Docker)
+	if err := e.CreateNetwork(ctx, "kic-p1", oci.NetworkOptions{Subnet: "192.168.49.0/24", Labels: map[string]string{"io.k8s.sigs.kic.cluster": "p1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.CreateContainer(ctx, "kindest/node:v1.16.3", oci.WithName("p1-control-plane"), oci.WithRunArgs("-d", "--network", "kic-p1")); err != nil {
+		t.Fatal(err)
+	}
+	r := p.Runner(e, "p1-control-plane")
+	run := func(stdin []byte, args ...string) string {
+		t.Helper()
+		cmd := exec.Command(args[0], args[1:]...)
+		if stdin != nil {
+			cmd.Stdin = bytes.NewReader(stdin)
+		}
+		rr, err := r.RunCmdContext(ctx, cmd)
+		if err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		return rr.Stdout.String()
+	}
+
+	run([]byte("kind: ClusterConfiguration\nclusterName: it's p1\n"), "cp", "/dev/stdin", "/kic/kubeadm.conf")
+	run([]byte("no trailing newline"), "cp", "/dev/stdin", "/kic/token")
+	run([]byte{0x1f, 0x8b, 0x08, 0x00, 0xff, 0x00, '\n'}, "tar", "-xz", "-C", "/kic")
+	run([]byte("cat <<'KIC_EOF'\nKIC_EOF\nKIC_EOF_1\nend\n"), "cp", "/dev/stdin", "/kic/script.sh")
+	run([]byte{}, "cp", "/dev/stdin", "/kic/empty")
+
+	manifest := run(nil, "cat", "/kind/manifests/default-cni.yaml")
+	run([]byte(manifest), "kubectl", "apply", "-f", "-")
+	run([]byte(strings.Replace(manifest, "{{ .PodSubnet }}", "10.244.0.0/16", -1)+"\n"), "kubectl", "create", "-f", "-")
+	p.Unrenderable("applying the default CNI manifest")
+	return p
+}
+
+func TestWriteScript(t *testing.T) {
+	var script bytes.Buffer
+	if err := testPlan(t).WriteScript(&script); err != nil {
+		t.Fatalf("WriteScript: %v", err)
+	}
+	golden := filepath.Join("testdata", "plan.golden.sh")
+	if *update {
+		if err := ioutil.WriteFile(golden, script.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if script.String() != string(want) {
+		t.Errorf("script =\n%s\nwant\n%s\nrun go test ./pkg/dryrun -update if the change is expected", script.String(), want)
+	}
+}
+
+// TestWriteScriptStdin runs the script with an engine printing the input of
+// its commands, which must be the planned input
+func TestWriteScriptStdin(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+	p := testPlan(t)
+	var script bytes.Buffer
+	// the engine binary is a function printing its stdin in hex, to compare
+	// the bytes of the heredocs
+	script.WriteString("docker() { if [ \"$1\" = exec ]; then echo \"$*\"; od -An -tx1 -v | tr -d ' \\n'; echo; fi; }\n")
+	if err := p.WriteScript(&script); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("bash", "-c", script.String())
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("running the script: %v\n%s", err, out)
+	}
+	got := string(out)
+	for _, s := range p.Steps() {
+		if s.Stdin == nil || bytes.Contains(s.Stdin, []byte("kic-dry-run-output")) {
+			continue
+		}
+		if !strings.Contains(got, hex.EncodeToString(s.Stdin)+"\n") {
+			t.Errorf("the input of %v was not passed as is, got:\n%s", s.Args, got)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+#!/usr/bin/env bash
+# generated by a kic dry-run
+set -o errexit -o nounset -o pipefail
+
+docker network create --driver=bridge --subnet=192.168.49.0/24 --label io.k8s.sigs.kic.cluster=p1 kic-p1
+docker run --name p1-control-plane -d --network kic-p1 kindest/node:v1.16.3
+docker exec --privileged -i p1-control-plane cp /dev/stdin /kic/kubeadm.conf <<'KIC_EOF'
+kind: ClusterConfiguration
+clusterName: it's p1
+KIC_EOF
+base64 --decode <<'KIC_EOF' | docker exec --privileged -i p1-control-plane cp /dev/stdin /kic/token
+bm8gdHJhaWxpbmcgbmV3bGluZQ==
+KIC_EOF
+base64 --decode <<'KIC_EOF' | docker exec --privileged -i p1-control-plane tar -xz -C /kic
+H4sIAP8ACg==
+KIC_EOF
+docker exec --privileged -i p1-control-plane cp /dev/stdin /kic/script.sh <<'KIC_EOF_2'
+cat <<'KIC_EOF'
+KIC_EOF
+KIC_EOF_1
+end
+KIC_EOF_2
+base64 --decode <<'KIC_EOF' | docker exec --privileged -i p1-control-plane cp /dev/stdin /kic/empty
+KIC_EOF
+docker exec --privileged p1-control-plane cat /kind/manifests/default-cni.yaml
+docker exec --privileged p1-control-plane cat /kind/manifests/default-cni.yaml | docker exec --privileged -i p1-control-plane kubectl apply -f -
+# not rendered: the input is computed from the output of docker exec --privileged p1-control-plane cat /kind/manifests/default-cni.yaml
+# docker exec --privileged -i p1-control-plane kubectl create -f -
+# not rendered: applying the default CNI manifest
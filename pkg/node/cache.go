@@ -13,6 +13,8 @@ type nodeCache struct {
 	ipv6              string
 	ports             map[int32]int32
 	role              string
+	network           string
+	volume            string
 }
 
 func (cache *nodeCache) set(setter func(*nodeCache)) {
@@ -49,6 +51,18 @@ func (cache *nodeCache) Role() string {
 	return cache.role
 }
 
+func (cache *nodeCache) Network() string {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+	return cache.network
+}
+
+func (cache *nodeCache) Volume() string {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+	return cache.volume
+}
+
 func (n *Node) String() string {
 	return n.name
 }
@@ -57,3 +71,8 @@ func (n *Node) String() string {
 func (n *Node) Name() string {
 	return n.name
 }
+
+// Role returns the node's role, for example control-plane
+func (n *Node) Role() string {
+	return n.cache.Role()
+}
@@ -0,0 +1,132 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/medyagh/kic/pkg/command"
+	"github.com/pkg/errors"
+)
+
+// Result is the outcome of an operation on one node of a fan-out
+type Result struct {
+	Node *Node
+	// RunResult is the result of the command, for RunAll
+	RunResult *command.RunResult
+	Err       error
+}
+
+// FanOutError is returned when an operation of a fan-out failed on some nodes
+type FanOutError struct {
+	// Errors are the errors of the failed nodes, by node name
+	Errors map[string]error
+	// Total is the number of nodes of the fan-out
+	Total int
+}
+
+// FailedNodes returns the names of the nodes the operation failed on, sorted
+func (e *FanOutError) FailedNodes() []string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (e *FanOutError) Error() string {
+	names := e.FailedNodes()
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = fmt.Sprintf("%s: %v", name, e.Errors[name])
+	}
+	return fmt.Sprintf("failed on %d of %d nodes (%s): %s", len(names), e.Total, strings.Join(names, ", "), strings.Join(msgs, "; "))
+}
+
+// FanOut runs f on every node concurrently, with at most parallelism nodes
+// at a time, or all of them if parallelism is 0. The results are in the
+// order of nodes. The error is a *FanOutError naming the failed nodes, the
+// nodes not started yet when ctx is done fail with its error.
+func FanOut(ctx context.Context, nodes []*Node, parallelism int, f func(ctx context.Context, n *Node) (*command.RunResult, error)) ([]Result, error) {
+	if parallelism <= 0 || parallelism > len(nodes) {
+		parallelism = len(nodes)
+	}
+	results := make([]Result, len(nodes))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, n := range nodes {
+		results[i].Node = n
+		// select picks at random when a slot is free and ctx is done too,
+		// so ctx is checked before and after waiting for a slot
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+			if err := ctx.Err(); err != nil {
+				<-sem
+				results[i].Err = err
+				continue
+			}
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func(r *Result) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			r.RunResult, r.Err = f(ctx, r.Node)
+		}(&results[i])
+	}
+	wg.Wait()
+
+	fe := &FanOutError{Errors: map[string]error{}, Total: len(nodes)}
+	for _, r := range results {
+		if r.Err != nil {
+			fe.Errors[r.Node.Name()] = r.Err
+		}
+	}
+	if len(fe.Errors) > 0 {
+		return results, fe
+	}
+	return results, nil
+}
+
+// RunAll runs the command args on every node, see FanOut
+func RunAll(ctx context.Context, nodes []*Node, parallelism int, args ...string) ([]Result, error) {
+	if len(args) == 0 {
+		return nil, errors.New("no command to run")
+	}
+	return FanOut(ctx, nodes, parallelism, func(ctx context.Context, n *Node) (*command.RunResult, error) {
+		return command.RunCmdContext(ctx, n.R, exec.Command(args[0], args[1:]...))
+	})
+}
+
+// WriteFileAll writes content to dest on every node, see FanOut
+func WriteFileAll(ctx context.Context, nodes []*Node, parallelism int, dest, content, perm string) error {
+	_, err := FanOut(ctx, nodes, parallelism, func(ctx context.Context, n *Node) (*command.RunResult, error) {
+		return nil, n.WriteFileContext(ctx, dest, content, perm)
+	})
+	return err
+}
+
+// LoadImageArchiveAll loads the image archive at path into every node, see FanOut
+func LoadImageArchiveAll(ctx context.Context, nodes []*Node, parallelism int, path string) error {
+	_, err := FanOut(ctx, nodes, parallelism, func(ctx context.Context, n *Node) (*command.RunResult, error) {
+		// every node reads its own copy of the archive
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "opening image archive")
+		}
+		defer f.Close()
+		return nil, n.LoadImageArchiveContext(ctx, f)
+	})
+	return err
+}
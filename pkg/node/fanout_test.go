@@ -0,0 +1,268 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/medyagh/kic/pkg/command"
+	"github.com/medyagh/kic/pkg/command/fake"
+	ocifake "github.com/medyagh/kic/pkg/oci/fake"
+	"github.com/pkg/errors"
+)
+
+// newFanOutNodes creates count worker nodes on a FakeEngine, the runner of
+// node i answering with the responses added by respond
+func newFanOutNodes(t *testing.T, count int, respond func(i int, r *fake.Runner)) ([]*Node, []*fake.Runner) {
+	t.Helper()
+	e := ocifake.NewEngine()
+	var nodes []*Node
+	var runners []*fake.Runner
+	for i := 0; i < count; i++ {
+		r := fake.NewRunner()
+		respond(i, r)
+		spec := Spec{Name: fmt.Sprintf("p1-worker%d", i), Profile: "p1", Role: WorkerRole, Image: testImage}
+		n, err := spec.CreateContext(context.Background(), e, r)
+		if err != nil {
+			t.Fatalf("CreateContext: %v", err)
+		}
+		nodes = append(nodes, n)
+		runners = append(runners, r)
+	}
+	return nodes, runners
+}
+
+// checkFailedNodes checks err is a *FanOutError naming only the failed nodes
+func checkFailedNodes(t *testing.T, err error, total int, failed ...string) {
+	t.Helper()
+	fe, ok := err.(*FanOutError)
+	if !ok {
+		t.Fatalf("error = %v, want a *FanOutError", err)
+	}
+	if got := fe.FailedNodes(); !reflect.DeepEqual(got, failed) {
+		t.Errorf("FailedNodes = %v, want %v", got, failed)
+	}
+	if fe.Total != total {
+		t.Errorf("Total = %d, want %d", fe.Total, total)
+	}
+	if want := fmt.Sprintf("failed on %d of %d nodes", len(failed), total); !strings.Contains(fe.Error(), want) {
+		t.Errorf("error %q does not say %q", fe, want)
+	}
+}
+
+func TestFanOutParallelism(t *testing.T) {
+	nodes, _ := newFanOutNodes(t, 6, func(int, *fake.Runner) {})
+	for _, tc := range []struct {
+		parallelism int
+		want        int
+	}{
+		{parallelism: 1, want: 1},
+		{parallelism: 2, want: 2},
+		{parallelism: 4, want: 4},
+		{parallelism: 0, want: 6},
+		{parallelism: 10, want: 6},
+	} {
+		var mu sync.Mutex
+		inFlight, maxInFlight := 0, 0
+		results, err := FanOut(context.Background(), nodes, tc.parallelism, func(ctx context.Context, n *Node) (*command.RunResult, error) {
+			mu.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			mu.Unlock()
+			// wait for the other nodes allowed to run at the same time
+			for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+				mu.Lock()
+				reached := maxInFlight >= tc.want
+				mu.Unlock()
+				if reached {
+					break
+				}
+			}
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+			return &command.RunResult{Args: []string{n.Name()}}, nil
+		})
+		if err != nil {
+			t.Fatalf("parallelism %d: FanOut: %v", tc.parallelism, err)
+		}
+		if maxInFlight != tc.want {
+			t.Errorf("parallelism %d: %d nodes at a time, want %d", tc.parallelism, maxInFlight, tc.want)
+		}
+		for i, r := range results {
+			if r.Node != nodes[i] || r.RunResult.Args[0] != nodes[i].Name() {
+				t.Errorf("parallelism %d: result %d is of %s, want %s", tc.parallelism, i, r.RunResult.Args[0], nodes[i].Name())
+			}
+		}
+	}
+}
+
+func TestFanOutCancel(t *testing.T) {
+	nodes, _ := newFanOutNodes(t, 4, func(int, *fake.Runner) {})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var started []string
+	results, err := FanOut(ctx, nodes, 1, func(ctx context.Context, n *Node) (*command.RunResult, error) {
+		started = append(started, n.Name())
+		if n == nodes[1] {
+			cancel()
+		}
+		return nil, nil
+	})
+	if !reflect.DeepEqual(started, []string{"p1-worker0", "p1-worker1"}) {
+		t.Errorf("started %v, want no node started after ctx is cancelled", started)
+	}
+	checkFailedNodes(t, err, 4, "p1-worker2", "p1-worker3")
+	for _, r := range results[2:] {
+		if r.Err != context.Canceled {
+			t.Errorf("%s failed with %v, want %v", r.Node.Name(), r.Err, context.Canceled)
+		}
+	}
+
+	// a fan-out with a done ctx starts no node
+	started = nil
+	_, err = FanOut(ctx, nodes, 0, func(ctx context.Context, n *Node) (*command.RunResult, error) {
+		started = append(started, n.Name())
+		return nil, nil
+	})
+	if len(started) != 0 {
+		t.Errorf("started %v with a done ctx", started)
+	}
+	checkFailedNodes(t, err, 4, "p1-worker0", "p1-worker1", "p1-worker2", "p1-worker3")
+}
+
+func TestRunAll(t *testing.T) {
+	nodes, _ := newFanOutNodes(t, 3, func(i int, r *fake.Runner) {
+		if i == 1 {
+			r.On("hostname").Stderr("hostname: command not found").ExitCode(127)
+			return
+		}
+		r.On("hostname").Stdout(fmt.Sprintf("p1-worker%d\n", i))
+	})
+	results, err := RunAll(context.Background(), nodes, 2, "hostname")
+	checkFailedNodes(t, err, 3, "p1-worker1")
+	if !strings.Contains(err.Error(), "p1-worker1: ") || strings.Contains(err.Error(), "p1-worker0: ") {
+		t.Errorf("error %q should only describe the failure of p1-worker1", err)
+	}
+	for i, r := range results {
+		if i == 1 {
+			if r.Err == nil || r.RunResult.ExitCode != 127 {
+				t.Errorf("result of the failed node = %+v", r)
+			}
+			continue
+		}
+		if r.Err != nil || r.RunResult.Stdout.String() != nodes[i].Name()+"\n" {
+			t.Errorf("result %d = %q %v, want the output of %s", i, r.RunResult.Stdout.String(), r.Err, nodes[i].Name())
+		}
+	}
+
+	if _, err := RunAll(context.Background(), nodes, 0); err == nil {
+		t.Error("RunAll without a command succeeded")
+	}
+}
+
+func TestWriteFileAll(t *testing.T) {
+	const dest = "/kic/kubeadm.conf"
+	nodes, runners := newFanOutNodes(t, 3, func(i int, r *fake.Runner) {
+		r.On("mkdir", "-p", "/kic")
+		r.On("cp", "/dev/stdin", dest)
+		if i == 2 {
+			r.On("chmod", "644", dest).Stderr("Operation not permitted").ExitCode(1)
+			return
+		}
+		r.On("chmod", "644", dest)
+	})
+	err := WriteFileAll(context.Background(), nodes, 0, dest, "kind: ClusterConfiguration\n", "644")
+	checkFailedNodes(t, err, 3, "p1-worker2")
+	for i, r := range runners {
+		var written string
+		for _, c := range r.Calls() {
+			if c.String() == "cp /dev/stdin "+dest {
+				written = string(c.Stdin)
+			}
+		}
+		if written != "kind: ClusterConfiguration\n" {
+			t.Errorf("%s was written %q", nodes[i].Name(), written)
+		}
+	}
+}
+
+func TestLoadImageArchiveAll(t *testing.T) {
+	f, err := ioutil.TempFile("", "image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString("image archive"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	nodes, runners := newFanOutNodes(t, 3, func(i int, r *fake.Runner) {
+		if i == 0 {
+			r.On("ctr", fake.AnyArgs).Error(errors.New("no space left on device"))
+			return
+		}
+		r.On("ctr", "--namespace=k8s.io", "images", "import", "-")
+	})
+	err = LoadImageArchiveAll(context.Background(), nodes, 2, f.Name())
+	checkFailedNodes(t, err, 3, "p1-worker0")
+	// every node reads the whole archive
+	for i, r := range runners {
+		calls := r.Calls()
+		if len(calls) != 1 || string(calls[0].Stdin) != "image archive" {
+			t.Errorf("%s loaded %v", nodes[i].Name(), calls)
+		}
+	}
+
+	err = LoadImageArchiveAll(context.Background(), nodes, 2, f.Name()+".missing")
+	checkFailedNodes(t, err, 3, "p1-worker0", "p1-worker1", "p1-worker2")
+}
+
+// racingEngine removes a network right before it is removed, like another
+// node of the cluster removed at the same time
+type racingEngine struct {
+	*ocifake.Engine
+}
+
+func (r racingEngine) RemoveNetwork(ctx context.Context, name string) error {
+	if err := r.Engine.RemoveNetwork(ctx, name); err != nil {
+		return err
+	}
+	return r.Engine.RemoveNetwork(ctx, name)
+}
+
+func TestRemoveAll(t *testing.T) {
+	ctx := context.Background()
+	e := racingEngine{ocifake.NewEngine()}
+	var nodes []*Node
+	for i := 0; i < 4; i++ {
+		spec := Spec{Name: fmt.Sprintf("p1-worker%d", i), Profile: "p1", Role: WorkerRole, Image: testImage}
+		n, err := spec.CreateContext(ctx, e, fake.NewRunner())
+		if err != nil {
+			t.Fatalf("CreateContext: %v", err)
+		}
+		nodes = append(nodes, n)
+	}
+	_, err := FanOut(ctx, nodes, 0, func(ctx context.Context, n *Node) (*command.RunResult, error) {
+		return nil, n.RemoveContext(ctx)
+	})
+	if err != nil {
+		t.Fatalf("removing the nodes concurrently: %v", err)
+	}
+	if exists, _ := networkExists(ctx, e, NetworkName("p1")); exists {
+		t.Errorf("network %s was left behind", NetworkName("p1"))
+	}
+	// the network is gone already
+	if err := RemoveNetwork(ctx, e, NetworkName("p1")); err != nil {
+		t.Errorf("RemoveNetwork of a removed network = %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+
+	"github.com/medyagh/kic/pkg/oci"
+	"github.com/pkg/errors"
+)
+
+// networkLocks serialize the nodes being created on a network, from
+// allocating their addresses until their container uses them
+var networkLocks = struct {
+	sync.Mutex
+	m map[string]*sync.Mutex
+}{m: map[string]*sync.Mutex{}}
+
+// lockNetwork locks the addresses of a network of e for this process, and
+// returns the func unlocking them. Other processes creating nodes on the
+// network at the same time may still get the same addresses.
+func lockNetwork(e oci.Engine, network string) func() {
+	key := e.Name() + "/" + network
+	networkLocks.Lock()
+	l, ok := networkLocks.m[key]
+	if !ok {
+		l = &sync.Mutex{}
+		networkLocks.m[key] = l
+	}
+	networkLocks.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+// AllocateIP returns a free address of the given family on a network for
+// the node name. A node that already exists keeps the address recorded in
+// its labels, so re-creating it is stable. Addresses recorded by stopped
+// nodes are reserved, even though the engine doesn't report them.
+// The address is free until a container uses it, concurrent creates must be
+// serialized, like Spec.Create does.
+func AllocateIP(ctx context.Context, e oci.Engine, network, name string, ipv6 bool) (string, error) {
+	labelKey := IPv4LabelKey
+	if ipv6 {
+		labelKey = IPv6LabelKey
+	}
+
+	info, err := e.NetworkInfo(ctx, network)
+	if err != nil {
+		return "", err
+	}
+	used := map[string]bool{}
+	for _, gw := range info.Gateways {
+		used[gw] = true
+	}
+	for _, ep := range info.Containers {
+		used[ep.IPv4] = true
+		used[ep.IPv6] = true
+	}
+	// stopped containers are still attached to the network, but have no address
+	names, err := e.ListContainers(ctx, "network="+network)
+	if err != nil {
+		return "", err
+	}
+	for _, n := range names {
+		c, err := e.ContainerInfo(ctx, n)
+		if err != nil {
+			return "", err
+		}
+		if n == name && c.Labels[labelKey] != "" {
+			return c.Labels[labelKey], nil
+		}
+		used[c.Labels[labelKey]] = true
+		if ep, ok := c.Networks[network]; ok {
+			used[ep.IPv4] = true
+			used[ep.IPv6] = true
+		}
+	}
+
+	subnets := 0
+	for _, subnet := range info.Subnets {
+		_, cidr, err := net.ParseCIDR(subnet)
+		if err != nil || (cidr.IP.To4() == nil) != ipv6 {
+			continue
+		}
+		subnets++
+		if ip := freeIP(cidr, used); ip != "" {
+			return ip, nil
+		}
+	}
+	if subnets == 0 {
+		family := "IPv4"
+		if ipv6 {
+			family = "IPv6"
+		}
+		return "", errors.Errorf("network %s has no %s subnet", network, family)
+	}
+	return "", errors.Errorf("no free address on network %s", network)
+}
+
+// freeIP returns the first address of cidr that is not used, skipping the
+// network address (and for IPv4, the broadcast address)
+func freeIP(cidr *net.IPNet, used map[string]bool) string {
+	ones, bits := cidr.Mask.Size()
+	size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+	last := new(big.Int).Sub(size, big.NewInt(1))
+	base := new(big.Int).SetBytes(cidr.IP)
+	// the first address is usually the gateway, start looking after it
+	for i := big.NewInt(2); i.Cmp(last) < 0; i.Add(i, big.NewInt(1)) {
+		ip := addrBytes(new(big.Int).Add(base, i), len(cidr.IP))
+		if s := ip.String(); !used[s] {
+			return s
+		}
+	}
+	return ""
+}
+
+func addrBytes(n *big.Int, size int) net.IP {
+	b := n.Bytes()
+	ip := make(net.IP, size)
+	copy(ip[size-len(b):], b)
+	return ip
+}
+
+// validateIP checks that ip is a valid address of the given family
+func validateIP(ip string, ipv6 bool) error {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || (parsed.To4() == nil) != ipv6 {
+		family := "IPv4"
+		if ipv6 {
+			family = "IPv6"
+		}
+		return fmt.Errorf("invalid %s address %q", family, ip)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/medyagh/kic/pkg/command/fake"
+	"github.com/medyagh/kic/pkg/oci"
+	ocifake "github.com/medyagh/kic/pkg/oci/fake"
+)
+
+// slowEngine takes its time to create containers, like a real engine
+type slowEngine struct {
+	*ocifake.Engine
+}
+
+func (s slowEngine) CreateContainer(ctx context.Context, image string, opts ...oci.CreateOpt) ([]string, error) {
+	time.Sleep(10 * time.Millisecond)
+	return s.Engine.CreateContainer(ctx, image, opts...)
+}
+
+func TestSpecCreateConcurrently(t *testing.T) {
+	ctx := context.Background()
+	e := slowEngine{ocifake.NewEngine()}
+	if _, err := EnsureNetwork(ctx, e, "p1", false); err != nil {
+		t.Fatal(err)
+	}
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			spec := Spec{Name: fmt.Sprintf("p1-worker%d", i), Profile: "p1", Role: WorkerRole, Image: testImage}
+			_, errs[i] = spec.CreateContext(ctx, e, fake.NewRunner())
+		}(i)
+	}
+	wg.Wait()
+	ips := map[string]string{}
+	for i, err := range errs {
+		name := fmt.Sprintf("p1-worker%d", i)
+		if err != nil {
+			t.Fatalf("creating %s: %v", name, err)
+		}
+		info, err := e.ContainerInfo(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ip := info.Labels[IPv4LabelKey]
+		if other, ok := ips[ip]; ok {
+			t.Errorf("%s and %s got the same address %s", name, other, ip)
+		}
+		ips[ip] = name
+	}
+}
+
+// failingIPv6Engine fails to inspect networks for IPv6 allocations
+type failingIPv6Engine struct {
+	*ocifake.Engine
+	calls int
+}
+
+func (f *failingIPv6Engine) NetworkInfo(ctx context.Context, name string) (*oci.NetworkInfo, error) {
+	// the IPv4 address is allocated first
+	if f.calls++; f.calls > 1 {
+		return nil, fmt.Errorf("Error: No such network: %s", name)
+	}
+	return f.Engine.NetworkInfo(ctx, name)
+}
+
+func TestSpecCreateIPv6(t *testing.T) {
+	ctx := context.Background()
+	e := ocifake.NewEngine()
+	if err := e.CreateNetwork(ctx, "dual", oci.NetworkOptions{Subnet: "192.168.49.0/24", IPv6Subnet: "fd00:49::/64"}); err != nil {
+		t.Fatal(err)
+	}
+	spec := Spec{Name: "p1-control-plane", Profile: "p1", Role: WorkerRole, Image: testImage, Network: "dual", IPv6: true}
+	if _, err := spec.CreateContext(ctx, e, fake.NewRunner()); err != nil {
+		t.Fatalf("CreateContext: %v", err)
+	}
+	if info, _ := e.ContainerInfo(ctx, spec.Name); info.Labels[IPv6LabelKey] == "" {
+		t.Errorf("labels = %v, want an IPv6 address", info.Labels)
+	}
+
+	// the profile network is created with an IPv6 subnet
+	spec.Name, spec.Network = "p1-worker", ""
+	if _, err := spec.CreateContext(ctx, e, fake.NewRunner()); err != nil {
+		t.Fatalf("CreateContext on the profile network: %v", err)
+	}
+	if info, _ := e.ContainerInfo(ctx, spec.Name); info.Labels[IPv6LabelKey] == "" {
+		t.Errorf("labels = %v, want an IPv6 address on the profile network", info.Labels)
+	}
+
+	// a network without an IPv6 subnet can't give the node an IPv6 address
+	if err := e.CreateNetwork(ctx, "single", oci.NetworkOptions{Subnet: "10.1.0.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	spec.Name, spec.Network = "p1-worker3", "single"
+	if _, err := spec.CreateContext(ctx, e, fake.NewRunner()); err == nil || !strings.Contains(err.Error(), "no IPv6 subnet") {
+		t.Errorf("CreateContext on a network without an IPv6 subnet = %v, want an error", err)
+	}
+	ipv4Only := Spec{Name: "p2-control-plane", Profile: "p2", Role: WorkerRole, Image: testImage}
+	if _, err := ipv4Only.CreateContext(ctx, e, fake.NewRunner()); err != nil {
+		t.Fatal(err)
+	}
+	spec.Name, spec.Network, spec.Profile = "p2-worker", "", "p2"
+	if _, err := spec.CreateContext(ctx, e, fake.NewRunner()); err == nil || !strings.Contains(err.Error(), "no IPv6 subnet") {
+		t.Errorf("CreateContext on a profile network created without IPv6 = %v, want an error", err)
+	}
+	spec.Profile = "p1"
+
+	broken := &failingIPv6Engine{Engine: e}
+	spec.Name, spec.Network = "p1-worker2", "dual"
+	_, err := spec.CreateContext(ctx, broken, fake.NewRunner())
+	if err == nil || !strings.Contains(err.Error(), "IPv6") {
+		t.Errorf("CreateContext = %v, want the IPv6 allocation error", err)
+	}
+}
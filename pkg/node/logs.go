@@ -0,0 +1,177 @@
+package node
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/medyagh/kic/pkg/command"
+	"github.com/medyagh/kic/pkg/oci"
+	"github.com/pkg/errors"
+)
+
+// Logs returns the output of the node container, which is the output of
+// its init system. The caller must close it.
+func (n *Node) Logs(opts oci.LogsOptions) (io.ReadCloser, error) {
+	return n.LogsContext(context.Background(), opts)
+}
+
+// LogsContext is like Logs but stops streaming when ctx is done
+func (n *Node) LogsContext(ctx context.Context, opts oci.LogsOptions) (io.ReadCloser, error) {
+	return n.engine.Logs(ctx, n.name, opts)
+}
+
+// UnitLogs returns the journald logs of a systemd unit of the node, for
+// example kubelet or containerd. The caller must close it.
+func (n *Node) UnitLogs(unit string, opts oci.LogsOptions) (io.ReadCloser, error) {
+	return n.UnitLogsContext(context.Background(), unit, opts)
+}
+
+// UnitLogsContext is like UnitLogs but stops streaming when ctx is done
+func (n *Node) UnitLogsContext(ctx context.Context, unit string, opts oci.LogsOptions) (io.ReadCloser, error) {
+	args := []string{"journalctl", "--no-pager", "-u", unit}
+	if opts.Follow {
+		args = append(args, "--follow")
+	}
+	if !opts.Since.IsZero() {
+		args = append(args, "--since", "@"+strconv.FormatInt(opts.Since.Unix(), 10))
+	}
+	if opts.Tail > 0 {
+		args = append(args, "--lines", strconv.Itoa(opts.Tail))
+	}
+	if opts.Timestamps {
+		args = append(args, "--output", "short-iso")
+	}
+	return n.stream(ctx, exec.Command(args[0], args[1:]...))
+}
+
+// ContainerLogs returns the logs of the most recent container of the node
+// named name, for example the kube-apiserver or etcd static pods. The
+// caller must close it.
+func (n *Node) ContainerLogs(name string, opts oci.LogsOptions) (io.ReadCloser, error) {
+	return n.ContainerLogsContext(context.Background(), name, opts)
+}
+
+// ContainerLogsContext is like ContainerLogs but stops streaming when ctx is done
+func (n *Node) ContainerLogsContext(ctx context.Context, name string, opts oci.LogsOptions) (io.ReadCloser, error) {
+	cmd := exec.Command("crictl", "ps", "-a", "--quiet", "--latest", "--name", name)
+	rr, err := command.RunCmdContext(ctx, n.R, cmd)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find container %s: %s", name, rr.Output())
+	}
+	id := strings.TrimSpace(rr.Stdout.String())
+	if id == "" {
+		return nil, errors.Errorf("no container %s in node %s", name, n.name)
+	}
+
+	args := []string{"crictl", "logs"}
+	if opts.Follow {
+		args = append(args, "--follow")
+	}
+	if !opts.Since.IsZero() {
+		args = append(args, "--since", opts.Since.Format("2006-01-02T15:04:05Z07:00"))
+	}
+	if opts.Tail > 0 {
+		args = append(args, "--tail", strconv.Itoa(opts.Tail))
+	}
+	if opts.Timestamps {
+		args = append(args, "--timestamps")
+	}
+	args = append(args, id)
+	return n.stream(ctx, exec.Command(args[0], args[1:]...))
+}
+
+// stream runs cmd with the runner of the node in the background and returns
+// its output, closing it cancels the command if the runner supports it. The
+// output is not buffered by the runner, as following logs never ends. A
+// command failing before any output, for example a missing binary, returns
+// its error unless it runs silently for streamStartGrace first.
+func (n *Node) stream(ctx context.Context, cmd *exec.Cmd) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(command.Unbuffered(ctx))
+	pr, pw := io.Pipe()
+	out := &firstWriteWriter{w: pw, written: make(chan struct{})}
+	cmd.Stdout = out
+	// the end of stderr is kept apart to explain failures
+	stderr := &tailBuffer{max: streamStderrMax}
+	cmd.Stderr = stderr
+	done := make(chan error, 1)
+	go func() {
+		_, err := command.RunCmdContext(ctx, n.R, cmd)
+		if err != nil && ctx.Err() == nil {
+			err = errors.Wrapf(err, "%s: %s", strings.Join(cmd.Args, " "), strings.TrimSpace(stderr.String()))
+		}
+		done <- err
+		pw.CloseWithError(err)
+	}()
+
+	select {
+	case <-out.written:
+	case err := <-done:
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+	case <-time.After(streamStartGrace):
+	}
+	return &streamReader{PipeReader: pr, cancel: cancel}, nil
+}
+
+const (
+	// streamStartGrace is how long stream waits for a command to fail
+	// before any output, a silent command is then taken as started
+	streamStartGrace = time.Second
+	// streamStderrMax is how much of the end of the stderr of a streaming
+	// command is kept to explain its failure
+	streamStderrMax = 16 * 1024
+)
+
+// firstWriteWriter writes to w and closes written on the first write
+type firstWriteWriter struct {
+	w       io.Writer
+	once    sync.Once
+	written chan struct{}
+}
+
+func (f *firstWriteWriter) Write(p []byte) (int, error) {
+	f.once.Do(func() { close(f.written) })
+	return f.w.Write(p)
+}
+
+// tailBuffer keeps the last max bytes written to it
+type tailBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+	max int
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if over := len(t.buf) - t.max; over > 0 {
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
+
+// streamReader is the output of a command run by a node, closing it
+// cancels the command
+type streamReader struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+}
+
+func (r *streamReader) Close() error {
+	r.cancel()
+	return r.PipeReader.Close()
+}
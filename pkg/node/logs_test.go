@@ -0,0 +1,120 @@
+package node
+
+import (
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/medyagh/kic/pkg/command/fake"
+	"github.com/medyagh/kic/pkg/oci"
+	"github.com/pkg/errors"
+)
+
+func TestUnitLogs(t *testing.T) {
+	n, _, r := newTestNode(t, func(r *fake.Runner) {
+		r.On("journalctl", fake.AnyArgs).Stdout("Started Kubernetes kubelet.\n")
+	})
+	logs, err := n.UnitLogsContext(context.Background(), "kubelet", oci.LogsOptions{Follow: true, Tail: 10})
+	if err != nil {
+		t.Fatalf("UnitLogsContext: %v", err)
+	}
+	defer logs.Close()
+	out, err := ioutil.ReadAll(logs)
+	if err != nil || string(out) != "Started Kubernetes kubelet.\n" {
+		t.Errorf("logs = %q %v", out, err)
+	}
+	if !r.Called("journalctl", "--no-pager", "-u", "kubelet", "--follow", "--lines", "10") {
+		t.Errorf("calls = %v", r.Calls())
+	}
+}
+
+func TestContainerLogs(t *testing.T) {
+	n, _, r := newTestNode(t, func(r *fake.Runner) {
+		r.On("crictl", "ps", fake.AnyArgs).Stdout("3f2a\n")
+		r.On("crictl", "logs", fake.AnyArgs).Stdout("etcd started\n")
+	})
+	logs, err := n.ContainerLogsContext(context.Background(), "etcd", oci.LogsOptions{Timestamps: true})
+	if err != nil {
+		t.Fatalf("ContainerLogsContext: %v", err)
+	}
+	defer logs.Close()
+	if out, err := ioutil.ReadAll(logs); err != nil || string(out) != "etcd started\n" {
+		t.Errorf("logs = %q %v", out, err)
+	}
+	if !r.Called("crictl", "logs", "--timestamps", "3f2a") {
+		t.Errorf("calls = %v", r.Calls())
+	}
+}
+
+func TestStreamStartFailure(t *testing.T) {
+	n, _, _ := newTestNode(t, func(r *fake.Runner) {
+		r.On("journalctl", fake.AnyArgs).Error(errors.New(`exec: "journalctl": executable file not found in $PATH`))
+		r.On("crictl", "ps", fake.AnyArgs).Stdout("")
+	})
+	if _, err := n.UnitLogsContext(context.Background(), "kubelet", oci.LogsOptions{}); err == nil || !strings.Contains(err.Error(), "executable file not found") {
+		t.Errorf("UnitLogsContext = %v, want the start failure", err)
+	}
+	if _, err := n.ContainerLogsContext(context.Background(), "etcd", oci.LogsOptions{}); err == nil || !strings.Contains(err.Error(), "no container etcd") {
+		t.Errorf("ContainerLogsContext = %v, want the missing container", err)
+	}
+}
+
+func TestStreamFailureAfterOutput(t *testing.T) {
+	n, _, _ := newTestNode(t, func(r *fake.Runner) {
+		r.On("journalctl", fake.AnyArgs).Stdout("-- Logs begin --\n").Stderr("Failed to iterate through journal").ExitCode(1)
+	})
+	logs, err := n.UnitLogsContext(context.Background(), "kubelet", oci.LogsOptions{})
+	if err != nil {
+		t.Fatalf("UnitLogsContext: %v", err)
+	}
+	defer logs.Close()
+	out, err := ioutil.ReadAll(logs)
+	if string(out) != "-- Logs begin --\n" {
+		t.Errorf("logs = %q, want the output before the failure", out)
+	}
+	if err == nil || !strings.Contains(err.Error(), "Failed to iterate through journal") {
+		t.Errorf("reading the logs = %v, want the failure with its stderr", err)
+	}
+}
+
+func TestStreamSilentCommand(t *testing.T) {
+	release := make(chan struct{})
+	n, _, _ := newTestNode(t, func(r *fake.Runner) {
+		r.On("journalctl", fake.AnyArgs).Do(func(cmd *exec.Cmd) error {
+			<-release
+			return nil
+		})
+	})
+	start := time.Now()
+	logs, err := n.UnitLogsContext(context.Background(), "kubelet", oci.LogsOptions{Follow: true})
+	if err != nil {
+		t.Fatalf("UnitLogsContext: %v", err)
+	}
+	if waited := time.Since(start); waited > 5*streamStartGrace {
+		t.Errorf("UnitLogsContext of a silent command returned after %s", waited)
+	}
+	close(release)
+	if out, err := ioutil.ReadAll(logs); err != nil || len(out) != 0 {
+		t.Errorf("logs = %q %v, want none", out, err)
+	}
+	logs.Close()
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{max: 8}
+	for _, s := range []string{"0123", "4567", "89abcdef", "g"} {
+		if n, err := b.Write([]byte(s)); err != nil || n != len(s) {
+			t.Fatalf("Write(%q) = %d %v", s, n, err)
+		}
+	}
+	if got := b.String(); got != "9abcdefg" {
+		t.Errorf("tailBuffer = %q, want the last 8 bytes", got)
+	}
+	b.Write([]byte(strings.Repeat("x", 20) + "end"))
+	if got := b.String(); got != "xxxxxend" {
+		t.Errorf("tailBuffer = %q after a large write, want its last 8 bytes", got)
+	}
+}
@@ -0,0 +1,124 @@
+package node
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/medyagh/kic/pkg/oci"
+	"github.com/pkg/errors"
+)
+
+// NetworkName returns the name of the network dedicated to a profile
+func NetworkName(profile string) string {
+	return "kic-" + profile
+}
+
+// EnsureNetwork creates the network dedicated to a profile if it doesn't
+// exist yet and returns its name. The subnet of the network is a free
+// private subnet that overlaps neither the other networks nor exclude, for
+// example the pod and service subnets of the cluster. With ipv6, which must
+// be set if any node of the cluster has IPv6, the network gets a free IPv6
+// subnet too, and an existing network without one is an error.
+func EnsureNetwork(ctx context.Context, e oci.Engine, profile string, ipv6 bool, exclude ...string) (string, error) {
+	name := NetworkName(profile)
+	exists, err := networkExists(ctx, e, name)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return name, checkIPv6(ctx, e, name, ipv6)
+	}
+	opts := oci.NetworkOptions{
+		Labels: map[string]string{ClusterLabelKey + profile: ""},
+	}
+	if opts.Subnet, err = oci.FreeSubnet(ctx, e, exclude...); err != nil {
+		return "", errors.Wrapf(err, "failed to find a subnet for network %s", name)
+	}
+	if ipv6 {
+		if opts.IPv6Subnet, err = oci.FreeIPv6Subnet(ctx, e, exclude...); err != nil {
+			return "", errors.Wrapf(err, "failed to find an IPv6 subnet for network %s", name)
+		}
+	}
+	if err := e.CreateNetwork(ctx, name, opts); err != nil {
+		// another node of the cluster may have created it in the meantime
+		if exists, _ := networkExists(ctx, e, name); exists {
+			return name, checkIPv6(ctx, e, name, ipv6)
+		}
+		return "", err
+	}
+	return name, nil
+}
+
+// checkIPv6 returns an error if ipv6 is needed but the network has no IPv6
+// subnet, as a subnet can't be added to an existing network
+func checkIPv6(ctx context.Context, e oci.Engine, name string, ipv6 bool) error {
+	if !ipv6 {
+		return nil
+	}
+	info, err := e.NetworkInfo(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, s := range info.Subnets {
+		if ip, _, err := net.ParseCIDR(s); err == nil && ip.To4() == nil {
+			return nil
+		}
+	}
+	return errors.Errorf("network %s has no IPv6 subnet, remove it to create it again with one", name)
+}
+
+// RemoveNetwork removes a network created by EnsureNetwork once no
+// container is attached to it anymore. Other networks are left alone. A
+// network already removed, for example by another node of the cluster
+// removed at the same time, is not an error.
+func RemoveNetwork(ctx context.Context, e oci.Engine, name string) error {
+	if name == "" || name == DefaultNetwork {
+		return nil
+	}
+	info, err := e.NetworkInfo(ctx, name)
+	if oci.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !managedNetwork(info) {
+		return nil
+	}
+	attached, err := e.ListContainers(ctx, "network="+name)
+	if err != nil {
+		return err
+	}
+	if len(attached) > 0 {
+		return nil
+	}
+	if err := e.RemoveNetwork(ctx, name); err != nil && !oci.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// managedNetwork tells if a network was created by kic for a cluster
+func managedNetwork(info *oci.NetworkInfo) bool {
+	for k := range info.Labels {
+		if strings.HasPrefix(k, ClusterLabelKey) {
+			return true
+		}
+	}
+	return false
+}
+
+func networkExists(ctx context.Context, e oci.Engine, name string) (bool, error) {
+	// the name filter matches substrings, look for an exact match
+	names, err := e.ListNetworks(ctx, "name="+name)
+	if err != nil {
+		return false, err
+	}
+	for _, n := range names {
+		if n == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -1,27 +1,55 @@
 package node
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/docker/machine/libmachine/state"
 	"github.com/medyagh/kic/pkg/assets"
 	"github.com/medyagh/kic/pkg/command"
 	"github.com/medyagh/kic/pkg/config/cri"
+	"github.com/medyagh/kic/pkg/config/resource"
 	"github.com/medyagh/kic/pkg/oci"
 
 	"github.com/pkg/errors"
 )
 
+const (
+	// readyTimeout is how long to wait for a started node to be ready,
+	// unless the ReadyTimeout option is given
+	readyTimeout = 2 * time.Minute
+	// readyPollInterval is how often to check if a started node is ready
+	readyPollInterval = 500 * time.Millisecond
+)
+
 const (
 	// Docker default bridge network is named "bridge" (https://docs.docker.com/network/bridge/#use-the-default-bridge-network)
 	DefaultNetwork  = "bridge"
 	ClusterLabelKey = "io.k8s.sigs.kic.cluster" // ClusterLabelKey is applied to each node docker container for identification
 	NodeRoleKey     = "io.k8s.sigs.kic.role"
-	DefaultOci      = "docker"
+	// NetworkLabelKey is applied to each node container with the name of the network it is attached to
+	NetworkLabelKey = "io.k8s.sigs.kic.network"
+	// IPv4LabelKey and IPv6LabelKey record the static addresses of a node on its network
+	IPv4LabelKey = "io.k8s.sigs.kic.ipv4"
+	IPv6LabelKey = "io.k8s.sigs.kic.ipv6"
+	// VolumeLabelKey records the name of the volume holding the /var of a node
+	VolumeLabelKey = "io.k8s.sigs.kic.volume"
+)
+
+const (
+	// ControlPlaneRole is the role of the nodes running the api server, the
+	// first one initializes the cluster
+	ControlPlaneRole = "control-plane"
+	// WorkerRole is the role of the nodes joining the cluster to run workloads
+	WorkerRole = "worker"
+	// ExternalLoadBalancerRole is the role of the node balancing the api
+	// server of a cluster with several control planes
+	ExternalLoadBalancerRole = "external-load-balancer"
 )
 
 // Node represents a handle to a kic node
@@ -31,14 +59,21 @@ type Node struct {
 	name string
 	// cached node info etc.
 	cache *nodeCache
-	R     command.Runner // Runner
+	// the container engine the node is running on
+	engine oci.Engine
+	R      command.Runner // Runner
 }
 
 // WriteFile writes content to dest on the node
 func (n *Node) WriteFile(dest, content string, perm string) error {
+	return n.WriteFileContext(context.Background(), dest, content, perm)
+}
+
+// WriteFileContext is like WriteFile but stops writing when ctx is done
+func (n *Node) WriteFileContext(ctx context.Context, dest, content string, perm string) error {
 	// create destination directory
 	cmd := exec.Command("mkdir", "-p", filepath.Dir(dest))
-	rr, err := n.R.RunCmd(cmd)
+	rr, err := command.RunCmdContext(ctx, n.R, cmd)
 	if err != nil {
 		return errors.Wrapf(err, "failed to create directory %s cmd: %v output:%q", cmd.Args, dest, rr.Output())
 	}
@@ -46,12 +81,12 @@ func (n *Node) WriteFile(dest, content string, perm string) error {
 	cmd = exec.Command("cp", "/dev/stdin", dest)
 	cmd.Stdin = strings.NewReader(content)
 
-	if rr, err := n.R.RunCmd(cmd); err != nil {
+	if rr, err := command.RunCmdContext(ctx, n.R, cmd); err != nil {
 		return errors.Wrapf(err, "failed to run: cp /dev/stdin %s cmd: %v output:%q", dest, cmd.Args, rr.Output())
 	}
 
 	cmd = exec.Command("chmod", perm, dest)
-	_, err = n.R.RunCmd(cmd)
+	_, err = command.RunCmdContext(ctx, n.R, cmd)
 	if err != nil {
 		return errors.Wrapf(err, "failed to run: chmod %s %s", perm, dest)
 	}
@@ -60,93 +95,319 @@ func (n *Node) WriteFile(dest, content string, perm string) error {
 
 // IP returns the IP address of the node
 func (n *Node) IP() (ipv4 string, ipv6 string, err error) {
+	return n.IPContext(context.Background())
+}
+
+// IPContext is like IP but gives up inspecting the node when ctx is done
+func (n *Node) IPContext(ctx context.Context) (ipv4 string, ipv6 string, err error) {
 	// use the cached version first
 	cachedIPv4, cachedIPv6 := n.cache.IP()
-	if cachedIPv4 != "" && cachedIPv6 != "" {
+	if cachedIPv4 != "" || cachedIPv6 != "" {
 		return cachedIPv4, cachedIPv6, nil
 	}
-	// retrieve the IP address of the node using docker inspect
-	lines, err := oci.Inspect(n.name, "{{range .NetworkSettings.Networks}}{{.IPAddress}},{{.GlobalIPv6Address}}{{end}}")
+	info, err := n.refresh(ctx)
 	if err != nil {
-		return "", "", errors.Wrap(err, "failed to get container details")
+		return "", "", err
 	}
-	if len(lines) != 1 {
-		return "", "", errors.Errorf("file should only be one line, got %d lines", len(lines))
+	return info.IP(nodeNetwork(info))
+}
+
+// nodeNetwork returns the network a node container is attached to
+func nodeNetwork(info *oci.ContainerInfo) string {
+	if network := info.Labels[NetworkLabelKey]; network != "" {
+		return network
 	}
-	ips := strings.Split(lines[0], ",")
-	if len(ips) != 2 {
-		return "", "", errors.Errorf("container addresses should have 2 values, got %d values", len(ips))
+	return DefaultNetwork
+}
+
+// refresh inspects the node container and updates the node cache with the result
+func (n *Node) refresh(ctx context.Context) (*oci.ContainerInfo, error) {
+	info, err := n.engine.ContainerInfo(ctx, n.name)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get container details")
 	}
 	n.cache.set(func(cache *nodeCache) {
-		cache.ipv4 = ips[0]
-		cache.ipv6 = ips[1]
+		cache.network = nodeNetwork(info)
+		cache.ipv4, cache.ipv6, _ = info.IP(cache.network)
+		// a stopped node has no address, but keeps its static one once started
+		if cache.ipv4 == "" {
+			cache.ipv4 = info.Labels[IPv4LabelKey]
+		}
+		if cache.ipv6 == "" {
+			cache.ipv6 = info.Labels[IPv6LabelKey]
+		}
+		cache.ports = map[int32]int32{}
+		for _, pm := range info.Ports {
+			cache.ports[pm.ContainerPort] = pm.HostPort
+		}
+		cache.role = info.Labels[NodeRoleKey]
+		cache.volume = info.Labels[VolumeLabelKey]
 	})
-	return ips[0], ips[1], nil
+	return info, nil
 }
 
 // LoadImageArchive loads an image from archive into the node
 func (n *Node) LoadImageArchive(image io.Reader) error {
+	return n.LoadImageArchiveContext(context.Background(), image)
+}
+
+// LoadImageArchiveContext is like LoadImageArchive but stops loading when ctx is done
+func (n *Node) LoadImageArchiveContext(ctx context.Context, image io.Reader) error {
 	cmd := exec.Command(
 		"ctr", "--namespace=k8s.io", "images", "import", "-",
 	)
 	cmd.Stdin = image
-	if _, err := n.R.RunCmd(cmd); err != nil {
+	if _, err := command.RunCmdContext(ctx, n.R, cmd); err != nil {
 		return errors.Wrap(err, "failed to load image")
 	}
 	return nil
 }
 
 // Copy copies a local asset into the node
-func (n *Node) Copy(ociBinary string, asset assets.CopyAsset) error {
-	if err := oci.Copy(ociBinary, n.name, asset); err != nil {
+func (n *Node) Copy(asset assets.CopyAsset) error {
+	return n.CopyContext(context.Background(), asset)
+}
+
+// CopyContext is like Copy but stops copying when ctx is done
+func (n *Node) CopyContext(ctx context.Context, asset assets.CopyAsset) error {
+	if err := n.engine.Copy(ctx, n.name, asset); err != nil {
 		return errors.Wrap(err, "failed to copy file/folder")
 	}
 
 	cmd := exec.Command("chmod", asset.Permissions, asset.TargetPath())
-	if _, err := n.R.RunCmd(cmd); err != nil {
+	if _, err := command.RunCmdContext(ctx, n.R, cmd); err != nil {
 		return errors.Wrap(err, "failed to chmod file permissions")
 	}
 	return nil
 }
 
+// Engine returns the container engine the node is running on
+func (n *Node) Engine() oci.Engine {
+	return n.engine
+}
+
 // Status gets status for node
 func (n *Node) Status() (state.State, error) {
-	return oci.Status(DefaultOci, n.name)
+	return n.StatusContext(context.Background())
+}
+
+// StatusContext is like Status but gives up inspecting the node when ctx is done
+func (n *Node) StatusContext(ctx context.Context) (state.State, error) {
+	info, err := n.refresh(ctx)
+	if err != nil {
+		return state.Error, err
+	}
+	return info.MachineState(), nil
+}
+
+// State returns the complete container state of the node
+func (n *Node) State() (oci.ContainerState, error) {
+	return n.StateContext(context.Background())
+}
+
+// StateContext is like State but gives up inspecting the node when ctx is done
+func (n *Node) StateContext(ctx context.Context) (oci.ContainerState, error) {
+	info, err := n.refresh(ctx)
+	if err != nil {
+		return oci.ContainerState{}, err
+	}
+	return info.State, nil
 }
 
 // Pause pauses all process in the node
 func (n *Node) Pause() error {
-	return oci.Pause(DefaultOci, n.name)
+	return n.PauseContext(context.Background())
+}
+
+// PauseContext is like Pause but gives up when ctx is done
+func (n *Node) PauseContext(ctx context.Context) error {
+	return n.engine.Pause(ctx, n.name)
 }
 
 // Stop stops the node
 func (n *Node) Stop() error {
-	return oci.Stop(n.name)
+	return n.StopContext(context.Background())
+}
+
+// StopContext is like Stop but gives up when ctx is done
+func (n *Node) StopContext(ctx context.Context) error {
+	return n.engine.Stop(ctx, n.name)
+}
+
+// startOpts are the options of Node.Start, Unpause and Restart
+type startOpts struct {
+	ReadyTimeout time.Duration
+}
+
+// StartOpt is an option of Node.Start, Unpause and Restart
+type StartOpt func(*startOpts) *startOpts
+
+// ReadyTimeout sets how long to wait for the node to be ready, two minutes
+// by default
+func ReadyTimeout(timeout time.Duration) StartOpt {
+	return func(s *startOpts) *startOpts {
+		s.ReadyTimeout = timeout
+		return s
+	}
+}
+
+// Start starts a stopped node and waits for it to be ready
+func (n *Node) Start(opts ...StartOpt) error {
+	return n.StartContext(context.Background(), opts...)
+}
+
+// StartContext is like Start but gives up when ctx is done
+func (n *Node) StartContext(ctx context.Context, opts ...StartOpt) error {
+	if err := n.engine.Start(ctx, n.name); err != nil {
+		return err
+	}
+	return n.waitReady(ctx, opts)
 }
 
-// Remove removes the node
-func (n *Node) Remove() error {
-	return oci.Remove(DefaultOci, n.name)
+// Unpause resumes all processes in a paused node and waits for it to be ready
+func (n *Node) Unpause(opts ...StartOpt) error {
+	return n.UnpauseContext(context.Background(), opts...)
+}
+
+// UnpauseContext is like Unpause but gives up when ctx is done
+func (n *Node) UnpauseContext(ctx context.Context, opts ...StartOpt) error {
+	if err := n.engine.Unpause(ctx, n.name); err != nil {
+		return err
+	}
+	return n.waitReady(ctx, opts)
+}
+
+// Restart restarts the node and waits for it to be ready
+func (n *Node) Restart(opts ...StartOpt) error {
+	return n.RestartContext(context.Background(), opts...)
+}
+
+// RestartContext is like Restart but gives up when ctx is done
+func (n *Node) RestartContext(ctx context.Context, opts ...StartOpt) error {
+	if err := n.engine.Restart(ctx, n.name); err != nil {
+		return err
+	}
+	return n.waitReady(ctx, opts)
+}
+
+// waitReady waits for systemd and containerd in the node to be up, then
+// refreshes the node cache as addresses may have changed
+func (n *Node) waitReady(ctx context.Context, opts []StartOpt) error {
+	o := &startOpts{ReadyTimeout: readyTimeout}
+	for _, opt := range opts {
+		o = opt(o)
+	}
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, o.ReadyTimeout)
+	defer cancel()
+	checks := [][]string{
+		// degraded means some unit failed, but the system is up
+		{"sh", "-c", `s=$(systemctl is-system-running); [ "$s" = running ] || [ "$s" = degraded ]`},
+		{"systemctl", "is-active", "--quiet", "containerd"},
+	}
+	for _, check := range checks {
+		// the last failure of the check, rather than the one the timeout interrupted
+		var lastErr error
+		var lastOutput string
+		for {
+			rr, err := command.RunCmdContext(ctx, n.R, exec.Command(check[0], check[1:]...))
+			if err == nil {
+				break
+			}
+			if ctx.Err() == nil || lastErr == nil {
+				lastErr = err
+				if rr != nil {
+					lastOutput = rr.Output()
+				}
+			}
+			select {
+			case <-ctx.Done():
+				if parent.Err() != nil {
+					return errors.Wrapf(parent.Err(), "waiting for node %s to be ready", n.name)
+				}
+				return errors.Wrapf(lastErr, "node %s not ready after %s, %q still fails with output %q",
+					n.name, o.ReadyTimeout, strings.Join(check, " "), lastOutput)
+			case <-time.After(readyPollInterval):
+			}
+		}
+	}
+	_, err := n.refresh(ctx)
+	return err
+}
+
+// Remove removes the node, and the volume holding its /var unless the
+// KeepVolume option is given. The ReleasePorts option releases its host ports.
+func (n *Node) Remove(opts ...RemoveOpt) error {
+	return n.RemoveContext(context.Background(), opts...)
+}
+
+// RemoveContext is like Remove but gives up when ctx is done
+func (n *Node) RemoveContext(ctx context.Context, opts ...RemoveOpt) error {
+	o := &removeOpts{}
+	for _, opt := range opts {
+		o = opt(o)
+	}
+	if err := n.engine.Remove(ctx, n.name); err != nil {
+		return err
+	}
+	if volume := n.cache.Volume(); volume != "" && !o.KeepVolume {
+		if err := n.engine.RemoveVolume(ctx, volume); err != nil {
+			return errors.Wrapf(err, "failed to remove volume of node %s", n.name)
+		}
+	}
+	if o.Ports != nil {
+		if err := o.Ports.ReleaseNode(o.Profile, n.name); err != nil {
+			return errors.Wrapf(err, "failed to release the ports of node %s", n.name)
+		}
+	}
+	// the last node of a cluster cleans up the cluster network
+	if err := RemoveNetwork(ctx, n.engine, n.cache.Network()); err != nil {
+		return errors.Wrapf(err, "failed to remove network of node %s", n.name)
+	}
+	return nil
 }
 
 type CreateParams struct {
 	Name         string // used for container name and hostname
 	Image        string // container image to use to create the node.
 	ClusterLabel string
-	Role         string // currently only role supported is control-plane
+	Role         string // ControlPlaneRole, WorkerRole or ExternalLoadBalancerRole
 	Mounts       []cri.Mount
 	PortMappings []cri.PortMapping
-	Cpus         string
-	Memory       string
+	Cpus         resource.CPUs   // zero means unlimited
+	Memory       resource.Memory // zero means unlimited
 	Envs         map[string]string
 	ExtraArgs    []string
+	// Network to attach the node to, the default bridge network if empty
+	Network string
+	// IPv4 and IPv6 are static addresses of the node on Network, which
+	// must then be a user-defined network
+	IPv4 string
+	IPv6 string
+	// Volume is a named volume to mount on /var, which keeps the state of
+	// the node when its container is removed
+	Volume string
+	// ConflictPolicy is what to do when a container with the same name exists
+	ConflictPolicy oci.ConflictPolicy
 }
 
-// todo use a struct for this
-func CreateNode(p CreateParams, cmder command.Runner) (*Node, error) {
+// CreateNode creates a node container on the engine
+func CreateNode(e oci.Engine, p CreateParams, cmder command.Runner) (*Node, error) {
+	return CreateNodeContext(context.Background(), e, p, cmder)
+}
+
+// CreateNodeContext is like CreateNode but gives up creating the node when ctx is done
+func CreateNodeContext(ctx context.Context, e oci.Engine, p CreateParams, cmder command.Runner) (*Node, error) {
+	// fail early rather than deep inside "docker run"
+	host, err := e.HostCapacity(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the container engine capacity")
+	}
+	if err := resource.Validate(p.Cpus, p.Memory, host); err != nil {
+		return nil, errors.Wrapf(err, "invalid resources for node %s", p.Name)
+	}
+
 	runArgs := []string{
-		fmt.Sprintf("--cpus=%s", p.Cpus),
-		fmt.Sprintf("--memory=%s", p.Memory),
 		"-d", // run the container detached
 		"-t", // allocate a tty for entrypoint logs
 		// running containers in a container requires privileged
@@ -161,28 +422,58 @@ func CreateNode(p CreateParams, cmder command.Runner) (*Node, error) {
 		// some k8s things want /lib/modules
 		"-v", "/lib/modules:/lib/modules:ro",
 		"--hostname", p.Name, // make hostname match container name
-		"--name", p.Name, // ... and set the container name
-		// label the node with the cluster ID
-		"--label", p.ClusterLabel,
-		// label the node with the role ID
-		"--label", fmt.Sprintf("%s=%s", NodeRoleKey, p.Role),
+	}
+	if p.Cpus > 0 {
+		runArgs = append(runArgs, fmt.Sprintf("--cpus=%s", p.Cpus))
+	}
+	if p.Memory > 0 {
+		runArgs = append(runArgs, fmt.Sprintf("--memory=%s", p.Memory))
 	}
 
 	for key, val := range p.Envs {
 		runArgs = append(runArgs, "-e", fmt.Sprintf("%s=%s", key, val))
 	}
 
+	network := p.Network
+	if network == "" {
+		network = DefaultNetwork
+	}
+	runArgs = append(runArgs, "--network", network)
+	labels := map[string]string{
+		// label the node with the cluster ID
+		p.ClusterLabel: "",
+		// label the node with the role ID
+		NodeRoleKey: p.Role,
+		// label the node with the network it is attached to
+		NetworkLabelKey: network,
+	}
+	if p.IPv4 != "" {
+		runArgs = append(runArgs, "--ip", p.IPv4)
+		labels[IPv4LabelKey] = p.IPv4
+	}
+	if p.IPv6 != "" {
+		runArgs = append(runArgs, "--ip6", p.IPv6)
+		labels[IPv6LabelKey] = p.IPv6
+	}
+	if p.Volume != "" {
+		runArgs = append(runArgs, "-v", p.Volume+":/var")
+		labels[VolumeLabelKey] = p.Volume
+	}
+
 	// adds node specific args
 	runArgs = append(runArgs, p.ExtraArgs...)
 
-	if oci.UsernsRemap() {
+	if e.UsernsRemap(ctx) {
 		// We need this argument in order to make this command work
 		// in systems that have userns-remap enabled on the docker daemon
 		runArgs = append(runArgs, "--userns=host")
 	}
 
-	_, err := oci.CreateContainer(DefaultOci,
+	_, err = e.CreateContainer(ctx,
 		p.Image,
+		oci.WithName(p.Name), // ... and set the container name
+		oci.WithLabels(labels),
+		oci.WithConflictPolicy(p.ConflictPolicy),
 		oci.WithRunArgs(runArgs...),
 		oci.WithMounts(p.Mounts),
 		oci.WithPortMappings(p.PortMappings),
@@ -193,7 +484,7 @@ func CreateNode(p CreateParams, cmder command.Runner) (*Node, error) {
 	}
 
 	// we should return a handle so the caller can clean it up
-	node, err := Find(p.Name, cmder)
+	node, err := FindContext(ctx, e, p.Name, cmder)
 	if err != nil {
 		return node, errors.Wrap(err, "find node")
 	}
@@ -202,14 +493,20 @@ func CreateNode(p CreateParams, cmder command.Runner) (*Node, error) {
 }
 
 // Find finds a node
-func Find(name string, cmder command.Runner) (*Node, error) {
-	_, err := oci.Inspect(name, "{{.Id}}")
-	if err != nil {
+func Find(e oci.Engine, name string, cmder command.Runner) (*Node, error) {
+	return FindContext(context.Background(), e, name, cmder)
+}
+
+// FindContext is like Find but gives up looking for the node when ctx is done
+func FindContext(ctx context.Context, e oci.Engine, name string, cmder command.Runner) (*Node, error) {
+	n := &Node{
+		name:   name,
+		cache:  &nodeCache{},
+		engine: e,
+		R:      cmder,
+	}
+	if _, err := n.refresh(ctx); err != nil {
 		return nil, fmt.Errorf("can't find node %v", err)
 	}
-	return &Node{
-		name:  name,
-		cache: &nodeCache{},
-		R:     cmder,
-	}, nil
+	return n, nil
 }
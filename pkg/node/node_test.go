@@ -0,0 +1,114 @@
+package node
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/libmachine/state"
+	"github.com/medyagh/kic/pkg/command/fake"
+	ocifake "github.com/medyagh/kic/pkg/oci/fake"
+	"github.com/pkg/errors"
+)
+
+// newTestNode creates a running worker node on a FakeEngine, its runner
+// answering the readiness checks with the responses added by ready
+func newTestNode(t *testing.T, ready func(r *fake.Runner)) (*Node, *ocifake.Engine, *fake.Runner) {
+	t.Helper()
+	e := ocifake.NewEngine()
+	r := fake.NewRunner()
+	ready(r)
+	spec := Spec{Name: "p1-worker", Profile: "p1", Role: WorkerRole, Image: testImage}
+	n, err := spec.CreateContext(context.Background(), e, r)
+	if err != nil {
+		t.Fatalf("CreateContext: %v", err)
+	}
+	return n, e, r
+}
+
+// systemReady answers the readiness checks of a node that is up
+func systemReady(r *fake.Runner) {
+	r.On("sh", "-c", "*").Stdout("running")
+	r.On("systemctl", "is-active", "--quiet", "containerd")
+}
+
+func TestStartRunning(t *testing.T) {
+	n, e, r := newTestNode(t, systemReady)
+	if err := n.StartContext(context.Background()); err != nil {
+		t.Fatalf("StartContext of a running node: %v", err)
+	}
+	if st, _ := e.Status(context.Background(), n.Name()); st != state.Running {
+		t.Errorf("status = %s, want Running", st)
+	}
+	if !r.Called("systemctl", "is-active", "--quiet", "containerd") {
+		t.Errorf("containerd readiness was not checked, calls: %v", r.Calls())
+	}
+}
+
+func TestUnpause(t *testing.T) {
+	ctx := context.Background()
+	n, e, _ := newTestNode(t, systemReady)
+	if err := e.Pause(ctx, n.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.UnpauseContext(ctx); err != nil {
+		t.Fatalf("UnpauseContext: %v", err)
+	}
+	if st, _ := e.Status(ctx, n.Name()); st != state.Running {
+		t.Errorf("status = %s, want Running", st)
+	}
+	if err := n.UnpauseContext(ctx); err == nil {
+		t.Error("UnpauseContext of a running node succeeded")
+	}
+}
+
+func TestRestartWaitsForSystemd(t *testing.T) {
+	n, _, r := newTestNode(t, func(r *fake.Runner) {
+		r.On("sh", "-c", "*").Stdout("starting").ExitCode(1).Times(1)
+		systemReady(r)
+	})
+	if err := n.RestartContext(context.Background()); err != nil {
+		t.Fatalf("RestartContext: %v", err)
+	}
+	checks := 0
+	for _, c := range r.Calls() {
+		if c.Args[0] == "sh" {
+			checks++
+		}
+	}
+	if checks != 2 {
+		t.Errorf("systemd was checked %d times, want 2 until it is running", checks)
+	}
+}
+
+func TestStartReadyTimeout(t *testing.T) {
+	n, _, _ := newTestNode(t, func(r *fake.Runner) {
+		r.On("sh", "-c", "*").Stderr("Failed to connect to bus").ExitCode(1)
+	})
+	start := time.Now()
+	err := n.StartContext(context.Background(), ReadyTimeout(100*time.Millisecond))
+	if err == nil {
+		t.Fatal("StartContext of a node that never gets ready succeeded")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("StartContext took %s, want it to give up after the ready timeout", time.Since(start))
+	}
+	for _, want := range []string{"p1-worker", "not ready after 100ms", "systemctl is-system-running", "Failed to connect to bus"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestStartCancel(t *testing.T) {
+	n, _, _ := newTestNode(t, func(r *fake.Runner) {
+		r.On("sh", "-c", "*").ExitCode(1)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	err := n.StartContext(ctx)
+	if errors.Cause(err) != context.Canceled {
+		t.Errorf("StartContext = %v, want it to stop when ctx is cancelled", err)
+	}
+}
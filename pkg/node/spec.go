@@ -1,14 +1,14 @@
 package node
 
 import (
-	"bufio"
-	"bytes"
+	"context"
 	"fmt"
-	"os/exec"
-	"strings"
 
 	"github.com/medyagh/kic/pkg/command"
 	"github.com/medyagh/kic/pkg/config/cri"
+	"github.com/medyagh/kic/pkg/config/resource"
+	"github.com/medyagh/kic/pkg/oci"
+	"github.com/medyagh/kic/pkg/ports"
 	"github.com/pkg/errors"
 )
 
@@ -17,96 +17,211 @@ import (
 type Spec struct {
 	Name              string
 	Profile           string
-	Role              string
-	Image             string // for example  4000mb based on https://docs.docker.com/config/containers/resource_constraints/
-	CPUs              string // for example 2
-	Memory            string
+	Role              string // ControlPlaneRole, WorkerRole or ExternalLoadBalancerRole
+	Image             string
+	CPUs              string // for example 2, 1.5 or 1500m, defaults to DefaultResources of the role
+	Memory            string // for example 2000m, 4g or 4Gi, defaults to DefaultResources of the role
 	ExtraMounts       []cri.Mount
 	ExtraPortMappings []cri.PortMapping
-	APIServerPort     int32
-	APIServerAddress  string
-	IPv6              bool
-	Envs              map[string]string // environment variables to be passsed to passed to create nodes
+	// APIServerPort is the host port the api server is published on by a
+	// control plane or the external load balancer. The control planes behind
+	// a load balancer leave it 0, only the load balancer publishes it.
+	APIServerPort    int32
+	APIServerAddress string
+	// IPv6 gives the node an IPv6 address, the profile network is then
+	// created with an IPv6 subnet. As a subnet can't be added to an existing
+	// network, the first node of a cluster must set it if any node does.
+	IPv6 bool
+	Envs map[string]string // environment variables to be passsed to passed to create nodes
+	// Network to attach the node to, by default a network dedicated to the profile
+	Network string
+	// PodSubnet and ServiceSubnet of the cluster, the subnet of the profile
+	// network is chosen not to overlap them
+	PodSubnet     string
+	ServiceSubnet string
+	// IPAddress is the static IPv4 address of the node on its network, which
+	// keeps it across restarts. It is allocated when empty, unless the node
+	// is on the default bridge network which doesn't support static addresses.
+	IPAddress string
+	// IPv6Address is the static IPv6 address of the node, it is allocated
+	// when empty if IPv6 is set, failing if the network has no IPv6 subnet
+	IPv6Address string
+	// PersistVar mounts a named volume on /var, so the etcd data, images and
+	// persistent volumes of the node survive removing and creating it again
+	PersistVar bool
+	// ConflictPolicy is what to do when a node container with the same name
+	// exists, by default creating the node fails
+	ConflictPolicy oci.ConflictPolicy
+	// Ports reserves the host ports of ExtraPortMappings for the profile,
+	// allocating one to the mappings without. The api server port is
+	// reserved by the caller. Nothing is reserved when nil.
+	Ports *ports.Allocator
 }
 
-func (d *Spec) Create(cmder command.Runner) (node *Node, err error) {
-	params := CreateParams{
-		Name:         d.Name,
-		Image:        d.Image,
-		ClusterLabel: ClusterLabelKey + d.Profile,
-		Mounts:       d.ExtraMounts,
-		PortMappings: d.ExtraPortMappings,
-		Cpus:         d.CPUs,
-		Memory:       d.Memory,
-		Envs:         d.Envs,
-		ExtraArgs:    []string{"--expose", fmt.Sprintf("%d", d.APIServerPort)},
-	}
+// Create creates the node described by the spec on the container engine
+func (d *Spec) Create(e oci.Engine, cmder command.Runner) (node *Node, err error) {
+	return d.CreateContext(context.Background(), e, cmder)
+}
 
-	switch d.Role {
-	case "control-plane":
-		params.PortMappings = append(params.PortMappings, cri.PortMapping{
-			ListenAddress: d.APIServerAddress,
-			HostPort:      d.APIServerPort,
-			ContainerPort: 6443,
-		})
-		node, err = CreateNode(
-			params,
-			cmder,
-		)
+// CreateContext is like Create but gives up creating the node when ctx is done
+func (d *Spec) CreateContext(ctx context.Context, e oci.Engine, cmder command.Runner) (node *Node, err error) {
+	network := d.Network
+	if network == "" {
+		var exclude []string
+		for _, s := range []string{d.PodSubnet, d.ServiceSubnet} {
+			if s != "" {
+				exclude = append(exclude, s)
+			}
+		}
+		network, err = EnsureNetwork(ctx, e, d.Profile, d.IPv6, exclude...)
 		if err != nil {
-			return node, err
+			return nil, errors.Wrap(err, "failed to create the cluster network")
 		}
+	}
+
+	cpus, memory, err := d.resources()
+	if err != nil {
+		return nil, err
+	}
 
-		// stores the port mapping into the node internal state
-		node.cache.set(func(cache *nodeCache) {
-			cache.ports = map[int32]int32{6443: d.APIServerPort}
-		})
-		return node, nil
+	if network != DefaultNetwork {
+		// the allocated addresses are free until the container is created
+		unlock := lockNetwork(e, network)
+		defer unlock()
+	}
+	ipv4, ipv6, err := d.addresses(ctx, e, network)
+	if err != nil {
+		return nil, err
+	}
 
+	mappings := d.ExtraPortMappings
+	if d.Ports != nil && len(mappings) > 0 {
+		if mappings, err = d.Ports.ReserveMappings(d.Profile, d.Name, mappings); err != nil {
+			return nil, errors.Wrapf(err, "failed to reserve the host ports of node %s", d.Name)
+		}
+	}
+
+	var volume string
+	if d.PersistVar {
+		if volume, err = EnsureVolume(ctx, e, d.Name, ClusterLabelKey+d.Profile); err != nil {
+			return nil, err
+		}
+	}
+
+	params := CreateParams{
+		Name:           d.Name,
+		Image:          d.Image,
+		ClusterLabel:   ClusterLabelKey + d.Profile,
+		Role:           d.Role,
+		Mounts:         d.ExtraMounts,
+		PortMappings:   mappings,
+		Cpus:           cpus,
+		Memory:         memory,
+		Envs:           d.Envs,
+		Network:        network,
+		IPv4:           ipv4,
+		IPv6:           ipv6,
+		Volume:         volume,
+		ConflictPolicy: d.ConflictPolicy,
+	}
+
+	switch d.Role {
+	case ControlPlaneRole, ExternalLoadBalancerRole:
+		// the load balancer listens on the api server port too, the control
+		// planes behind it are not published
+		if d.APIServerPort != 0 {
+			params.ExtraArgs = []string{"--expose", fmt.Sprintf("%d", d.APIServerPort)}
+			params.PortMappings = append(params.PortMappings, cri.PortMapping{
+				ListenAddress: d.APIServerAddress,
+				HostPort:      d.APIServerPort,
+				ContainerPort: 6443,
+			})
+		}
+	case WorkerRole:
+		// workers only reach the api server on the cluster network
 	default:
 		return nil, fmt.Errorf("unknown node role: %s", d.Role)
 	}
+	return CreateNodeContext(ctx, e, params, cmder)
 }
 
-// ListNodes lists all the nodes (containers) created by kic on the system
-func (d *Spec) ListNodes() ([]string, error) {
-	args := []string{
-		"ps",
-		"-q",         // quiet output for parsing
-		"-a",         // show stopped nodes
-		"--no-trunc", // don't truncate
-		// filter for nodes with the cluster label
-		"--filter", "label=" + ClusterLabelKey + d.Profile,
-		// format to include friendly name and the cluster name
-		"--format", fmt.Sprintf(`{{.Names}}\t{{.Label "%s"}}`, ClusterLabelKey+d.Profile),
-	}
-	cmd := exec.Command("docker", args...)
-
-	var buff bytes.Buffer
-	cmd.Stdout = &buff
-	cmd.Stderr = &buff
-	err := cmd.Run()
-	if err != nil {
-		return nil, errors.Wrap(err, fmt.Sprintf("failed to list containers for %s", d.Profile))
-
+// DefaultResources returns the resources of a node of a role, used when the
+// spec doesn't set them. kubeadm needs at least 2 CPUs on control planes.
+func DefaultResources(role string) (resource.CPUs, resource.Memory) {
+	if role == ControlPlaneRole {
+		return 2, 2 * resource.GiB
 	}
+	return 1, 1 * resource.GiB
+}
 
-	lines := []string{}
-	scanner := bufio.NewScanner(&buff)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+// resources parses the resources of the spec, defaulting to the ones of its role
+func (d *Spec) resources() (cpus resource.CPUs, memory resource.Memory, err error) {
+	cpus, memory = DefaultResources(d.Role)
+	if d.CPUs != "" {
+		if cpus, err = resource.ParseCPUs(d.CPUs); err != nil {
+			return 0, 0, errors.Wrapf(err, "node %s", d.Name)
+		}
 	}
+	if d.Memory != "" {
+		if memory, err = resource.ParseMemory(d.Memory); err != nil {
+			return 0, 0, errors.Wrapf(err, "node %s", d.Name)
+		}
+	}
+	return cpus, memory, nil
+}
 
-	names := []string{}
-	for _, line := range lines {
-		parts := strings.Split(line, "\t")
-		if len(parts) != 2 {
-			return nil, errors.Errorf("invalid output when listing containers: %s", line)
-
+// addresses returns the static addresses of the node on network
+func (d *Spec) addresses(ctx context.Context, e oci.Engine, network string) (ipv4, ipv6 string, err error) {
+	ipv4, ipv6 = d.IPAddress, d.IPv6Address
+	if ipv4 != "" {
+		if err := validateIP(ipv4, false); err != nil {
+			return "", "", err
+		}
+	}
+	if ipv6 != "" {
+		if err := validateIP(ipv6, true); err != nil {
+			return "", "", err
+		}
+	}
+	if network == DefaultNetwork {
+		if ipv4 != "" || ipv6 != "" {
+			return "", "", errors.New("static addresses are not supported on the default bridge network")
+		}
+		return "", "", nil
+	}
+	if ipv4 == "" {
+		if ipv4, err = AllocateIP(ctx, e, network, d.Name, false); err != nil {
+			return "", "", errors.Wrap(err, "failed to allocate an IPv4 address")
+		}
+	}
+	if ipv6 == "" && d.IPv6 {
+		if ipv6, err = AllocateIP(ctx, e, network, d.Name, true); err != nil {
+			return "", "", errors.Wrap(err, "failed to allocate an IPv6 address")
 		}
-		ns := strings.Split(parts[0], ",")
-		names = append(names, ns...)
+	}
+	return ipv4, ipv6, nil
+}
+
+// ListVolumes lists the volumes of the nodes of the profile, including the
+// ones kept after their node was removed
+func (d *Spec) ListVolumes(ctx context.Context, e oci.Engine) ([]string, error) {
+	names, err := e.ListVolumes(ctx, "label="+ClusterLabelKey+d.Profile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list volumes for %s", d.Profile)
 	}
 	return names, nil
+}
 
+// ListNodes lists all the nodes (containers) created by kic on the system
+func (d *Spec) ListNodes(e oci.Engine) ([]string, error) {
+	return d.ListNodesContext(context.Background(), e)
+}
+
+// ListNodesContext is like ListNodes but gives up listing when ctx is done
+func (d *Spec) ListNodesContext(ctx context.Context, e oci.Engine) ([]string, error) {
+	names, err := e.ListContainers(ctx, "label="+ClusterLabelKey+d.Profile)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to list containers for %s", d.Profile))
+	}
+	return names, nil
 }
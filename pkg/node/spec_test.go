@@ -0,0 +1,198 @@
+package node
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/medyagh/kic/pkg/command/fake"
+	"github.com/medyagh/kic/pkg/config/cri"
+	ocifake "github.com/medyagh/kic/pkg/oci/fake"
+	"github.com/medyagh/kic/pkg/ports"
+)
+
+const testImage = "kindest/node:v1.16.3"
+
+func TestSpecCreate(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      Spec
+		wantPorts int
+		wantCPUs  float64
+	}{
+		{
+			name:      "control plane",
+			spec:      Spec{Name: "p1-control-plane", Role: ControlPlaneRole, APIServerPort: 8443, APIServerAddress: "127.0.0.1"},
+			wantPorts: 1,
+			wantCPUs:  2,
+		},
+		{
+			name:     "control plane behind a load balancer",
+			spec:     Spec{Name: "p1-control-plane2", Role: ControlPlaneRole},
+			wantCPUs: 2,
+		},
+		{
+			name:      "load balancer",
+			spec:      Spec{Name: "p1-lb", Role: ExternalLoadBalancerRole, APIServerPort: 8443},
+			wantPorts: 1,
+			wantCPUs:  1,
+		},
+		{
+			name:     "worker",
+			spec:     Spec{Name: "p1-worker", Role: WorkerRole, APIServerPort: 8443, CPUs: "1.5"},
+			wantCPUs: 1.5,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			e := ocifake.NewEngine()
+			spec := tc.spec
+			spec.Profile, spec.Image = "p1", testImage
+			n, err := spec.CreateContext(ctx, e, fake.NewRunner())
+			if err != nil {
+				t.Fatalf("CreateContext: %v", err)
+			}
+			info, err := e.ContainerInfo(ctx, spec.Name)
+			if err != nil {
+				t.Fatalf("ContainerInfo: %v", err)
+			}
+			if info.Labels[NodeRoleKey] != spec.Role || info.Labels[NetworkLabelKey] != NetworkName("p1") {
+				t.Errorf("labels = %v", info.Labels)
+			}
+			if _, ok := info.Labels[ClusterLabelKey+"p1"]; !ok {
+				t.Errorf("labels = %v, want the cluster label", info.Labels)
+			}
+			if len(info.Ports) != tc.wantPorts {
+				t.Fatalf("ports = %+v, want %d", info.Ports, tc.wantPorts)
+			}
+			if tc.wantPorts > 0 && (info.Ports[0].ContainerPort != 6443 || info.Ports[0].HostPort != 8443) {
+				t.Errorf("port = %+v, want 6443 published on 8443", info.Ports[0])
+			}
+			if info.Resources.CPUs != tc.wantCPUs {
+				t.Errorf("cpus = %v, want %v", info.Resources.CPUs, tc.wantCPUs)
+			}
+			ipv4, _, err := n.IPContext(ctx)
+			if err != nil || ipv4 == "" || info.Labels[IPv4LabelKey] != ipv4 {
+				t.Errorf("IP = %q %v, want the static address %q", ipv4, err, info.Labels[IPv4LabelKey])
+			}
+		})
+	}
+}
+
+func TestSpecCreateAddresses(t *testing.T) {
+	ctx := context.Background()
+	e := ocifake.NewEngine()
+	var ips []string
+	for _, name := range []string{"p1-control-plane", "p1-worker", "p1-worker2"} {
+		spec := Spec{Name: name, Profile: "p1", Role: WorkerRole, Image: testImage}
+		if _, err := spec.CreateContext(ctx, e, fake.NewRunner()); err != nil {
+			t.Fatalf("creating %s: %v", name, err)
+		}
+		info, err := e.ContainerInfo(ctx, name)
+		if err != nil {
+			t.Fatalf("ContainerInfo: %v", err)
+		}
+		ips = append(ips, info.Labels[IPv4LabelKey])
+	}
+	if ips[0] == ips[1] || ips[1] == ips[2] || ips[0] == ips[2] {
+		t.Errorf("nodes got the same address: %v", ips)
+	}
+
+	spec := Spec{Name: "p1-static", Profile: "p1", Role: WorkerRole, Image: testImage, IPAddress: ips[0]}
+	if _, err := spec.CreateContext(ctx, e, fake.NewRunner()); err == nil {
+		t.Errorf("creating a node with the address %s of another node succeeded", ips[0])
+	}
+}
+
+func TestSpecCreateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		spec Spec
+		want string
+	}{
+		{"unknown role", Spec{Name: "n", Role: "etcd"}, "unknown node role"},
+		{"invalid cpus", Spec{Name: "n", Role: WorkerRole, CPUs: "many"}, "node n"},
+		{"too many cpus", Spec{Name: "n", Role: WorkerRole, CPUs: "64"}, "invalid resources"},
+		{"invalid ip", Spec{Name: "n", Role: WorkerRole, IPAddress: "10.0.0"}, "10.0.0"},
+		{"static ip on the default network", Spec{Name: "n", Role: WorkerRole, Network: DefaultNetwork, IPAddress: "172.17.0.9"}, "not supported"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := tc.spec
+			spec.Profile, spec.Image = "p1", testImage
+			_, err := spec.CreateContext(context.Background(), ocifake.NewEngine(), fake.NewRunner())
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("CreateContext = %v, want an error containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestSpecCreatePersistVar(t *testing.T) {
+	ctx := context.Background()
+	e := ocifake.NewEngine()
+	spec := Spec{Name: "p1-control-plane", Profile: "p1", Role: ControlPlaneRole, Image: testImage, PersistVar: true}
+	if _, err := spec.CreateContext(ctx, e, fake.NewRunner()); err != nil {
+		t.Fatalf("CreateContext: %v", err)
+	}
+	volumes, err := spec.ListVolumes(ctx, e)
+	if err != nil || len(volumes) != 1 || volumes[0] != VolumeName(spec.Name) {
+		t.Fatalf("ListVolumes = %v %v, want the volume of the node", volumes, err)
+	}
+	info, err := e.ContainerInfo(ctx, spec.Name)
+	if err != nil {
+		t.Fatalf("ContainerInfo: %v", err)
+	}
+	if info.Labels[VolumeLabelKey] != volumes[0] {
+		t.Errorf("labels = %v, want the volume", info.Labels)
+	}
+}
+
+func TestSpecCreatePorts(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "ports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	allocator, err := ports.NewAllocator(filepath.Join(dir, "ports.json"), 47100, 47999)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := ocifake.NewEngine()
+	spec := Spec{Name: "p1-worker", Profile: "p1", Role: WorkerRole, Image: testImage, Ports: allocator,
+		ExtraPortMappings: []cri.PortMapping{{ContainerPort: 80, ListenAddress: "127.0.0.1"}}}
+	n, err := spec.CreateContext(ctx, e, fake.NewRunner())
+	if err != nil {
+		t.Fatalf("CreateContext: %v", err)
+	}
+	reserved, err := allocator.Reserved("p1")
+	if err != nil || len(reserved) != 1 {
+		t.Fatalf("Reserved = %+v %v, want the port of the node", reserved, err)
+	}
+	info, err := e.ContainerInfo(ctx, spec.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Ports) != 1 || info.Ports[0].HostPort != reserved[0].HostPort {
+		t.Errorf("ports = %+v, want 80 published on the reserved port %d", info.Ports, reserved[0].HostPort)
+	}
+
+	// another node of the profile can't publish the same port
+	other := Spec{Name: "p1-worker2", Profile: "p1", Role: WorkerRole, Image: testImage, Ports: allocator,
+		ExtraPortMappings: []cri.PortMapping{{ContainerPort: 80, HostPort: reserved[0].HostPort, ListenAddress: "127.0.0.1"}}}
+	if _, err := other.CreateContext(ctx, e, fake.NewRunner()); err == nil || !strings.Contains(err.Error(), "already reserved") {
+		t.Errorf("CreateContext with a port of another node = %v, want an error", err)
+	}
+
+	if err := n.RemoveContext(ctx, ReleasePorts(allocator, "p1")); err != nil {
+		t.Fatalf("RemoveContext: %v", err)
+	}
+	if reserved, _ := allocator.Reserved("p1"); len(reserved) != 0 {
+		t.Errorf("Reserved after removing the node = %+v", reserved)
+	}
+}
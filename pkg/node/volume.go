@@ -0,0 +1,52 @@
+package node
+
+import (
+	"context"
+
+	"github.com/medyagh/kic/pkg/oci"
+	"github.com/medyagh/kic/pkg/ports"
+	"github.com/pkg/errors"
+)
+
+// VolumeName returns the name of the volume holding the /var of a node
+func VolumeName(nodeName string) string {
+	return nodeName
+}
+
+// EnsureVolume creates the volume holding the /var of a node, labelled with
+// the cluster label so it can be found when the node is gone
+func EnsureVolume(ctx context.Context, e oci.Engine, nodeName, clusterLabel string) (string, error) {
+	name := VolumeName(nodeName)
+	if err := e.CreateVolume(ctx, name, map[string]string{clusterLabel: ""}); err != nil {
+		return "", errors.Wrapf(err, "failed to create volume for node %s", nodeName)
+	}
+	return name, nil
+}
+
+// removeOpts are the options of Node.Remove
+type removeOpts struct {
+	KeepVolume bool
+	Ports      *ports.Allocator
+	Profile    string
+}
+
+// RemoveOpt is an option of Node.Remove
+type RemoveOpt func(*removeOpts) *removeOpts
+
+// KeepVolume keeps the volume holding the /var of the node, a node created
+// again with the same name reuses its etcd data, images and volumes
+func KeepVolume() RemoveOpt {
+	return func(r *removeOpts) *removeOpts {
+		r.KeepVolume = true
+		return r
+	}
+}
+
+// ReleasePorts releases the host ports reserved for the node in profile
+// when it was created with Spec.Ports
+func ReleasePorts(a *ports.Allocator, profile string) RemoveOpt {
+	return func(r *removeOpts) *removeOpts {
+		r.Ports, r.Profile = a, profile
+		return r
+	}
+}
@@ -0,0 +1,365 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/state"
+	"github.com/medyagh/kic/pkg/assets"
+	"github.com/medyagh/kic/pkg/config/resource"
+	"github.com/medyagh/kic/pkg/oci/dockerapi"
+	"github.com/medyagh/kic/pkg/oci/internal/inspect"
+	"github.com/pkg/errors"
+)
+
+// DockerAPI is the name of the engine talking to the docker daemon over its HTTP API
+const DockerAPI = "docker-api"
+
+// NewDockerAPI returns an Engine that talks to the docker daemon at DOCKER_HOST
+// over the Engine HTTP API instead of running the docker command line client
+func NewDockerAPI() (Engine, error) {
+	c, err := dockerapi.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	return NewDockerAPIWithClient(c), nil
+}
+
+// NewDockerAPIWithClient returns an Engine using an existing API client
+func NewDockerAPIWithClient(c *dockerapi.Client) Engine {
+	return &api{c: c}
+}
+
+// api implements Engine on top of the docker Engine HTTP API
+type api struct {
+	c *dockerapi.Client
+}
+
+// Name returns the name of the engine
+func (a *api) Name() string {
+	return DockerAPI
+}
+
+// CreateContainer creates and starts a container like "docker run -d" would
+func (a *api) CreateContainer(ctx context.Context, image string, opts ...CreateOpt) ([]string, error) {
+	o := &createOpts{}
+	for _, opt := range opts {
+		o = opt(o)
+	}
+	existing, err := resolveConflict(ctx, a, image, o)
+	if err != nil {
+		return nil, err
+	}
+	if existing != "" {
+		return []string{existing}, nil
+	}
+	name, config, err := createConfig(image, o)
+	if err != nil {
+		return nil, errors.Wrap(err, "CreateContainer")
+	}
+	id, err := a.c.ContainerCreate(ctx, name, config)
+	if dockerapi.IsConflict(err) {
+		return nil, &ConflictError{Name: name, Reason: "the name is already in use"}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "CreateContainer %s", name)
+	}
+	if err := a.c.ContainerStart(ctx, id); err != nil {
+		return nil, errors.Wrapf(err, "CreateContainer starting %s", name)
+	}
+	return []string{id}, nil
+}
+
+// Inspect return low-level information on containers, formatted with a go template
+func (a *api) Inspect(ctx context.Context, containerNameOrID, format string) ([]string, error) {
+	_, raw, err := a.c.ContainerInspectWithRaw(ctx, containerNameOrID)
+	if err != nil {
+		return nil, err
+	}
+	return inspect.FormatRaw(format, raw)
+}
+
+// ListContainers lists the names of all the containers matching the filters
+func (a *api) ListContainers(ctx context.Context, filters ...string) ([]string, error) {
+	list, err := a.c.ContainerList(ctx, true, filters...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list containers")
+	}
+	names := []string{}
+	for _, c := range list {
+		for _, n := range c.Names {
+			names = append(names, strings.TrimPrefix(n, "/"))
+		}
+	}
+	return names, nil
+}
+
+// Status returns the state of a container
+func (a *api) Status(ctx context.Context, ociID string) (state.State, error) {
+	info, err := a.ContainerInfo(ctx, ociID)
+	if err != nil {
+		return state.Error, errors.Wrapf(err, "error getting status of node %s", ociID)
+	}
+	return info.MachineState(), nil
+}
+
+// SystemStatus checks if the docker daemon is reachable
+func (a *api) SystemStatus(ctx context.Context) (state.State, error) {
+	if err := a.c.Ping(ctx); err != nil {
+		return state.Error, err
+	}
+	return state.Running, nil
+}
+
+// Start starts a stopped container
+func (a *api) Start(ctx context.Context, ociID string) error {
+	return errors.Wrapf(a.c.ContainerStart(ctx, ociID), "error starting node %s", ociID)
+}
+
+// Stop stops a container
+func (a *api) Stop(ctx context.Context, ociID string) error {
+	return errors.Wrapf(a.c.ContainerStop(ctx, ociID), "error stop node %s", ociID)
+}
+
+// Restart stops and starts a container
+func (a *api) Restart(ctx context.Context, ociID string) error {
+	return errors.Wrapf(a.c.ContainerRestart(ctx, ociID), "error restarting node %s", ociID)
+}
+
+// Pause pauses a container
+func (a *api) Pause(ctx context.Context, ociID string) error {
+	return errors.Wrapf(a.c.ContainerPause(ctx, ociID), "error pausing node %s", ociID)
+}
+
+// Unpause resumes all processes within a paused container
+func (a *api) Unpause(ctx context.Context, ociID string) error {
+	return errors.Wrapf(a.c.ContainerUnpause(ctx, ociID), "error unpausing node %s", ociID)
+}
+
+// Remove removes a container
+func (a *api) Remove(ctx context.Context, ociID string) error {
+	return errors.Wrapf(a.c.ContainerRemove(ctx, ociID, true, true), "error removing node %s", ociID)
+}
+
+// Exec runs a command in a running container
+func (a *api) Exec(ctx context.Context, ociID string, opts ExecOptions) (int, error) {
+	config := dockerapi.ExecConfig{
+		Privileged: opts.Privileged,
+		Tty:        opts.TTY,
+		Env:        opts.Env,
+		WorkingDir: opts.WorkingDir,
+		User:       opts.User,
+		Cmd:        opts.Cmd,
+	}
+	code, err := a.c.ContainerExec(ctx, ociID, config, opts.Stdin, opts.Stdout, opts.Stderr)
+	if err != nil {
+		return code, errors.Wrapf(err, "command failed: %s", opts.Cmd)
+	}
+	if code != 0 {
+		return code, errors.Errorf("command failed: %s: exit status %d", opts.Cmd, code)
+	}
+	return 0, nil
+}
+
+// Copy copies a local asset into the container
+func (a *api) Copy(ctx context.Context, ociID string, asset assets.CopyAsset) error {
+	if _, err := os.Stat(asset.AssetName); os.IsNotExist(err) {
+		return errors.Wrapf(err, "error source %s does not exist", asset.AssetName)
+	}
+	var buf bytes.Buffer
+	if err := tarAsset(&buf, asset.AssetName, asset.TargetName); err != nil {
+		return errors.Wrapf(err, "error archiving %s", asset.AssetName)
+	}
+	if err := a.c.CopyToContainer(ctx, ociID, asset.TargetDir, &buf); err != nil {
+		return errors.Wrapf(err, "error copying %s into node", asset.AssetName)
+	}
+	return nil
+}
+
+// Pull pulls an image, reporting the progress to progress if not nil
+func (a *api) Pull(ctx context.Context, image string, progress PullProgress) error {
+	err := a.c.ImagePull(ctx, image, func(m *dockerapi.JSONMessage) {
+		if progress != nil {
+			progress(PullEvent{
+				Layer:   m.ID,
+				Status:  m.Status,
+				Current: m.ProgressDetail.Current,
+				Total:   m.ProgressDetail.Total,
+			})
+		}
+	})
+	if err != nil {
+		return newPullError(image, err, err.Error())
+	}
+	return nil
+}
+
+// Save saves an image to a tar archive
+func (a *api) Save(ctx context.Context, image, dest string) error {
+	r, err := a.c.ImageSave(ctx, image)
+	if err != nil {
+		return errors.Wrap(err, "saving image to tar failed")
+	}
+	defer r.Close()
+	f, err := os.Create(dest)
+	if err != nil {
+		return errors.Wrap(err, "saving image to tar failed")
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		return errors.Wrap(err, "saving image to tar failed")
+	}
+	return nil
+}
+
+// ImageInspect return low-level information on container images
+func (a *api) ImageInspect(ctx context.Context, image, format string) ([]string, error) {
+	_, raw, err := a.c.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	return inspect.FormatRaw(format, raw)
+}
+
+// NetworkInspect displays detailed information on one or more networks
+func (a *api) NetworkInspect(ctx context.Context, networkNames []string, format string) ([]string, error) {
+	var lines []string
+	for _, name := range networkNames {
+		_, raw, err := a.c.NetworkInspectWithRaw(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		l, err := inspect.FormatRaw(format, raw)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, l...)
+	}
+	return lines, nil
+}
+
+// HostCapacity returns the CPUs and memory available to containers
+func (a *api) HostCapacity(ctx context.Context) (resource.Host, error) {
+	info, err := a.c.Info(ctx)
+	if err != nil {
+		return resource.Host{}, errors.Wrap(err, "docker info")
+	}
+	return resource.Host{CPUs: info.NCPU, Memory: resource.Memory(info.MemTotal)}, nil
+}
+
+// UsernsRemap checks if userns-remap is enabled in dockerd
+func (a *api) UsernsRemap(ctx context.Context) bool {
+	info, err := a.c.Info(ctx)
+	if err != nil {
+		return false
+	}
+	for _, o := range info.SecurityOptions {
+		if strings.Contains(o, "name=userns") {
+			return true
+		}
+	}
+	return false
+}
+
+// tarAsset writes a tar archive of the file or directory src, renamed to name
+func tarAsset(w io.Writer, src, name string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(filepath.Join(name, rel))
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// CreateNetwork creates a bridge network
+func (a *api) CreateNetwork(ctx context.Context, name string, opts NetworkOptions) error {
+	config := dockerapi.NetworkCreateConfig{
+		Name:           name,
+		CheckDuplicate: true,
+		Driver:         "bridge",
+		Labels:         opts.Labels,
+	}
+	ipam := &dockerapi.IPAM{Driver: "default"}
+	if opts.Subnet != "" {
+		ipam.Config = append(ipam.Config, dockerapi.IPAMConfig{Subnet: opts.Subnet})
+	}
+	if opts.IPv6Subnet != "" {
+		config.EnableIPv6 = true
+		ipam.Config = append(ipam.Config, dockerapi.IPAMConfig{Subnet: opts.IPv6Subnet})
+	}
+	if len(ipam.Config) > 0 {
+		config.IPAM = ipam
+	}
+	if _, err := a.c.NetworkCreate(ctx, config); err != nil {
+		return errors.Wrapf(err, "error creating network %s", name)
+	}
+	return nil
+}
+
+// NetworkInfo returns the low-level information about a network
+func (a *api) NetworkInfo(ctx context.Context, name string) (*NetworkInfo, error) {
+	raw, err := a.c.NetworkInspect(ctx, name)
+	if dockerapi.IsNotFound(err) {
+		return nil, &NotFoundError{Kind: "network", Name: name}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "inspecting network %s", name)
+	}
+	return NewNetworkInfo(raw), nil
+}
+
+// ListNetworks lists the names of the networks matching the filters
+func (a *api) ListNetworks(ctx context.Context, filters ...string) ([]string, error) {
+	list, err := a.c.NetworkList(ctx, filters...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list networks")
+	}
+	names := []string{}
+	for _, n := range list {
+		names = append(names, n.Name)
+	}
+	return names, nil
+}
+
+// RemoveNetwork removes a network
+func (a *api) RemoveNetwork(ctx context.Context, name string) error {
+	err := a.c.NetworkRemove(ctx, name)
+	if dockerapi.IsNotFound(err) {
+		return &NotFoundError{Kind: "network", Name: name}
+	}
+	if err != nil {
+		return errors.Wrapf(err, "error removing network %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,343 @@
+package oci
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/medyagh/kic/pkg/config/resource"
+	"github.com/medyagh/kic/pkg/oci/dockerapi"
+	"github.com/pkg/errors"
+)
+
+// CreateConfig returns the name and the body of the API request creating a
+// container with opts, as RunCommand returns the "docker run" arguments
+func CreateConfig(image string, opts ...CreateOpt) (string, dockerapi.ContainerCreateConfig, error) {
+	o := &createOpts{}
+	for _, opt := range opts {
+		o = opt(o)
+	}
+	return createConfig(image, o)
+}
+
+// createConfig translates the "docker run" arguments kic generates, and the
+// common ones callers add with WithRunArgs, into the body of an API create
+// request, returning the container name alongside it. Flags can be given as
+// "--flag value", "--flag=value" or "-f value", and short boolean flags can
+// be grouped, eg "-dt".
+func createConfig(image string, o *createOpts) (string, dockerapi.ContainerCreateConfig, error) {
+	config := dockerapi.ContainerCreateConfig{
+		ContainerConfig: dockerapi.ContainerConfig{
+			Image:        image,
+			Cmd:          o.ContainerArgs,
+			Labels:       map[string]string{},
+			ExposedPorts: map[string]struct{}{},
+		},
+		HostConfig: &dockerapi.HostConfig{
+			Tmpfs:        map[string]string{},
+			PortBindings: map[string][]dockerapi.PortBinding{},
+		},
+	}
+	hc := config.HostConfig
+
+	var name string
+	// static addresses apply to the network given with --network
+	var addresses []*dockerapi.EndpointIPAMConfig
+
+	boolFlags := map[string]func(){
+		// containers created through the API are always detached
+		"--detach":      func() {},
+		"--tty":         func() { config.Tty = true },
+		"--interactive": func() { config.OpenStdin = true },
+		"--privileged":  func() { hc.Privileged = true },
+		"--read-only":   func() { hc.ReadonlyRootfs = true },
+		"--rm":          func() { hc.AutoRemove = true },
+		"--init": func() {
+			init := true
+			hc.Init = &init
+		},
+	}
+	valueFlags := map[string]func(v string) error{
+		"--name":     func(v string) error { name = v; return nil },
+		"--hostname": func(v string) error { config.Hostname = v; return nil },
+		"--user":     func(v string) error { config.User = v; return nil },
+		"--workdir":  func(v string) error { config.WorkingDir = v; return nil },
+		"--entrypoint": func(v string) error {
+			config.Entrypoint = []string{v}
+			return nil
+		},
+		"--stop-signal":  func(v string) error { config.StopSignal = v; return nil },
+		"--env":          func(v string) error { config.Env = append(config.Env, v); return nil },
+		"--label":        func(v string) error { setKeyValue(config.Labels, v); return nil },
+		"--expose":       func(v string) error { config.ExposedPorts[portKey(v)] = struct{}{}; return nil },
+		"--publish":      func(v string) error { return addPortBinding(&config, v) },
+		"--volume":       func(v string) error { hc.Binds = append(hc.Binds, v); return nil },
+		"--security-opt": func(v string) error { hc.SecurityOpt = append(hc.SecurityOpt, v); return nil },
+		"--cap-add":      func(v string) error { hc.CapAdd = append(hc.CapAdd, v); return nil },
+		"--cap-drop":     func(v string) error { hc.CapDrop = append(hc.CapDrop, v); return nil },
+		"--dns":          func(v string) error { hc.DNS = append(hc.DNS, v); return nil },
+		"--dns-search":   func(v string) error { hc.DNSSearch = append(hc.DNSSearch, v); return nil },
+		"--dns-option":   func(v string) error { hc.DNSOptions = append(hc.DNSOptions, v); return nil },
+		"--add-host":     func(v string) error { hc.ExtraHosts = append(hc.ExtraHosts, v); return nil },
+		"--userns":       func(v string) error { hc.UsernsMode = v; return nil },
+		"--ipc":          func(v string) error { hc.IpcMode = v; return nil },
+		"--pid":          func(v string) error { hc.PidMode = v; return nil },
+		"--cgroupns":     func(v string) error { hc.CgroupnsMode = v; return nil },
+		"--network":      func(v string) error { hc.NetworkMode = v; return nil },
+		"--tmpfs": func(v string) error {
+			kv := strings.SplitN(v, ":", 2)
+			hc.Tmpfs[kv[0]] = ""
+			if len(kv) == 2 {
+				hc.Tmpfs[kv[0]] = kv[1]
+			}
+			return nil
+		},
+		"--sysctl": func(v string) error {
+			if hc.Sysctls == nil {
+				hc.Sysctls = map[string]string{}
+			}
+			setKeyValue(hc.Sysctls, v)
+			return nil
+		},
+		"--device": func(v string) error {
+			d, err := parseDevice(v)
+			if err == nil {
+				hc.Devices = append(hc.Devices, d)
+			}
+			return err
+		},
+		"--restart": func(v string) error {
+			p, err := parseRestartPolicy(v)
+			hc.RestartPolicy = p
+			return err
+		},
+		"--log-driver": func(v string) error {
+			if hc.LogConfig == nil {
+				hc.LogConfig = &dockerapi.LogConfig{}
+			}
+			hc.LogConfig.Type = v
+			return nil
+		},
+		"--log-opt": func(v string) error {
+			if hc.LogConfig == nil {
+				hc.LogConfig = &dockerapi.LogConfig{}
+			}
+			if hc.LogConfig.Config == nil {
+				hc.LogConfig.Config = map[string]string{}
+			}
+			setKeyValue(hc.LogConfig.Config, v)
+			return nil
+		},
+		"--cpus": func(v string) error {
+			cpus, err := resource.ParseCPUs(v)
+			hc.NanoCPUs = int64(cpus * 1e9)
+			return err
+		},
+		"--memory": func(v string) error {
+			m, err := resource.ParseMemory(v)
+			hc.Memory = int64(m)
+			return err
+		},
+		"--shm-size": func(v string) error {
+			m, err := resource.ParseMemory(v)
+			hc.ShmSize = int64(m)
+			return err
+		},
+		"--ip": func(v string) error {
+			addresses = append(addresses, &dockerapi.EndpointIPAMConfig{IPv4Address: v})
+			return nil
+		},
+		"--ip6": func(v string) error {
+			addresses = append(addresses, &dockerapi.EndpointIPAMConfig{IPv6Address: v})
+			return nil
+		},
+	}
+
+	args := o.runArgs()
+	for i := 0; i < len(args); i++ {
+		if group := shortFlagGroup(args[i]); group != nil {
+			for _, f := range group {
+				set, ok := boolFlags[runFlagAliases[f]]
+				if !ok {
+					return "", config, fmt.Errorf("invalid run argument %s: only boolean flags can be grouped", args[i])
+				}
+				set()
+			}
+			continue
+		}
+		flag, value, hasValue := args[i], "", false
+		if strings.HasPrefix(flag, "-") && strings.Contains(flag, "=") {
+			kv := strings.SplitN(flag, "=", 2)
+			flag, value, hasValue = kv[0], kv[1], true
+		}
+		if long, ok := runFlagAliases[flag]; ok {
+			flag = long
+		}
+
+		if set, ok := boolFlags[flag]; ok {
+			if hasValue {
+				b, err := strconv.ParseBool(value)
+				if err != nil {
+					return "", config, errors.Wrapf(err, "parsing run argument %s", args[i])
+				}
+				if !b {
+					continue
+				}
+			}
+			set()
+			continue
+		}
+		set, ok := valueFlags[flag]
+		if !ok {
+			return "", config, fmt.Errorf("unsupported run argument %s: the %s engine creates containers with the common docker run flags only", args[i], DockerAPI)
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return "", config, fmt.Errorf("flag %s needs a value", flag)
+			}
+			i++
+			value = args[i]
+		}
+		if err := set(value); err != nil {
+			return "", config, errors.Wrapf(err, "parsing run argument %s %s", flag, value)
+		}
+	}
+	if len(addresses) > 0 {
+		if hc.NetworkMode == "" {
+			return "", config, errors.New("static ip addresses need a user-defined --network")
+		}
+		ipam := &dockerapi.EndpointIPAMConfig{}
+		for _, a := range addresses {
+			if a.IPv4Address != "" {
+				ipam.IPv4Address = a.IPv4Address
+			}
+			if a.IPv6Address != "" {
+				ipam.IPv6Address = a.IPv6Address
+			}
+		}
+		config.NetworkingConfig = &dockerapi.NetworkingConfig{
+			EndpointsConfig: map[string]*dockerapi.EndpointSettings{
+				hc.NetworkMode: {IPAMConfig: ipam},
+			},
+		}
+	}
+	return name, config, nil
+}
+
+// runFlagAliases maps the short and legacy names of "docker run" flags to
+// their long name
+var runFlagAliases = map[string]string{
+	"-d":    "--detach",
+	"-t":    "--tty",
+	"-i":    "--interactive",
+	"-e":    "--env",
+	"-l":    "--label",
+	"-p":    "--publish",
+	"-v":    "--volume",
+	"-u":    "--user",
+	"-w":    "--workdir",
+	"-m":    "--memory",
+	"-h":    "--hostname",
+	"--net": "--network",
+}
+
+// shortFlagGroup returns the flags of a group of short boolean flags like
+// "-dt", or nil if arg is not one
+func shortFlagGroup(arg string) []string {
+	if len(arg) <= 2 || arg[0] != '-' || arg[1] == '-' || strings.Contains(arg, "=") {
+		return nil
+	}
+	var flags []string
+	for _, c := range arg[1:] {
+		flags = append(flags, "-"+string(c))
+	}
+	return flags
+}
+
+// setKeyValue sets a "key=value" pair in m, a missing value being empty
+func setKeyValue(m map[string]string, kv string) {
+	parts := strings.SplitN(kv, "=", 2)
+	m[parts[0]] = ""
+	if len(parts) == 2 {
+		m[parts[0]] = parts[1]
+	}
+}
+
+// parseDevice parses a "--device" value: hostPath[:containerPath][:permissions]
+func parseDevice(v string) (dockerapi.DeviceMapping, error) {
+	parts := strings.Split(v, ":")
+	d := dockerapi.DeviceMapping{PathOnHost: parts[0], PathInContainer: parts[0], CgroupPermissions: "rwm"}
+	switch len(parts) {
+	case 1:
+	case 2:
+		if strings.HasPrefix(parts[1], "/") {
+			d.PathInContainer = parts[1]
+		} else {
+			d.CgroupPermissions = parts[1]
+		}
+	case 3:
+		d.PathInContainer, d.CgroupPermissions = parts[1], parts[2]
+	default:
+		return d, fmt.Errorf("invalid device %q", v)
+	}
+	return d, nil
+}
+
+// parseRestartPolicy parses a "--restart" value: no, always, unless-stopped
+// or on-failure[:max-retries]
+func parseRestartPolicy(v string) (*dockerapi.RestartPolicy, error) {
+	parts := strings.SplitN(v, ":", 2)
+	p := &dockerapi.RestartPolicy{Name: parts[0]}
+	switch p.Name {
+	case "no", "always", "unless-stopped":
+		if len(parts) == 2 {
+			return nil, fmt.Errorf("restart policy %s takes no maximum retry count", p.Name)
+		}
+	case "on-failure":
+		if len(parts) == 2 {
+			n, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid maximum retry count of restart policy %q", v)
+			}
+			p.MaximumRetryCount = n
+		}
+	default:
+		return nil, fmt.Errorf("invalid restart policy %q", v)
+	}
+	return p, nil
+}
+
+// addPortBinding parses a "--publish" value: [[ip:]hostPort:]containerPort[/proto]
+func addPortBinding(config *dockerapi.ContainerCreateConfig, v string) error {
+	var hostIP, hostPort, containerPort string
+	i := strings.LastIndex(v, ":")
+	if i < 0 {
+		containerPort = v
+	} else {
+		containerPort = v[i+1:]
+		host := v[:i]
+		if j := strings.LastIndex(host, ":"); j >= 0 {
+			hostIP, hostPort = host[:j], host[j+1:]
+		} else {
+			hostPort = host
+		}
+	}
+	hostIP = strings.Trim(hostIP, "[]")
+	if hostIP != "" && net.ParseIP(hostIP) == nil {
+		return fmt.Errorf("invalid ip address %q in port mapping %q", hostIP, v)
+	}
+	key := portKey(containerPort)
+	config.ExposedPorts[key] = struct{}{}
+	config.HostConfig.PortBindings[key] = append(config.HostConfig.PortBindings[key],
+		dockerapi.PortBinding{HostIP: hostIP, HostPort: hostPort})
+	return nil
+}
+
+// portKey returns the "port/proto" key the API uses for ports, defaulting to tcp
+func portKey(port string) string {
+	if strings.Contains(port, "/") {
+		return port
+	}
+	return port + "/tcp"
+}
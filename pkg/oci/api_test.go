@@ -0,0 +1,193 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/medyagh/kic/pkg/config/cri"
+	"github.com/medyagh/kic/pkg/oci/dockerapi"
+)
+
+// newAPIEngine returns a docker api Engine talking to a fake daemon serving
+// handler on a unix socket, and a func stopping the daemon
+func newAPIEngine(t *testing.T, handler http.Handler) (Engine, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "oci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sock := filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	s := httptest.NewUnstartedServer(handler)
+	s.Listener = l
+	s.Start()
+	stop := func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+	c, err := dockerapi.NewClientWithHost("unix://" + sock)
+	if err != nil {
+		stop()
+		t.Fatal(err)
+	}
+	return NewDockerAPIWithClient(c), stop
+}
+
+func TestCreateConfig(t *testing.T) {
+	o := &createOpts{
+		Name:   "kic",
+		Labels: map[string]string{"created_by.kic": "true"},
+		RunArgs: []string{
+			"-dt", "--privileged", "--security-opt", "seccomp=unconfined",
+			"--tmpfs", "/tmp", "--tmpfs=/run:rw,exec",
+			"-e", "KIC=1", "-e=PROXY=http://proxy:3128",
+			"--hostname", "kic", "--cpus=2", "-m", "2g",
+			"--network", "kic-net", "--ip", "10.10.0.2", "--ip6=fd00::2",
+			"--expose", "6443",
+			"--cap-add", "NET_ADMIN", "--device", "/dev/fuse",
+			"--restart=on-failure:3", "--init", "--read-only=false",
+			"--sysctl", "net.ipv4.ip_forward=1", "--shm-size", "64m",
+			"--log-driver", "json-file", "--log-opt", "max-size=10m",
+		},
+		ContainerArgs: []string{"--v=6"},
+		Mounts:        []cri.Mount{{HostPath: "/lib/modules", ContainerPath: "/lib/modules", Readonly: true}},
+		PortMappings:  []cri.PortMapping{{ListenAddress: "127.0.0.1", HostPort: 8443, ContainerPort: 6443}},
+	}
+	name, config, err := createConfig("kindest/node:v1.16.3", o)
+	if err != nil {
+		t.Fatalf("createConfig: %v", err)
+	}
+	if name != "kic" {
+		t.Errorf("name = %q, want kic", name)
+	}
+	init := true
+	want := dockerapi.ContainerCreateConfig{
+		ContainerConfig: dockerapi.ContainerConfig{
+			Hostname:     "kic",
+			Tty:          true,
+			Env:          []string{"KIC=1", "PROXY=http://proxy:3128"},
+			Cmd:          []string{"--v=6"},
+			Image:        "kindest/node:v1.16.3",
+			Labels:       map[string]string{"created_by.kic": "true"},
+			ExposedPorts: map[string]struct{}{"6443/tcp": {}},
+		},
+		HostConfig: &dockerapi.HostConfig{
+			Binds:         []string{"/lib/modules:/lib/modules:ro"},
+			Privileged:    true,
+			SecurityOpt:   []string{"seccomp=unconfined"},
+			Tmpfs:         map[string]string{"/tmp": "", "/run": "rw,exec"},
+			PortBindings:  map[string][]dockerapi.PortBinding{"6443/tcp": {{HostIP: "127.0.0.1", HostPort: "8443"}}},
+			NetworkMode:   "kic-net",
+			NanoCPUs:      2e9,
+			Memory:        2 << 30,
+			RestartPolicy: &dockerapi.RestartPolicy{Name: "on-failure", MaximumRetryCount: 3},
+			CapAdd:        []string{"NET_ADMIN"},
+			Devices:       []dockerapi.DeviceMapping{{PathOnHost: "/dev/fuse", PathInContainer: "/dev/fuse", CgroupPermissions: "rwm"}},
+			Init:          &init,
+			ShmSize:       64 << 20,
+			Sysctls:       map[string]string{"net.ipv4.ip_forward": "1"},
+			LogConfig:     &dockerapi.LogConfig{Type: "json-file", Config: map[string]string{"max-size": "10m"}},
+		},
+		NetworkingConfig: &dockerapi.NetworkingConfig{
+			EndpointsConfig: map[string]*dockerapi.EndpointSettings{
+				"kic-net": {IPAMConfig: &dockerapi.EndpointIPAMConfig{IPv4Address: "10.10.0.2", IPv6Address: "fd00::2"}},
+			},
+		},
+	}
+	if !reflect.DeepEqual(config, want) {
+		got, _ := json.MarshalIndent(config, "", "  ")
+		exp, _ := json.MarshalIndent(want, "", "  ")
+		t.Errorf("createConfig =\n%s\nwant\n%s", got, exp)
+	}
+}
+
+func TestCreateConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"unsupported flag", []string{"--gpus", "all"}, "unsupported run argument --gpus"},
+		{"missing value", []string{"--hostname"}, "needs a value"},
+		{"grouped value flag", []string{"-dh"}, "only boolean flags can be grouped"},
+		{"positional argument", []string{"kindest/node"}, "unsupported run argument kindest/node"},
+		{"invalid boolean", []string{"--init=maybe"}, "--init=maybe"},
+		{"invalid restart policy", []string{"--restart", "sometimes"}, "invalid restart policy"},
+		{"static ip on the default network", []string{"--ip", "172.17.0.9"}, "user-defined --network"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := createConfig("busybox", &createOpts{RunArgs: tc.args})
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("createConfig(%v) = %v, want an error containing %q", tc.args, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestAPICreateContainer(t *testing.T) {
+	var created dockerapi.ContainerCreateConfig
+	var createdName, started string
+	e, stop := newAPIEngine(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/containers/create":
+			createdName = r.URL.Query().Get("name")
+			if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"Id":"0123456789ab","Warnings":[]}`))
+		case strings.HasSuffix(r.URL.Path, "/start"):
+			started = strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/containers/"), "/start")
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer stop()
+
+	ids, err := e.CreateContainer(context.Background(), "kindest/node:v1.16.3",
+		WithName("kic"), WithRunArgs("-d", "--privileged", "--network", "kic-net", "--ip", "10.10.0.2"))
+	if err != nil {
+		t.Fatalf("CreateContainer: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != "0123456789ab" || started != "0123456789ab" {
+		t.Errorf("CreateContainer = %v, started %q, want the created container to be started", ids, started)
+	}
+	if createdName != "kic" || created.Image != "kindest/node:v1.16.3" || !created.HostConfig.Privileged {
+		t.Errorf("created %q with %+v", createdName, created)
+	}
+	if ep := created.NetworkingConfig.EndpointsConfig["kic-net"]; ep == nil || ep.IPAMConfig.IPv4Address != "10.10.0.2" {
+		t.Errorf("networking config = %+v, want the static address on kic-net", created.NetworkingConfig)
+	}
+}
+
+func TestAPICreateContainerConflict(t *testing.T) {
+	e, stop := newAPIEngine(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"message":"Conflict. The container name \"/kic\" is already in use"}`))
+	}))
+	defer stop()
+
+	_, err := e.CreateContainer(context.Background(), "busybox", WithName("kic"))
+	if !IsConflict(err) {
+		t.Fatalf("CreateContainer = %v, want a *ConflictError", err)
+	}
+	if c := err.(*ConflictError); c.Name != "kic" {
+		t.Errorf("conflict = %+v, want the name of the container", c)
+	}
+}
@@ -0,0 +1,202 @@
+package oci
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/medyagh/kic/pkg/config/cri"
+	"github.com/medyagh/kic/pkg/config/resource"
+	"github.com/pkg/errors"
+)
+
+// ConflictPolicy is what CreateContainer does when a container with the
+// requested name already exists
+type ConflictPolicy string
+
+const (
+	// ConflictFail fails with a *ConflictError, this is the default
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictReuseIfMatching reuses the existing container if it runs the same
+	// image, has the same labels, resource limits and published ports, starting
+	// or unpausing it if needed. Other run options are not compared.
+	ConflictReuseIfMatching ConflictPolicy = "reuse-if-matching"
+	// ConflictReplace removes the existing container and creates a new one
+	ConflictReplace ConflictPolicy = "replace"
+)
+
+// ConflictError is returned when a container can not be created because
+// its name is already in use
+type ConflictError struct {
+	Name   string
+	Reason string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("container %q already exists: %s", e.Name, e.Reason)
+}
+
+// IsConflict returns true if err is a *ConflictError
+func IsConflict(err error) bool {
+	_, ok := errors.Cause(err).(*ConflictError)
+	return ok
+}
+
+// ResolveConflict applies the conflict policy of opts to an existing
+// container named like the one to create, as CreateContainer does first.
+// It returns the ID of the existing container if it was reused.
+func ResolveConflict(ctx context.Context, e Engine, image string, opts ...CreateOpt) (string, error) {
+	o := &createOpts{}
+	for _, opt := range opts {
+		o = opt(o)
+	}
+	return resolveConflict(ctx, e, image, o)
+}
+
+// resolveConflict applies the conflict policy to an existing container
+// named like the one to create. It returns the ID of the existing container
+// if it was reused, in which case there is nothing left to create.
+func resolveConflict(ctx context.Context, e Engine, image string, o *createOpts) (string, error) {
+	if o.Name == "" || o.ConflictPolicy == "" || o.ConflictPolicy == ConflictFail {
+		return "", nil
+	}
+	info, err := e.ContainerInfo(ctx, o.Name)
+	if IsNotFound(err) {
+		// there is nothing to reuse or replace
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "looking for an existing container %s", o.Name)
+	}
+
+	switch o.ConflictPolicy {
+	case ConflictReplace:
+		if err := e.Remove(ctx, o.Name); err != nil {
+			return "", errors.Wrapf(err, "replacing container %s", o.Name)
+		}
+		return "", nil
+	case ConflictReuseIfMatching:
+		if reason := mismatch(ctx, e, info, image, o); reason != "" {
+			return "", &ConflictError{Name: o.Name, Reason: reason}
+		}
+		switch info.State.Status {
+		case "running":
+		case "paused":
+			if err := e.Unpause(ctx, o.Name); err != nil {
+				return "", errors.Wrapf(err, "reusing container %s", o.Name)
+			}
+		default:
+			if err := e.Start(ctx, o.Name); err != nil {
+				return "", errors.Wrapf(err, "reusing container %s", o.Name)
+			}
+		}
+		return info.ID, nil
+	default:
+		return "", fmt.Errorf("unknown conflict policy %q", o.ConflictPolicy)
+	}
+}
+
+// mismatch returns why an existing container does not match the requested
+// image, labels, resource limits and port mappings, or an empty string if it
+// matches
+func mismatch(ctx context.Context, e Engine, info *ContainerInfo, image string, o *createOpts) string {
+	if info.Image != image {
+		id, err := ImageID(ctx, e, image)
+		if err != nil || id != info.ImageID {
+			return fmt.Sprintf("it runs image %s instead of %s", info.Image, image)
+		}
+	}
+	var diff []string
+	for k, v := range o.Labels {
+		if got, ok := info.Labels[k]; !ok || got != v {
+			diff = append(diff, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+	if len(diff) > 0 {
+		sort.Strings(diff)
+		return fmt.Sprintf("it is missing the labels %s", strings.Join(diff, ", "))
+	}
+	want, err := requestedResources(o.RunArgs)
+	if err != nil {
+		return err.Error()
+	}
+	if info.Resources != want {
+		return fmt.Sprintf("it has %s instead of %s", describeResources(info.Resources), describeResources(want))
+	}
+	for _, pm := range o.PortMappings {
+		if !publishes(info.Ports, pm) {
+			return fmt.Sprintf("it does not publish port %d on %s", pm.ContainerPort,
+				net.JoinHostPort(pm.ListenAddress, strconv.Itoa(int(pm.HostPort))))
+		}
+	}
+	// docker publishes a port on both 0.0.0.0 and :: when no address is
+	// given, so the published ports are compared by container port only
+	for _, p := range info.Ports {
+		if !publishes(o.PortMappings, cri.PortMapping{ContainerPort: p.ContainerPort}) {
+			return fmt.Sprintf("it also publishes port %d", p.ContainerPort)
+		}
+	}
+	return ""
+}
+
+// requestedResources returns the limits set by the --cpus and --memory run
+// arguments, zero meaning unlimited as in ContainerInfo
+func requestedResources(runArgs []string) (Resources, error) {
+	var r Resources
+	for i := 0; i < len(runArgs); i++ {
+		flag, value := runArgs[i], ""
+		if kv := strings.SplitN(flag, "=", 2); len(kv) == 2 && strings.HasPrefix(flag, "-") {
+			flag, value = kv[0], kv[1]
+		} else if i+1 < len(runArgs) {
+			value = runArgs[i+1]
+		}
+		switch flag {
+		case "--cpus":
+			cpus, err := resource.ParseCPUs(value)
+			if err != nil {
+				return r, err
+			}
+			r.CPUs = float64(cpus)
+		case "--memory", "-m":
+			m, err := resource.ParseMemory(value)
+			if err != nil {
+				return r, err
+			}
+			r.Memory = int64(m)
+		}
+	}
+	return r, nil
+}
+
+// describeResources formats resource limits for a mismatch reason
+func describeResources(r Resources) string {
+	cpus, memory := "unlimited cpus", "unlimited memory"
+	if r.CPUs != 0 {
+		cpus = fmt.Sprintf("%s cpus", resource.CPUs(r.CPUs))
+	}
+	if r.Memory != 0 {
+		memory = fmt.Sprintf("%s of memory", resource.Memory(r.Memory))
+	}
+	return cpus + " and " + memory
+}
+
+// publishes returns true if one of ports publishes pm. A zero host port is
+// any port the engine picked, and an empty listen address all addresses.
+func publishes(ports []cri.PortMapping, pm cri.PortMapping) bool {
+	for _, p := range ports {
+		if p.ContainerPort != pm.ContainerPort {
+			continue
+		}
+		if pm.HostPort != 0 && p.HostPort != pm.HostPort {
+			continue
+		}
+		if pm.ListenAddress != "" && p.ListenAddress != pm.ListenAddress {
+			continue
+		}
+		return true
+	}
+	return false
+}
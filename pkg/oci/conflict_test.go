@@ -0,0 +1,95 @@
+package oci_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/medyagh/kic/pkg/config/cri"
+	"github.com/medyagh/kic/pkg/oci"
+	"github.com/medyagh/kic/pkg/oci/fake"
+)
+
+const testImage = "kindest/node:v1.16.3"
+
+// brokenInfoEngine can not inspect containers
+type brokenInfoEngine struct {
+	*fake.Engine
+}
+
+func (b brokenInfoEngine) ContainerInfo(ctx context.Context, containerNameOrID string) (*oci.ContainerInfo, error) {
+	return nil, errors.New("Cannot connect to the Docker daemon")
+}
+
+func TestResolveConflictLookupError(t *testing.T) {
+	e := brokenInfoEngine{fake.NewEngine()}
+	for _, policy := range []oci.ConflictPolicy{oci.ConflictReplace, oci.ConflictReuseIfMatching} {
+		existing, err := oci.ResolveConflict(context.Background(), e, testImage, oci.WithName("kic"), oci.WithConflictPolicy(policy))
+		if err == nil || existing != "" {
+			t.Errorf("%s: ResolveConflict = %q %v, want the lookup error", policy, existing, err)
+		}
+	}
+}
+
+func TestResolveConflictImageID(t *testing.T) {
+	ctx := context.Background()
+	e := fake.NewEngine()
+	ids, err := e.CreateContainer(ctx, testImage, oci.WithName("kic"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the container is reused with another reference to its image
+	if err := e.TagImage(testImage, "kindest/node:latest"); err != nil {
+		t.Fatal(err)
+	}
+	existing, err := oci.ResolveConflict(ctx, e, "kindest/node:latest", oci.WithName("kic"), oci.WithConflictPolicy(oci.ConflictReuseIfMatching))
+	if err != nil || existing != ids[0] {
+		t.Errorf("ResolveConflict = %q %v, want the container running the same image to be reused", existing, err)
+	}
+	e.AddImage("kindest/node:v1.17.0")
+	if _, err := oci.ResolveConflict(ctx, e, "kindest/node:v1.17.0", oci.WithName("kic"), oci.WithConflictPolicy(oci.ConflictReuseIfMatching)); !oci.IsConflict(err) {
+		t.Errorf("ResolveConflict = %v, want a conflict with a container running another image", err)
+	}
+}
+
+func TestResolveConflictRunOptions(t *testing.T) {
+	api := cri.PortMapping{ContainerPort: 6443, HostPort: 32768, ListenAddress: "127.0.0.1"}
+	tests := []struct {
+		name     string
+		runArgs  []string
+		ports    []cri.PortMapping
+		conflict bool
+	}{
+		{name: "same options", runArgs: []string{"--cpus=2", "--memory=2g"}, ports: []cri.PortMapping{api}},
+		{name: "same limits written differently", runArgs: []string{"--cpus", "2000m", "-m", "2048m"}, ports: []cri.PortMapping{api}},
+		{name: "any host port", runArgs: []string{"--cpus=2", "--memory=2g"}, ports: []cri.PortMapping{{ContainerPort: 6443}}},
+		{name: "other cpus", runArgs: []string{"--cpus=4", "--memory=2g"}, ports: []cri.PortMapping{api}, conflict: true},
+		{name: "unlimited memory", runArgs: []string{"--cpus=2"}, ports: []cri.PortMapping{api}, conflict: true},
+		{name: "other host port", runArgs: []string{"--cpus=2", "--memory=2g"}, ports: []cri.PortMapping{{ContainerPort: 6443, HostPort: 32769}}, conflict: true},
+		{name: "other listen address", runArgs: []string{"--cpus=2", "--memory=2g"}, ports: []cri.PortMapping{{ContainerPort: 6443, HostPort: 32768, ListenAddress: "0.0.0.0"}}, conflict: true},
+		{name: "no port", runArgs: []string{"--cpus=2", "--memory=2g"}, conflict: true},
+		{name: "another port", runArgs: []string{"--cpus=2", "--memory=2g"}, ports: []cri.PortMapping{api, {ContainerPort: 80, HostPort: 8080}}, conflict: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			e := fake.NewEngine()
+			ids, err := e.CreateContainer(ctx, testImage, oci.WithName("kic"),
+				oci.WithRunArgs("--cpus=2", "--memory=2g"), oci.WithPortMappings([]cri.PortMapping{api}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			existing, err := oci.ResolveConflict(ctx, e, testImage, oci.WithName("kic"), oci.WithRunArgs(tc.runArgs...),
+				oci.WithPortMappings(tc.ports), oci.WithConflictPolicy(oci.ConflictReuseIfMatching))
+			if tc.conflict {
+				if !oci.IsConflict(err) {
+					t.Errorf("ResolveConflict = %q %v, want a conflict", existing, err)
+				}
+				return
+			}
+			if err != nil || existing != ids[0] {
+				t.Errorf("ResolveConflict = %q %v, want the container to be reused", existing, err)
+			}
+		})
+	}
+}
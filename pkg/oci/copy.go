@@ -1,6 +1,7 @@
 package oci
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -11,13 +12,13 @@ import (
 )
 
 // Copy copies a local asset into the container
-func Copy(ociBinary string, ociID string, asset assets.CopyAsset) error {
+func (c *cli) Copy(ctx context.Context, ociID string, asset assets.CopyAsset) error {
 	if _, err := os.Stat(asset.AssetName); os.IsNotExist(err) {
 		return errors.Wrapf(err, "error source %s does not exist", asset.AssetName)
 	}
 
 	destination := fmt.Sprintf("%s:%s", ociID, asset.TargetPath())
-	cmd := exec.Command(ociBinary, "cp", asset.AssetName, destination)
+	cmd := exec.CommandContext(ctx, c.bin, "cp", asset.AssetName, destination)
 	err := cmd.Run()
 	if err != nil {
 		return errors.Wrapf(err, "error copying %s into node", asset.AssetName)
@@ -3,7 +3,11 @@ package oci
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"fmt"
 	"os/exec"
+	"sort"
+	"strings"
 
 	"github.com/medyagh/kic/pkg/config/cri"
 	"github.com/pkg/errors"
@@ -14,55 +18,116 @@ type CreateOpt func(*createOpts) *createOpts
 
 // actual options struct
 type createOpts struct {
-	RunArgs       []string
-	ContainerArgs []string
-	Mounts        []cri.Mount
-	PortMappings  []cri.PortMapping
+	Name           string
+	Labels         map[string]string
+	RunArgs        []string
+	ContainerArgs  []string
+	Mounts         []cri.Mount
+	PortMappings   []cri.PortMapping
+	ConflictPolicy ConflictPolicy
 }
 
-// CreateContainer creates a container with "docker/podman run"
-func CreateContainer(ociBinary string, image string, opts ...CreateOpt) ([]string, error) {
-	o := &createOpts{}
-	for _, opt := range opts {
-		o = opt(o)
+// runArgs converts the options to container run args
+func (o *createOpts) runArgs() []string {
+	var runArgs []string
+	if o.Name != "" {
+		runArgs = append(runArgs, "--name", o.Name)
+	}
+	// sort the labels so the generated args are stable
+	keys := make([]string, 0, len(o.Labels))
+	for k := range o.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		runArgs = append(runArgs, "--label", fmt.Sprintf("%s=%s", k, o.Labels[k]))
 	}
+	runArgs = append(runArgs, o.RunArgs...)
 	// convert mounts to container run args
-	runArgs := o.RunArgs
 	for _, mount := range o.Mounts {
 		runArgs = append(runArgs, generateMountBindings(mount)...)
 	}
 	for _, portMapping := range o.PortMappings {
 		runArgs = append(runArgs, generatePortMappings(portMapping)...)
 	}
-	// construct the actual docker run argv
+	return runArgs
+}
+
+// runCommand returns the actual docker run argv, without the binary
+func (o *createOpts) runCommand(image string) []string {
 	args := []string{"run"}
-	args = append(args, runArgs...)
+	args = append(args, o.runArgs()...)
 	args = append(args, image)
-	args = append(args, o.ContainerArgs...)
-	cmd := exec.Command(ociBinary, args...)
+	return append(args, o.ContainerArgs...)
+}
+
+// RunCommand returns the arguments of the "docker/podman run" command that
+// creates a container with opts, eg to print it
+func RunCommand(image string, opts ...CreateOpt) []string {
+	o := &createOpts{}
+	for _, opt := range opts {
+		o = opt(o)
+	}
+	return o.runCommand(image)
+}
+
+// CreateContainer creates a container with "docker/podman run"
+func (c *cli) CreateContainer(ctx context.Context, image string, opts ...CreateOpt) ([]string, error) {
+	o := &createOpts{}
+	for _, opt := range opts {
+		o = opt(o)
+	}
+	existing, err := resolveConflict(ctx, c, image, o)
+	if err != nil {
+		return nil, err
+	}
+	if existing != "" {
+		return []string{existing}, nil
+	}
+	args := o.runCommand(image)
+	cmd := exec.CommandContext(ctx, c.bin, args...)
 	var buff bytes.Buffer
 	cmd.Stdout = &buff
 	cmd.Stderr = &buff
-	err := cmd.Run()
+	err = cmd.Run()
 	scanner := bufio.NewScanner(&buff)
 	var output []string
 	for scanner.Scan() {
 		output = append(output, scanner.Text())
 	}
-	// TODO : check for exist status 125 that means it alread exists, we can re-start it
-	// example error:
-	// $ docker run --cpus=2 --memory=2000m -d -t --privileged --security-opt seccomp=unconfined --tmpfs /tmp --tmpfs /run -v /lib/modules:/lib/modules:ro --hostname p1control-plane --name p1control-plane --label io.k8s.sigs.kic.clusterp1 --label io.k8s.sigs.kic.role=control-plane --expose 50182 --publish=127.0.0.1:50182:6443 medyagh/kic:v1.15.0@sha256:1f03b3168ffe8ab43ce170a5729e31b0d53fb3a1af88e1ad1bdf4626fad8a91c
+	// exit status 125 means the engine could not create the container, eg:
+	// $ docker run ... --name p1control-plane ...
 	//		 docker: Error response from daemon: Conflict. The container name "/p1control-plane" is already in use by container "0204dcf3ca51c874b6c7dac989beae9d98dd44af53e0a17312f4d3480c1f6191". You have to remove (or rename) that container to be able to reuse that name.
 	// 		 See 'docker run --help'.
 	// $ echo $?
 	// 125
-
+	if exitError, ok := err.(*exec.ExitError); ok && exitError.ExitCode() == 125 {
+		if strings.Contains(buff.String(), "already in use") {
+			return output, &ConflictError{Name: o.Name, Reason: "the name is already in use"}
+		}
+	}
 	if err != nil {
 		return output, errors.Wrapf(err, "CreateContainer %v ", args)
 	}
 	return output, nil
 }
 
+// WithName sets the container name
+func WithName(name string) CreateOpt {
+	return func(r *createOpts) *createOpts {
+		r.Name = name
+		return r
+	}
+}
+
+// WithLabels sets the container labels
+func WithLabels(labels map[string]string) CreateOpt {
+	return func(r *createOpts) *createOpts {
+		r.Labels = labels
+		return r
+	}
+}
+
 // WithRunArgs sets the args for docker run
 // as in the args portion of `docker run args... image containerArgs...`
 func WithRunArgs(args ...string) CreateOpt {
@@ -87,3 +152,11 @@ func WithPortMappings(portMappings []cri.PortMapping) CreateOpt {
 		return r
 	}
 }
+
+// WithConflictPolicy sets what to do when a container with the same name exists
+func WithConflictPolicy(policy ConflictPolicy) CreateOpt {
+	return func(r *createOpts) *createOpts {
+		r.ConflictPolicy = policy
+		return r
+	}
+}
@@ -0,0 +1,176 @@
+// Package dockerapi is a minimal client for the Docker Engine HTTP API
+// https://docs.docker.com/engine/api/
+package dockerapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultHost is the address of the docker daemon when DOCKER_HOST is not set
+const DefaultHost = "unix:///var/run/docker.sock"
+
+// Client talks to a docker daemon over its HTTP API
+type Client struct {
+	// Version is the API version prefixed to every request, for example "1.40".
+	// When empty the daemon's latest API version is used.
+	Version string
+
+	proto string
+	addr  string
+	http  *http.Client
+}
+
+// NewClient returns a client for the daemon at DOCKER_HOST, or DefaultHost
+func NewClient() (*Client, error) {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = DefaultHost
+	}
+	return NewClientWithHost(host)
+}
+
+// NewClientWithHost returns a client for the daemon listening on host,
+// for example unix:///var/run/docker.sock or tcp://127.0.0.1:2375
+// TLS protected daemons are not supported.
+func NewClientWithHost(host string) (*Client, error) {
+	parts := strings.SplitN(host, "://", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid docker host %q", host)
+	}
+	proto, addr := parts[0], parts[1]
+	switch proto {
+	case "unix":
+	case "tcp":
+		proto = "tcp"
+		addr = strings.TrimSuffix(addr, "/")
+	default:
+		return nil, fmt.Errorf("unsupported protocol %q in docker host %q", proto, host)
+	}
+	c := &Client{proto: proto, addr: addr}
+	c.http = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return c.dial(ctx)
+			},
+		},
+	}
+	return c, nil
+}
+
+// dial opens a raw connection to the daemon
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, c.proto, c.addr)
+}
+
+// url builds the request url for an API path
+func (c *Client) url(path string, query url.Values) string {
+	// the host part is ignored by our dialer, but must be valid
+	u := url.URL{Scheme: "http", Host: "docker", Path: path}
+	if c.Version != "" {
+		u.Path = "/v" + c.Version + path
+	}
+	if query != nil {
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// newRequest creates a request, encoding body as json unless it is an io.Reader
+func (c *Client) newRequest(method, path string, query url.Values, body interface{}) (*http.Request, error) {
+	var r io.Reader
+	contentType := ""
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		r = b
+		contentType = "application/x-tar"
+	default:
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "encoding request body")
+		}
+		r = bytes.NewReader(buf)
+		contentType = "application/json"
+	}
+	req, err := http.NewRequest(method, c.url(path, query), r)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+// do sends a request and returns the response, or an *Error for non 2xx responses.
+// The caller must close the response body.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	req, err := c.newRequest(method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s %s", method, path)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, newError(resp)
+	}
+	return resp, nil
+}
+
+// doJSON sends a request and decodes the json response into out, if not nil
+func (c *Client) doJSON(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	resp, err := c.do(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return errors.Wrapf(err, "decoding response of %s %s", method, path)
+	}
+	return nil
+}
+
+// doRaw sends a request and returns the raw response body
+func (c *Client) doRaw(ctx context.Context, method, path string, query url.Values, body interface{}) ([]byte, error) {
+	resp, err := c.do(ctx, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Ping checks that the daemon is reachable
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.doRaw(ctx, "GET", "/_ping", nil, nil)
+	return err
+}
+
+// Info returns system wide information about the daemon
+func (c *Client) Info(ctx context.Context) (*Info, error) {
+	var info Info
+	if err := c.doJSON(ctx, "GET", "/info", nil, nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
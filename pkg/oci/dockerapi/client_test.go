@@ -0,0 +1,173 @@
+package dockerapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newDaemon starts a fake daemon serving handler on a unix socket and
+// returns its DOCKER_HOST, and a func stopping it
+func newDaemon(t *testing.T, handler http.Handler) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "dockerapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sock := filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	s := httptest.NewUnstartedServer(handler)
+	s.Listener = l
+	s.Start()
+	return "unix://" + sock, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestNewClientDockerHost(t *testing.T) {
+	pinged := false
+	host, stop := newDaemon(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pinged = r.URL.Path == "/_ping"
+		w.Write([]byte("OK"))
+	}))
+	defer stop()
+
+	old, set := os.LookupEnv("DOCKER_HOST")
+	defer func() {
+		if set {
+			os.Setenv("DOCKER_HOST", old)
+		} else {
+			os.Unsetenv("DOCKER_HOST")
+		}
+	}()
+
+	os.Setenv("DOCKER_HOST", host)
+	c, err := NewClient()
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if err := c.Ping(context.Background()); err != nil || !pinged {
+		t.Errorf("Ping = %v, pinged %v, want the daemon at DOCKER_HOST to be pinged", err, pinged)
+	}
+
+	os.Unsetenv("DOCKER_HOST")
+	if c, err = NewClient(); err != nil || "unix://"+c.addr != DefaultHost {
+		t.Errorf("NewClient without DOCKER_HOST = %+v %v, want %s", c, err, DefaultHost)
+	}
+
+	for _, host := range []string{"tcp://127.0.0.1:2375/", "unix:///run/user/1000/docker.sock"} {
+		if _, err := NewClientWithHost(host); err != nil {
+			t.Errorf("NewClientWithHost(%s) = %v", host, err)
+		}
+	}
+	for _, host := range []string{"/var/run/docker.sock", "ssh://user@host", "npipe:////./pipe/docker_engine"} {
+		if _, err := NewClientWithHost(host); err == nil {
+			t.Errorf("NewClientWithHost(%s) succeeded", host)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	host, stop := newDaemon(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containers/missing/json":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"No such container: missing"}`))
+		case "/containers/create":
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"message":"Conflict. The container name \"/kic\" is already in use"}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("boom\n"))
+		}
+	}))
+	defer stop()
+	c, err := NewClientWithHost(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	_, err = c.ContainerInspect(ctx, "missing")
+	if !IsNotFound(err) || IsConflict(err) {
+		t.Errorf("inspecting a missing container = %v, want a not found error", err)
+	}
+	if want := "Error response from daemon (404): No such container: missing"; err == nil || err.Error() != want {
+		t.Errorf("error = %v, want %q", err, want)
+	}
+
+	_, err = c.ContainerCreate(ctx, "kic", ContainerCreateConfig{})
+	if !IsConflict(err) || IsNotFound(err) {
+		t.Errorf("creating a container with a name in use = %v, want a conflict error", err)
+	}
+
+	err = c.Ping(ctx)
+	if IsNotFound(err) || IsConflict(err) {
+		t.Errorf("a server error = %v, want neither not found nor conflict", err)
+	}
+	if e, ok := err.(*Error); !ok || e.StatusCode != 500 || e.Message != "boom" {
+		t.Errorf("a server error = %#v, want the status code and the plain text body", err)
+	}
+}
+
+func TestImagePull(t *testing.T) {
+	tests := []struct {
+		ref, fromImage, tag string
+	}{
+		{"busybox", "busybox", "latest"},
+		{"busybox:1.31", "busybox", "1.31"},
+		{"kindest/node:v1.16.3", "kindest/node", "v1.16.3"},
+		{"localhost:5000/kindest/node", "localhost:5000/kindest/node", "latest"},
+		{"localhost:5000/kindest/node:v1.16.3", "localhost:5000/kindest/node", "v1.16.3"},
+		{"kindest/node@sha256:0123", "kindest/node", "sha256:0123"},
+		{"kindest/node:v1.16.3@sha256:0123", "kindest/node", "sha256:0123"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.ref, func(t *testing.T) {
+			var fromImage, tag string
+			host, stop := newDaemon(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fromImage, tag = r.URL.Query().Get("fromImage"), r.URL.Query().Get("tag")
+				w.Write([]byte(`{"status":"Pulling from library"}` + "\n" + `{"status":"Downloaded newer image"}` + "\n"))
+			}))
+			defer stop()
+			c, err := NewClientWithHost(host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var messages int
+			if err := c.ImagePull(context.Background(), tc.ref, func(*JSONMessage) { messages++ }); err != nil {
+				t.Fatalf("ImagePull: %v", err)
+			}
+			if fromImage != tc.fromImage || tag != tc.tag {
+				t.Errorf("pulled fromImage=%s tag=%s, want fromImage=%s tag=%s", fromImage, tag, tc.fromImage, tc.tag)
+			}
+			if messages != 2 {
+				t.Errorf("got %d progress messages, want 2", messages)
+			}
+		})
+	}
+}
+
+func TestImagePullError(t *testing.T) {
+	host, stop := newDaemon(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"Pulling from library/busybox"}` + "\n" + `{"error":"manifest for busybox:nope not found"}` + "\n"))
+	}))
+	defer stop()
+	c, err := NewClientWithHost(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ImagePull(context.Background(), "busybox:nope", nil); err == nil {
+		t.Error("a pull failing in the progress stream succeeded")
+	}
+}
@@ -0,0 +1,129 @@
+package dockerapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ContainerCreate creates a container and returns its ID
+func (c *Client) ContainerCreate(ctx context.Context, name string, config ContainerCreateConfig) (string, error) {
+	query := url.Values{}
+	if name != "" {
+		query.Set("name", name)
+	}
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := c.doJSON(ctx, "POST", "/containers/create", query, config, &created); err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// ContainerStart starts a container
+func (c *Client) ContainerStart(ctx context.Context, id string) error {
+	return c.doJSON(ctx, "POST", "/containers/"+id+"/start", nil, nil, nil)
+}
+
+// ContainerStop stops a container
+func (c *Client) ContainerStop(ctx context.Context, id string) error {
+	return c.doJSON(ctx, "POST", "/containers/"+id+"/stop", nil, nil, nil)
+}
+
+// ContainerRestart stops and starts a container
+func (c *Client) ContainerRestart(ctx context.Context, id string) error {
+	return c.doJSON(ctx, "POST", "/containers/"+id+"/restart", nil, nil, nil)
+}
+
+// ContainerPause pauses all processes within a container
+func (c *Client) ContainerPause(ctx context.Context, id string) error {
+	return c.doJSON(ctx, "POST", "/containers/"+id+"/pause", nil, nil, nil)
+}
+
+// ContainerUnpause resumes all processes within a paused container
+func (c *Client) ContainerUnpause(ctx context.Context, id string) error {
+	return c.doJSON(ctx, "POST", "/containers/"+id+"/unpause", nil, nil, nil)
+}
+
+// ContainerRemove removes a container, force kills it if it is running and
+// volumes removes the anonymous volumes associated with it
+func (c *Client) ContainerRemove(ctx context.Context, id string, force, volumes bool) error {
+	query := url.Values{}
+	if force {
+		query.Set("force", "1")
+	}
+	if volumes {
+		query.Set("v", "1")
+	}
+	return c.doJSON(ctx, "DELETE", "/containers/"+id, query, nil, nil)
+}
+
+// ContainerInspect returns low-level information about a container
+func (c *Client) ContainerInspect(ctx context.Context, id string) (*ContainerJSON, error) {
+	info, _, err := c.ContainerInspectWithRaw(ctx, id)
+	return info, err
+}
+
+// ContainerInspectWithRaw returns low-level information about a container
+// and the raw json it was decoded from
+func (c *Client) ContainerInspectWithRaw(ctx context.Context, id string) (*ContainerJSON, []byte, error) {
+	raw, err := c.doRaw(ctx, "GET", "/containers/"+id+"/json", nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var info ContainerJSON
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return nil, nil, errors.Wrapf(err, "decoding container %s", id)
+	}
+	return &info, raw, nil
+}
+
+// ContainerList lists containers, filters are in the "key=value" form of
+// `docker ps --filter`, for example "label=io.k8s.sigs.kic.cluster"
+func (c *Client) ContainerList(ctx context.Context, all bool, filters ...string) ([]ContainerSummary, error) {
+	query := url.Values{}
+	if all {
+		query.Set("all", "1")
+	}
+	if len(filters) > 0 {
+		f, err := encodeFilters(filters)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("filters", f)
+	}
+	var list []ContainerSummary
+	if err := c.doJSON(ctx, "GET", "/containers/json", query, nil, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// CopyToContainer extracts the tar archive content into the directory dir of a container
+func (c *Client) CopyToContainer(ctx context.Context, id, dir string, content io.Reader) error {
+	query := url.Values{}
+	query.Set("path", dir)
+	return c.doJSON(ctx, "PUT", "/containers/"+id+"/archive", query, content, nil)
+}
+
+// encodeFilters converts "key=value" filters to the json map the API expects
+func encodeFilters(filters []string) (string, error) {
+	m := map[string][]string{}
+	for _, f := range filters {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return "", errors.Errorf("invalid filter %q, expected key=value", f)
+		}
+		m[kv[0]] = append(m[kv[0]], kv[1])
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
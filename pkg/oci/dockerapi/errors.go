@@ -0,0 +1,57 @@
+package dockerapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Error is returned when the daemon answers with a non 2xx status code
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Error response from daemon (%d): %s", e.StatusCode, e.Message)
+}
+
+// newError reads the error message of a failed response
+func newError(resp *http.Response) *Error {
+	e := &Error{StatusCode: resp.StatusCode}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		e.Message = http.StatusText(resp.StatusCode)
+		return e
+	}
+	var msg struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &msg) == nil && msg.Message != "" {
+		e.Message = msg.Message
+	} else {
+		e.Message = strings.TrimSpace(string(body))
+	}
+	return e
+}
+
+// IsNotFound returns true if err is a 404 response, eg a missing container or image
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsConflict returns true if err is a 409 response, eg a container name already in use
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+func hasStatus(err error, code int) bool {
+	if e, ok := errors.Cause(err).(*Error); ok {
+		return e.StatusCode == code
+	}
+	return false
+}
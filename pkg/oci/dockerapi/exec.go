@@ -0,0 +1,135 @@
+package dockerapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// ContainerExec runs a command in a running container, streaming stdin to it
+// and its output to stdout and stderr, and returns the command's exit code
+func (c *Client) ContainerExec(ctx context.Context, id string, config ExecConfig, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	config.AttachStdin = stdin != nil
+	config.AttachStdout = true
+	config.AttachStderr = true
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := c.doJSON(ctx, "POST", "/containers/"+id+"/exec", nil, config, &created); err != nil {
+		return -1, err
+	}
+
+	conn, br, err := c.hijack(ctx, "/exec/"+created.ID+"/start", map[string]bool{"Detach": false, "Tty": config.Tty})
+	if err != nil {
+		return -1, err
+	}
+	defer conn.Close()
+	// unblock the reads and writes below when the context is cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	if stdin != nil {
+		go func() {
+			_, _ = io.Copy(conn, stdin)
+			// signal EOF to the command while still reading its output
+			if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+				_ = cw.CloseWrite()
+			}
+		}()
+	}
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+	if config.Tty {
+		_, err = io.Copy(stdout, br)
+	} else {
+		err = demux(br, stdout, stderr)
+	}
+	if ctx.Err() != nil {
+		return -1, ctx.Err()
+	}
+	if err != nil {
+		return -1, errors.Wrap(err, "reading exec output")
+	}
+
+	var inspect struct {
+		Running  bool
+		ExitCode int
+	}
+	if err := c.doJSON(ctx, "GET", "/exec/"+created.ID+"/json", nil, nil, &inspect); err != nil {
+		return -1, err
+	}
+	return inspect.ExitCode, nil
+}
+
+// hijack sends a request that upgrades the connection to a raw stream
+func (c *Client) hijack(ctx context.Context, path string, body interface{}) (net.Conn, *bufio.Reader, error) {
+	req, err := c.newRequest("POST", path, nil, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "connecting to docker daemon")
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, errors.Wrapf(err, "POST %s", path)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, errors.Wrapf(err, "POST %s", path)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.StatusCode != http.StatusOK {
+		defer conn.Close()
+		return nil, nil, newError(resp)
+	}
+	return conn, br, nil
+}
+
+// demux splits the multiplexed stdout/stderr stream of a non-tty exec,
+// every frame has an 8 byte header: [stream, 0, 0, 0, size (4 bytes big endian)]
+func demux(r io.Reader, stdout, stderr io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		var w io.Writer
+		switch header[0] {
+		case 0, 1: // stdin is written to stdout
+			w = stdout
+		case 2:
+			w = stderr
+		default:
+			return errors.Errorf("unknown stream %d in exec output", header[0])
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(w, r, size); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package dockerapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ImageInspect returns low-level information about an image
+func (c *Client) ImageInspect(ctx context.Context, name string) (*ImageInspect, error) {
+	info, _, err := c.ImageInspectWithRaw(ctx, name)
+	return info, err
+}
+
+// ImageInspectWithRaw returns low-level information about an image and
+// the raw json it was decoded from
+func (c *Client) ImageInspectWithRaw(ctx context.Context, name string) (*ImageInspect, []byte, error) {
+	raw, err := c.doRaw(ctx, "GET", "/images/"+name+"/json", nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var info ImageInspect
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return nil, nil, errors.Wrapf(err, "decoding image %s", name)
+	}
+	return &info, raw, nil
+}
+
+// ImagePull pulls an image, the reference may include a tag or a digest and
+// defaults to the latest tag, as the daemon pulls all the tags of a
+// repository when none is given.
+// progress, if not nil, is called for every message of the progress stream.
+func (c *Client) ImagePull(ctx context.Context, ref string, progress func(*JSONMessage)) error {
+	repo, tag := splitReference(ref)
+	query := url.Values{}
+	query.Set("fromImage", repo)
+	query.Set("tag", tag)
+	resp, err := c.do(ctx, "POST", "/images/create", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// the daemon answers 200 and then reports failures in the progress stream
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg JSONMessage
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "reading pull progress of %s", ref)
+		}
+		if msg.Error != "" {
+			return errors.Errorf("pulling %s: %s", ref, msg.Error)
+		}
+		if progress != nil {
+			progress(&msg)
+		}
+	}
+}
+
+// splitReference splits an image reference into its repository and its tag
+// or digest, which defaults to latest
+func splitReference(ref string) (repo, tag string) {
+	if i := strings.Index(ref, "@"); i >= 0 {
+		// the tag of "name:tag@digest" is ignored by the daemon
+		repo, tag = ref[:i], ref[i+1:]
+		if j := strings.LastIndex(repo, ":"); j > strings.LastIndex(repo, "/") {
+			repo = repo[:j]
+		}
+		return repo, tag
+	}
+	// a colon before the last slash is the port of the registry
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, "latest"
+}
+
+// ImageSave returns a tar archive of an image, the caller must close it
+func (c *Client) ImageSave(ctx context.Context, name string) (io.ReadCloser, error) {
+	query := url.Values{}
+	query.Add("names", name)
+	resp, err := c.do(ctx, "GET", "/images/get", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
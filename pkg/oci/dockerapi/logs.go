@@ -0,0 +1,67 @@
+package dockerapi
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// LogsConfig are the options of ContainerLogs
+type LogsConfig struct {
+	Follow     bool
+	Since      time.Time // zero for all the logs
+	Tail       int       // the number of lines from the end, zero for all
+	Timestamps bool
+}
+
+// ContainerLogs returns the output of a container, stdout and stderr
+// interleaved. The caller must close it, which stops following the logs.
+func (c *Client) ContainerLogs(ctx context.Context, id string, config LogsConfig) (io.ReadCloser, error) {
+	info, err := c.ContainerInspect(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	query.Set("stdout", "1")
+	query.Set("stderr", "1")
+	if config.Follow {
+		query.Set("follow", "1")
+	}
+	if !config.Since.IsZero() {
+		query.Set("since", strconv.FormatInt(config.Since.Unix(), 10))
+	}
+	if config.Tail > 0 {
+		query.Set("tail", strconv.Itoa(config.Tail))
+	}
+	if config.Timestamps {
+		query.Set("timestamps", "1")
+	}
+	resp, err := c.do(ctx, "GET", "/containers/"+id+"/logs", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	if info.Config != nil && info.Config.Tty {
+		return resp.Body, nil
+	}
+	// without a tty the output is multiplexed like the one of exec
+	pr, pw := io.Pipe()
+	go func() {
+		err := demux(resp.Body, pw, pw)
+		resp.Body.Close()
+		pw.CloseWithError(err)
+	}()
+	return &logsReader{PipeReader: pr, body: resp.Body}, nil
+}
+
+// logsReader closes the response body along with the demuxed pipe
+type logsReader struct {
+	*io.PipeReader
+	body io.Closer
+}
+
+func (r *logsReader) Close() error {
+	r.body.Close()
+	return r.PipeReader.Close()
+}
@@ -0,0 +1,61 @@
+package dockerapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// NetworkInspect returns low-level information about a network
+func (c *Client) NetworkInspect(ctx context.Context, name string) (*NetworkResource, error) {
+	info, _, err := c.NetworkInspectWithRaw(ctx, name)
+	return info, err
+}
+
+// NetworkInspectWithRaw returns low-level information about a network and
+// the raw json it was decoded from
+func (c *Client) NetworkInspectWithRaw(ctx context.Context, name string) (*NetworkResource, []byte, error) {
+	raw, err := c.doRaw(ctx, "GET", "/networks/"+name, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var info NetworkResource
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return nil, nil, errors.Wrapf(err, "decoding network %s", name)
+	}
+	return &info, raw, nil
+}
+
+// NetworkCreate creates a network and returns its ID
+func (c *Client) NetworkCreate(ctx context.Context, config NetworkCreateConfig) (string, error) {
+	var resp NetworkCreateResponse
+	if err := c.doJSON(ctx, "POST", "/networks/create", nil, config, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// NetworkList lists networks, filters are in the "key=value" form of
+// `docker network ls --filter`, for example "label=io.k8s.sigs.kic.cluster"
+func (c *Client) NetworkList(ctx context.Context, filters ...string) ([]NetworkResource, error) {
+	query := url.Values{}
+	if len(filters) > 0 {
+		f, err := encodeFilters(filters)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("filters", f)
+	}
+	var list []NetworkResource
+	if err := c.doJSON(ctx, "GET", "/networks", query, nil, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// NetworkRemove removes a network
+func (c *Client) NetworkRemove(ctx context.Context, name string) error {
+	return c.doJSON(ctx, "DELETE", "/networks/"+name, nil, nil, nil)
+}
@@ -0,0 +1,263 @@
+package dockerapi
+
+// These types are a subset of the ones in github.com/docker/docker/api/types,
+// only the fields kic uses are decoded.
+
+// Info is the response of GET /info
+type Info struct {
+	ID              string
+	Name            string
+	ServerVersion   string
+	OperatingSystem string
+	NCPU            int
+	MemTotal        int64
+	SecurityOptions []string
+}
+
+// ContainerJSON is the response of GET /containers/{id}/json
+type ContainerJSON struct {
+	ID              string `json:"Id"`
+	Name            string
+	Image           string
+	Created         string
+	RestartCount    int
+	State           *ContainerState
+	Config          *ContainerConfig
+	HostConfig      *HostConfig
+	NetworkSettings *NetworkSettings
+	Mounts          []MountPoint
+}
+
+// ContainerState is the state of a container
+type ContainerState struct {
+	Status     string
+	Running    bool
+	Paused     bool
+	Restarting bool
+	OOMKilled  bool
+	Dead       bool
+	Pid        int
+	ExitCode   int
+	Error      string
+	StartedAt  string
+	FinishedAt string
+	Health     *Health `json:",omitempty"`
+}
+
+// Health is the healthcheck state of a container
+type Health struct {
+	Status        string
+	FailingStreak int
+}
+
+// ContainerConfig is the portable configuration of a container
+type ContainerConfig struct {
+	Hostname     string              `json:",omitempty"`
+	User         string              `json:",omitempty"`
+	Tty          bool                `json:",omitempty"`
+	OpenStdin    bool                `json:",omitempty"`
+	Env          []string            `json:",omitempty"`
+	Cmd          []string            `json:",omitempty"`
+	Entrypoint   []string            `json:",omitempty"`
+	WorkingDir   string              `json:",omitempty"`
+	Image        string              `json:",omitempty"`
+	Labels       map[string]string   `json:",omitempty"`
+	ExposedPorts map[string]struct{} `json:",omitempty"`
+	StopSignal   string              `json:",omitempty"`
+}
+
+// HostConfig is the non-portable configuration of a container
+type HostConfig struct {
+	Binds         []string                 `json:",omitempty"`
+	Privileged    bool                     `json:",omitempty"`
+	SecurityOpt   []string                 `json:",omitempty"`
+	Tmpfs         map[string]string        `json:",omitempty"`
+	PortBindings  map[string][]PortBinding `json:",omitempty"`
+	UsernsMode    string                   `json:",omitempty"`
+	NetworkMode   string                   `json:",omitempty"`
+	NanoCPUs      int64                    `json:",omitempty"`
+	Memory        int64                    `json:",omitempty"`
+	RestartPolicy *RestartPolicy           `json:",omitempty"`
+
+	CapAdd         []string          `json:",omitempty"`
+	CapDrop        []string          `json:",omitempty"`
+	Devices        []DeviceMapping   `json:",omitempty"`
+	DNS            []string          `json:"Dns,omitempty"`
+	DNSSearch      []string          `json:"DnsSearch,omitempty"`
+	DNSOptions     []string          `json:"DnsOptions,omitempty"`
+	ExtraHosts     []string          `json:",omitempty"`
+	Init           *bool             `json:",omitempty"`
+	ShmSize        int64             `json:",omitempty"`
+	Sysctls        map[string]string `json:",omitempty"`
+	ReadonlyRootfs bool              `json:",omitempty"`
+	AutoRemove     bool              `json:",omitempty"`
+	LogConfig      *LogConfig        `json:",omitempty"`
+	IpcMode        string            `json:",omitempty"`
+	PidMode        string            `json:",omitempty"`
+	CgroupnsMode   string            `json:",omitempty"`
+}
+
+// DeviceMapping is a host device made available in a container
+type DeviceMapping struct {
+	PathOnHost        string
+	PathInContainer   string
+	CgroupPermissions string
+}
+
+// LogConfig is the logging driver of a container
+type LogConfig struct {
+	Type   string
+	Config map[string]string `json:",omitempty"`
+}
+
+// RestartPolicy is the policy applied when a container exits
+type RestartPolicy struct {
+	Name              string
+	MaximumRetryCount int `json:",omitempty"`
+}
+
+// PortBinding is a host address a container port is published on
+type PortBinding struct {
+	HostIP   string `json:"HostIp"`
+	HostPort string
+}
+
+// NetworkSettings are the network settings of a container
+type NetworkSettings struct {
+	Networks map[string]*EndpointSettings
+	Ports    map[string][]PortBinding
+}
+
+// EndpointSettings are the settings of a container on a network
+type EndpointSettings struct {
+	IPAMConfig        *EndpointIPAMConfig `json:",omitempty"`
+	NetworkID         string              `json:"NetworkID,omitempty"`
+	IPAddress         string              `json:",omitempty"`
+	IPPrefixLen       int                 `json:",omitempty"`
+	Gateway           string              `json:",omitempty"`
+	GlobalIPv6Address string              `json:",omitempty"`
+	IPv6Gateway       string              `json:",omitempty"`
+	MacAddress        string              `json:",omitempty"`
+}
+
+// EndpointIPAMConfig are the static addresses of a container on a network
+type EndpointIPAMConfig struct {
+	IPv4Address string `json:",omitempty"`
+	IPv6Address string `json:",omitempty"`
+}
+
+// MountPoint is a mount of a container
+type MountPoint struct {
+	Type        string
+	Name        string
+	Source      string
+	Destination string
+	Mode        string
+	RW          bool
+	Propagation string
+}
+
+// ContainerCreateConfig is the body of POST /containers/create
+type ContainerCreateConfig struct {
+	ContainerConfig
+	HostConfig       *HostConfig       `json:",omitempty"`
+	NetworkingConfig *NetworkingConfig `json:",omitempty"`
+}
+
+// NetworkingConfig are the settings of the networks a container is created on
+type NetworkingConfig struct {
+	EndpointsConfig map[string]*EndpointSettings
+}
+
+// ContainerSummary is an entry of GET /containers/json
+type ContainerSummary struct {
+	ID     string `json:"Id"`
+	Names  []string
+	Image  string
+	State  string
+	Status string
+	Labels map[string]string
+}
+
+// ExecConfig is the body of POST /containers/{id}/exec
+type ExecConfig struct {
+	User         string   `json:",omitempty"`
+	Privileged   bool     `json:",omitempty"`
+	Tty          bool     `json:",omitempty"`
+	AttachStdin  bool     `json:",omitempty"`
+	AttachStdout bool     `json:",omitempty"`
+	AttachStderr bool     `json:",omitempty"`
+	Env          []string `json:",omitempty"`
+	WorkingDir   string   `json:",omitempty"`
+	Cmd          []string
+}
+
+// ImageInspect is the response of GET /images/{name}/json
+type ImageInspect struct {
+	ID          string `json:"Id"`
+	RepoTags    []string
+	RepoDigests []string
+	Size        int64
+}
+
+// JSONMessage is a message of the progress stream of an image pull
+type JSONMessage struct {
+	ID             string `json:"id"`
+	Status         string `json:"status"`
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
+	Error string `json:"error"`
+}
+
+// NetworkResource is the response of GET /networks/{id}
+type NetworkResource struct {
+	Name       string
+	ID         string `json:"Id"`
+	Driver     string
+	EnableIPv6 bool
+	IPAM       IPAM
+	Internal   bool
+	Containers map[string]EndpointResource
+	Options    map[string]string
+	Labels     map[string]string
+}
+
+// IPAM is the IP address management configuration of a network
+type IPAM struct {
+	Driver string
+	Config []IPAMConfig
+}
+
+// IPAMConfig is an address pool of a network
+type IPAMConfig struct {
+	Subnet  string `json:",omitempty"`
+	IPRange string `json:",omitempty"`
+	Gateway string `json:",omitempty"`
+}
+
+// EndpointResource is a container attached to a network
+type EndpointResource struct {
+	Name        string
+	EndpointID  string
+	MacAddress  string
+	IPv4Address string
+	IPv6Address string
+}
+
+// NetworkCreateConfig is the body of POST /networks/create
+type NetworkCreateConfig struct {
+	Name           string
+	CheckDuplicate bool
+	Driver         string
+	EnableIPv6     bool
+	IPAM           *IPAM             `json:",omitempty"`
+	Labels         map[string]string `json:",omitempty"`
+}
+
+// NetworkCreateResponse is the response of POST /networks/create
+type NetworkCreateResponse struct {
+	ID      string `json:"Id"`
+	Warning string
+}
@@ -0,0 +1,46 @@
+package dockerapi
+
+import (
+	"context"
+	"net/url"
+)
+
+// VolumeCreate creates a named volume
+func (c *Client) VolumeCreate(ctx context.Context, name string, labels map[string]string) error {
+	body := struct {
+		Name   string
+		Labels map[string]string `json:",omitempty"`
+	}{name, labels}
+	return c.doJSON(ctx, "POST", "/volumes/create", nil, body, nil)
+}
+
+// VolumeList lists the names of volumes, filters are in the "key=value"
+// form of `docker volume ls --filter`
+func (c *Client) VolumeList(ctx context.Context, filters ...string) ([]string, error) {
+	query := url.Values{}
+	if len(filters) > 0 {
+		f, err := encodeFilters(filters)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("filters", f)
+	}
+	var list struct {
+		Volumes []struct {
+			Name string
+		}
+	}
+	if err := c.doJSON(ctx, "GET", "/volumes", query, nil, &list); err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, v := range list.Volumes {
+		names = append(names, v.Name)
+	}
+	return names, nil
+}
+
+// VolumeRemove removes a named volume
+func (c *Client) VolumeRemove(ctx context.Context, name string) error {
+	return c.doJSON(ctx, "DELETE", "/volumes/"+name, nil, nil, nil)
+}
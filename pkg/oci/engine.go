@@ -0,0 +1,148 @@
+package oci
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/docker/machine/libmachine/state"
+	"github.com/medyagh/kic/pkg/assets"
+	"github.com/medyagh/kic/pkg/config/resource"
+)
+
+const (
+	// Docker is the name of the docker container engine
+	Docker = "docker"
+	// Podman is the name of the podman container engine
+	Podman = "podman"
+)
+
+// DefaultOCI is the container engine used when none is specified
+const DefaultOCI = Docker
+
+// Engine is a container engine backend that kic nodes can be run on.
+// Every operation takes a context, cancelling it kills the in-flight engine call.
+type Engine interface {
+	// Name returns the name of the engine, for example docker or podman
+	Name() string
+
+	// CreateContainer creates a container with "docker/podman run"
+	CreateContainer(ctx context.Context, image string, opts ...CreateOpt) ([]string, error)
+	// Inspect return low-level information on containers, formatted with a go template
+	Inspect(ctx context.Context, containerNameOrID, format string) ([]string, error)
+	// ContainerInfo returns the low-level information about a container
+	ContainerInfo(ctx context.Context, containerNameOrID string) (*ContainerInfo, error)
+	// ListContainers lists the names of all the containers matching the filters
+	ListContainers(ctx context.Context, filters ...string) ([]string, error)
+	// Status returns the state of a container
+	Status(ctx context.Context, ociID string) (state.State, error)
+	// SystemStatus checks if the container engine is running
+	SystemStatus(ctx context.Context) (state.State, error)
+	// HostCapacity returns the CPUs and memory available to containers
+	HostCapacity(ctx context.Context) (resource.Host, error)
+
+	// Start starts a stopped container
+	Start(ctx context.Context, ociID string) error
+	// Stop stops a container
+	Stop(ctx context.Context, ociID string) error
+	// Restart stops and starts a container
+	Restart(ctx context.Context, ociID string) error
+	// Pause pauses all processes within a container
+	Pause(ctx context.Context, ociID string) error
+	// Unpause resumes all processes within a paused container
+	Unpause(ctx context.Context, ociID string) error
+	// Remove removes a container
+	Remove(ctx context.Context, ociID string) error
+
+	// Exec runs a command in a running container and returns its exit code
+	Exec(ctx context.Context, ociID string, opts ExecOptions) (int, error)
+	// Logs returns the output of a container, closing it stops following the logs
+	Logs(ctx context.Context, ociID string, opts LogsOptions) (io.ReadCloser, error)
+	// Copy copies a local asset into the container
+	Copy(ctx context.Context, ociID string, asset assets.CopyAsset) error
+
+	// Pull pulls an image, reporting the progress to progress if not nil.
+	// Failures are returned as a *PullError.
+	Pull(ctx context.Context, image string, progress PullProgress) error
+	// Save saves an image to a tar archive
+	Save(ctx context.Context, image, dest string) error
+	// ImageInspect return low-level information on container images
+	ImageInspect(ctx context.Context, image, format string) ([]string, error)
+
+	// NetworkInspect displays detailed information on one or more networks
+	NetworkInspect(ctx context.Context, networkNames []string, format string) ([]string, error)
+	// NetworkInfo returns the low-level information about a network
+	NetworkInfo(ctx context.Context, name string) (*NetworkInfo, error)
+	// CreateNetwork creates a bridge network
+	CreateNetwork(ctx context.Context, name string, opts NetworkOptions) error
+	// ListNetworks lists the names of the networks matching the filters
+	ListNetworks(ctx context.Context, filters ...string) ([]string, error)
+	// RemoveNetwork removes a network
+	RemoveNetwork(ctx context.Context, name string) error
+	// CreateVolume creates a named volume, creating an existing volume is a no-op
+	CreateVolume(ctx context.Context, name string, labels map[string]string) error
+	// ListVolumes lists the names of the volumes matching the filters
+	ListVolumes(ctx context.Context, filters ...string) ([]string, error)
+	// RemoveVolume removes a named volume
+	RemoveVolume(ctx context.Context, name string) error
+
+	// UsernsRemap checks if userns-remap is enabled in the engine
+	UsernsRemap(ctx context.Context) bool
+}
+
+// ExecOptions describes a command to be run inside a container by Engine.Exec
+type ExecOptions struct {
+	Cmd        []string // the command and its arguments
+	Env        []string // environment in the form of KEY=VALUE
+	WorkingDir string   // working directory of the command, the container's by default
+	User       string   // user to run the command as, the container's by default
+	Stdin      io.Reader
+	Stdout     io.Writer
+	Stderr     io.Writer
+	TTY        bool // allocate a pseudo-TTY
+	Privileged bool // give extended privileges to the command
+}
+
+// NewEngine returns the Engine for a container engine name
+func NewEngine(name string) (Engine, error) {
+	switch name {
+	case Docker:
+		return NewDocker(), nil
+	case Podman:
+		return NewPodman(), nil
+	case DockerAPI:
+		return NewDockerAPI()
+	default:
+		return nil, fmt.Errorf("unsupported container engine: %q", name)
+	}
+}
+
+// NewDocker returns an Engine that uses the docker command line client
+func NewDocker() Engine {
+	return &cli{bin: Docker}
+}
+
+// NewPodman returns an Engine that uses the podman command line client
+func NewPodman() Engine {
+	return &podman{cli{bin: Podman}}
+}
+
+// cli implements Engine by shelling out to a docker compatible command line client
+type cli struct {
+	bin string
+}
+
+// Name returns the name of the binary backing this engine
+func (c *cli) Name() string {
+	return c.bin
+}
+
+// podman is mostly docker compatible, only the differences are implemented here
+type podman struct {
+	cli
+}
+
+// UsernsRemap always returns false as podman has no daemon to remap users in
+func (p *podman) UsernsRemap(ctx context.Context) bool {
+	return false
+}
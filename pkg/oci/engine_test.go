@@ -0,0 +1,54 @@
+package oci
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakePodman is a podman keeping its volumes as files of a directory, which
+// fails to create an existing volume and filters volumes by substring. It
+// has no containers.
+const fakePodman = `#!/bin/sh
+dir=$(dirname "$0")/volumes
+mkdir -p "$dir"
+echo "$@" >> "$dir/../calls"
+case "$1 $2" in
+"volume create")
+	for name; do :; done
+	if [ -e "$dir/$name" ]; then
+		echo "Error: volume with name $name already exists: volume already exists" >&2
+		exit 125
+	fi
+	touch "$dir/$name"
+	;;
+"inspect --type=container")
+	echo "Error: error inspecting object: no such container $3" >&2
+	exit 125
+	;;
+"volume ls")
+	filter=$(echo "$@" | sed -n 's/.*--filter name=\([^ ]*\).*/\1/p')
+	ls "$dir" | grep -F -- "$filter"
+	exit 0
+	;;
+*)
+	exit 1
+	;;
+esac
+`
+
+// newFakePodman returns a cli Engine running fakePodman, and a func removing it
+func newFakePodman(t *testing.T) (*cli, string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "podman")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(dir, "podman")
+	if err := ioutil.WriteFile(bin, []byte(fakePodman), 0755); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return &cli{bin: bin}, dir, func() { os.RemoveAll(dir) }
+}
@@ -0,0 +1,47 @@
+package oci
+
+import (
+	"context"
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// Exec runs a command in a running container with "docker/podman exec"
+func (c *cli) Exec(ctx context.Context, ociID string, opts ExecOptions) (int, error) {
+	args := []string{"exec"}
+	if opts.Privileged {
+		args = append(args, "--privileged")
+	}
+	if opts.Stdin != nil {
+		args = append(args, "-i") // interactive so we can supply input
+	}
+	if opts.TTY {
+		args = append(args, "-t")
+	}
+	for _, env := range opts.Env {
+		args = append(args, "-e", env)
+	}
+	if opts.WorkingDir != "" {
+		args = append(args, "--workdir", opts.WorkingDir)
+	}
+	if opts.User != "" {
+		args = append(args, "--user", opts.User)
+	}
+	// specify the container and command, after this everything will be
+	// args the the command in the container rather than to the engine
+	args = append(args, ociID)
+	args = append(args, opts.Cmd...)
+
+	cmd := exec.CommandContext(ctx, c.bin, args...)
+	cmd.Stdin = opts.Stdin
+	cmd.Stdout = opts.Stdout
+	cmd.Stderr = opts.Stderr
+	if err := cmd.Run(); err != nil {
+		if exitError, ok := err.(*exec.ExitError); ok {
+			return exitError.ExitCode(), errors.Wrapf(err, "command failed: %s", cmd.Args)
+		}
+		return -1, errors.Wrapf(err, "command failed: %s", cmd.Args)
+	}
+	return 0, nil
+}
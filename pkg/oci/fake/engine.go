@@ -0,0 +1,595 @@
+// Package fake provides an in-memory oci.Engine for unit tests, which keeps
+// containers, networks, volumes and images without a container engine
+package fake
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/machine/libmachine/state"
+	"github.com/medyagh/kic/pkg/assets"
+	"github.com/medyagh/kic/pkg/config/resource"
+	"github.com/medyagh/kic/pkg/oci"
+	"github.com/medyagh/kic/pkg/oci/dockerapi"
+	"github.com/medyagh/kic/pkg/oci/internal/inspect"
+	"github.com/pkg/errors"
+)
+
+// ExecFunc runs a command in a container of the fake engine and returns its exit code
+type ExecFunc func(ctx context.Context, container string, opts oci.ExecOptions) (int, error)
+
+// Engine is an in-memory oci.Engine. Containers "run" as soon as they are
+// created, and commands exec'ed in them are handled by ExecHandler.
+type Engine struct {
+	// ExecHandler handles the commands run in containers, by default they
+	// succeed without output. See command/fake.ExecWith to script them with
+	// a Runner.
+	ExecHandler ExecFunc
+	// Host is the capacity reported by HostCapacity
+	Host resource.Host
+	// Userns is reported by UsernsRemap
+	Userns bool
+
+	mu         sync.Mutex
+	seq        int
+	containers map[string]*dockerapi.ContainerJSON // by name
+	logs       map[string]string
+	copied     map[string][]assets.CopyAsset
+	networks   map[string]*dockerapi.NetworkResource
+	volumes    map[string]map[string]string // labels by volume name
+	images     map[string]string            // IDs by reference
+	nextPort   int
+}
+
+// NewEngine returns an empty Engine with the default bridge network
+func NewEngine() *Engine {
+	f := &Engine{
+		Host:       resource.Host{CPUs: 8, Memory: 16 * resource.GiB},
+		containers: map[string]*dockerapi.ContainerJSON{},
+		logs:       map[string]string{},
+		copied:     map[string][]assets.CopyAsset{},
+		networks:   map[string]*dockerapi.NetworkResource{},
+		volumes:    map[string]map[string]string{},
+		images:     map[string]string{},
+		nextPort:   32768,
+	}
+	f.networks["bridge"] = &dockerapi.NetworkResource{
+		Name:   "bridge",
+		ID:     f.newID("bridge"),
+		Driver: "bridge",
+		IPAM:   dockerapi.IPAM{Config: []dockerapi.IPAMConfig{{Subnet: "172.17.0.0/16", Gateway: "172.17.0.1"}}},
+	}
+	return f
+}
+
+var _ oci.Engine = &Engine{}
+
+// Name returns "fake"
+func (f *Engine) Name() string {
+	return "fake"
+}
+
+// newID returns a unique docker style ID
+func (f *Engine) newID(seed string) string {
+	f.seq++
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s-%d", seed, f.seq))))
+}
+
+// AddImage makes an image present, as if it was pulled
+func (f *Engine) AddImage(image string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.addImage(image)
+}
+
+func (f *Engine) addImage(image string) string {
+	if id, ok := f.images[image]; ok {
+		return id
+	}
+	id := "sha256:" + f.newID(image)
+	f.images[image] = id
+	return id
+}
+
+// TagImage makes tag refer to the image of image, like "docker tag"
+func (f *Engine) TagImage(image, tag string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id, ok := f.images[image]
+	if !ok {
+		return errors.Errorf("No such image: %s", image)
+	}
+	f.images[tag] = id
+	return nil
+}
+
+// SetLogs sets the output of a container returned by Logs
+func (f *Engine) SetLogs(container, logs string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.logs[container] = logs
+}
+
+// Copied returns the assets copied into a container
+func (f *Engine) Copied(container string) []assets.CopyAsset {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]assets.CopyAsset(nil), f.copied[container]...)
+}
+
+// CreateContainer creates and starts a container from the run args kic generates
+func (f *Engine) CreateContainer(ctx context.Context, image string, opts ...oci.CreateOpt) ([]string, error) {
+	existing, err := oci.ResolveConflict(ctx, f, image, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if existing != "" {
+		return []string{existing}, nil
+	}
+	name, config, err := oci.CreateConfig(image, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if name == "" {
+		name = fmt.Sprintf("container-%d", f.seq+1)
+	}
+	if _, ok := f.containers[name]; ok {
+		return nil, &oci.ConflictError{Name: name, Reason: "the name is already in use"}
+	}
+	network := config.HostConfig.NetworkMode
+	if network == "" {
+		network = "bridge"
+	}
+	if _, ok := f.networks[network]; !ok {
+		return nil, errors.Errorf("network %s not found", network)
+	}
+	ep := &dockerapi.EndpointSettings{}
+	if config.NetworkingConfig != nil {
+		if s := config.NetworkingConfig.EndpointsConfig[network]; s != nil && s.IPAMConfig != nil {
+			ep.IPAMConfig = s.IPAMConfig
+		}
+	}
+	for _, bind := range config.HostConfig.Binds {
+		// named volumes are created on first use
+		if v := strings.SplitN(bind, ":", 2)[0]; !strings.HasPrefix(v, "/") {
+			if _, ok := f.volumes[v]; !ok {
+				f.volumes[v] = map[string]string{}
+			}
+		}
+	}
+	c := &dockerapi.ContainerJSON{
+		ID:         f.newID(name),
+		Name:       "/" + name,
+		Image:      f.addImage(image),
+		Created:    time.Now().UTC().Format(time.RFC3339Nano),
+		State:      &dockerapi.ContainerState{Status: "created"},
+		Config:     &config.ContainerConfig,
+		HostConfig: config.HostConfig,
+		NetworkSettings: &dockerapi.NetworkSettings{
+			Networks: map[string]*dockerapi.EndpointSettings{network: ep},
+			Ports:    map[string][]dockerapi.PortBinding{},
+		},
+	}
+	for port, bindings := range config.HostConfig.PortBindings {
+		for _, b := range bindings {
+			if b.HostPort == "" || b.HostPort == "0" {
+				b.HostPort = strconv.Itoa(f.nextPort)
+				f.nextPort++
+			}
+			if b.HostIP == "" {
+				b.HostIP = "0.0.0.0"
+			}
+			c.NetworkSettings.Ports[port] = append(c.NetworkSettings.Ports[port], b)
+		}
+	}
+	f.containers[name] = c
+	if err := f.start(c); err != nil {
+		delete(f.containers, name)
+		return nil, err
+	}
+	return []string{c.ID}, nil
+}
+
+// container returns a container by name or ID
+func (f *Engine) container(nameOrID string) (*dockerapi.ContainerJSON, error) {
+	if c, ok := f.containers[nameOrID]; ok {
+		return c, nil
+	}
+	for _, c := range f.containers {
+		if c.ID == nameOrID || (len(nameOrID) >= 12 && strings.HasPrefix(c.ID, nameOrID)) {
+			return c, nil
+		}
+	}
+	return nil, &oci.NotFoundError{Name: nameOrID}
+}
+
+// start runs a container, giving it an address on its network
+func (f *Engine) start(c *dockerapi.ContainerJSON) error {
+	for name, ep := range c.NetworkSettings.Networks {
+		nw := f.networks[name]
+		if nw == nil {
+			return errors.Errorf("network %s not found", name)
+		}
+		ip, prefix, gateway, err := f.address(nw, ep)
+		if err != nil {
+			return err
+		}
+		ep.NetworkID, ep.IPAddress, ep.IPPrefixLen, ep.Gateway = nw.ID, ip, prefix, gateway
+		v4 := net.ParseIP(ip).To4()
+		ep.MacAddress = fmt.Sprintf("02:42:%02x:%02x:%02x:%02x", v4[0], v4[1], v4[2], v4[3])
+	}
+	c.State.Status = "running"
+	c.State.Running = true
+	c.State.Paused = false
+	c.State.ExitCode = 0
+	c.State.Pid = 1000 + f.seq
+	c.State.StartedAt = time.Now().UTC().Format(time.RFC3339Nano)
+	return nil
+}
+
+// address returns the static address of an endpoint, or the first free one of the network
+func (f *Engine) address(nw *dockerapi.NetworkResource, ep *dockerapi.EndpointSettings) (ip string, prefix int, gateway string, err error) {
+	var subnet *net.IPNet
+	for _, c := range nw.IPAM.Config {
+		if _, n, err := net.ParseCIDR(c.Subnet); err == nil && n.IP.To4() != nil {
+			subnet, gateway = n, c.Gateway
+			break
+		}
+	}
+	if subnet == nil {
+		return "", 0, "", errors.Errorf("network %s has no IPv4 subnet", nw.Name)
+	}
+	prefix, _ = subnet.Mask.Size()
+	used := map[string]bool{gateway: true}
+	for _, c := range f.containers {
+		if other := c.NetworkSettings.Networks[nw.Name]; other != nil && other != ep {
+			used[other.IPAddress] = true
+			if other.IPAMConfig != nil {
+				used[other.IPAMConfig.IPv4Address] = true
+			}
+		}
+	}
+	if ep.IPAMConfig != nil && ep.IPAMConfig.IPv4Address != "" {
+		ip = ep.IPAMConfig.IPv4Address
+		if !subnet.Contains(net.ParseIP(ip)) {
+			return "", 0, "", errors.Errorf("address %s is not in subnet %s", ip, subnet)
+		}
+		if used[ip] {
+			return "", 0, "", errors.Errorf("address %s is already in use", ip)
+		}
+		return ip, prefix, gateway, nil
+	}
+	base := subnet.IP.To4()
+	for i := 2; i < 255; i++ {
+		candidate := net.IPv4(base[0], base[1], base[2], base[3]+byte(i)).String()
+		if !used[candidate] {
+			return candidate, prefix, gateway, nil
+		}
+	}
+	return "", 0, "", errors.Errorf("no free address on network %s", nw.Name)
+}
+
+// stop stops a container, which loses its addresses
+func (f *Engine) stop(c *dockerapi.ContainerJSON, exitCode int) {
+	c.State.Status = "exited"
+	c.State.Running = false
+	c.State.Paused = false
+	c.State.ExitCode = exitCode
+	c.State.Pid = 0
+	c.State.FinishedAt = time.Now().UTC().Format(time.RFC3339Nano)
+	for _, ep := range c.NetworkSettings.Networks {
+		ep.IPAddress, ep.IPPrefixLen, ep.Gateway, ep.MacAddress = "", 0, "", ""
+	}
+}
+
+// Inspect formats the docker inspect json of a container
+func (f *Engine) Inspect(ctx context.Context, containerNameOrID, format string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.container(containerNameOrID)
+	if err != nil {
+		return []string{err.Error()}, err
+	}
+	return inspect.Format(format, c)
+}
+
+// ContainerInfo returns the low-level information about a container
+func (f *Engine) ContainerInfo(ctx context.Context, containerNameOrID string) (*oci.ContainerInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.container(containerNameOrID)
+	if err != nil {
+		return nil, err
+	}
+	return oci.NewContainerInfo(c), nil
+}
+
+// ListContainers lists the containers matching the label, name and network filters
+func (f *Engine) ListContainers(ctx context.Context, filters ...string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := []string{}
+	for name, c := range f.containers {
+		networks := map[string]bool{}
+		for n := range c.NetworkSettings.Networks {
+			networks[n] = true
+		}
+		if matches(filters, name, c.Config.Labels, networks) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// matches tells if an object matches all the filters, which are in the
+// "key=value" form of "docker ps --filter"
+func matches(filters []string, name string, labels map[string]string, networks map[string]bool) bool {
+	for _, filter := range filters {
+		kv := strings.SplitN(filter, "=", 2)
+		if len(kv) != 2 {
+			return false
+		}
+		switch kv[0] {
+		case "name":
+			if !strings.Contains(name, kv[1]) {
+				return false
+			}
+		case "label":
+			lkv := strings.SplitN(kv[1], "=", 2)
+			v, ok := labels[lkv[0]]
+			if !ok || (len(lkv) == 2 && v != lkv[1]) {
+				return false
+			}
+		case "network":
+			if !networks[kv[1]] {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Status returns the state of a container
+func (f *Engine) Status(ctx context.Context, ociID string) (state.State, error) {
+	info, err := f.ContainerInfo(ctx, ociID)
+	if err != nil {
+		return state.Error, err
+	}
+	return info.MachineState(), nil
+}
+
+// SystemStatus always reports the engine running
+func (f *Engine) SystemStatus(ctx context.Context) (state.State, error) {
+	return state.Running, nil
+}
+
+// HostCapacity returns Host
+func (f *Engine) HostCapacity(ctx context.Context) (resource.Host, error) {
+	return f.Host, nil
+}
+
+// Start starts a stopped container
+func (f *Engine) Start(ctx context.Context, ociID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.container(ociID)
+	if err != nil {
+		return err
+	}
+	if c.State.Running {
+		return nil
+	}
+	return f.start(c)
+}
+
+// Stop stops a container
+func (f *Engine) Stop(ctx context.Context, ociID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.container(ociID)
+	if err != nil {
+		return err
+	}
+	if c.State.Running {
+		f.stop(c, 0)
+	}
+	return nil
+}
+
+// Restart stops and starts a container
+func (f *Engine) Restart(ctx context.Context, ociID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.container(ociID)
+	if err != nil {
+		return err
+	}
+	f.stop(c, 0)
+	return f.start(c)
+}
+
+// Pause pauses a running container
+func (f *Engine) Pause(ctx context.Context, ociID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.container(ociID)
+	if err != nil {
+		return err
+	}
+	if !c.State.Running {
+		return errors.Errorf("container %s is not running", ociID)
+	}
+	c.State.Status, c.State.Paused = "paused", true
+	return nil
+}
+
+// Unpause resumes a paused container
+func (f *Engine) Unpause(ctx context.Context, ociID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.container(ociID)
+	if err != nil {
+		return err
+	}
+	if !c.State.Paused {
+		return errors.Errorf("container %s is not paused", ociID)
+	}
+	c.State.Status, c.State.Paused = "running", false
+	return nil
+}
+
+// Remove removes a container, running or not
+func (f *Engine) Remove(ctx context.Context, ociID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.container(ociID)
+	if err != nil {
+		return err
+	}
+	delete(f.containers, strings.TrimPrefix(c.Name, "/"))
+	return nil
+}
+
+// Exec runs a command in a running container with the ExecHandler
+func (f *Engine) Exec(ctx context.Context, ociID string, opts oci.ExecOptions) (int, error) {
+	f.mu.Lock()
+	c, err := f.container(ociID)
+	if err == nil && (!c.State.Running || c.State.Paused) {
+		err = errors.Errorf("container %s is not running", ociID)
+	}
+	f.mu.Unlock()
+	if err != nil {
+		return -1, err
+	}
+	if f.ExecHandler == nil {
+		return 0, nil
+	}
+	code, err := f.ExecHandler(ctx, strings.TrimPrefix(c.Name, "/"), opts)
+	if err == nil && code != 0 {
+		err = errors.Errorf("command failed: %s: exit status %d", opts.Cmd, code)
+	}
+	return code, err
+}
+
+// Logs returns the logs set with SetLogs
+func (f *Engine) Logs(ctx context.Context, ociID string, opts oci.LogsOptions) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.container(ociID)
+	if err != nil {
+		return nil, err
+	}
+	logs := f.logs[strings.TrimPrefix(c.Name, "/")]
+	if opts.Tail > 0 {
+		lines := strings.SplitAfter(logs, "\n")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		if len(lines) > opts.Tail {
+			logs = strings.Join(lines[len(lines)-opts.Tail:], "")
+		}
+	}
+	return ioutil.NopCloser(strings.NewReader(logs)), nil
+}
+
+// Copy records the asset copied into a container, see Copied
+func (f *Engine) Copy(ctx context.Context, ociID string, asset assets.CopyAsset) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.container(ociID)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimPrefix(c.Name, "/")
+	f.copied[name] = append(f.copied[name], asset)
+	return nil
+}
+
+// Pull makes an image present
+func (f *Engine) Pull(ctx context.Context, image string, progress oci.PullProgress) error {
+	f.AddImage(image)
+	if progress != nil {
+		progress(oci.PullEvent{Status: "Downloaded newer image for " + image})
+	}
+	return nil
+}
+
+// Save writes an empty image archive
+func (f *Engine) Save(ctx context.Context, image, dest string) error {
+	f.mu.Lock()
+	_, ok := f.images[image]
+	f.mu.Unlock()
+	if !ok {
+		return errors.Errorf("No such image: %s", image)
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if err := tar.NewWriter(out).Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// ImageInspect formats the docker inspect json of an image, found by
+// reference or ID. The images are pulled from a registry, so every
+// repository of the image has a digest.
+func (f *Engine) ImageInspect(ctx context.Context, image, format string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id, ok := f.images[image]
+	if !ok {
+		for _, other := range f.images {
+			if other == image {
+				id, ok = other, true
+			}
+		}
+	}
+	if !ok {
+		err := errors.Errorf("Error: No such image: %s", image)
+		return []string{err.Error()}, err
+	}
+	j := dockerapi.ImageInspect{ID: id, RepoTags: []string{}, RepoDigests: []string{}}
+	digests := map[string]bool{}
+	for ref, other := range f.images {
+		if other != id {
+			continue
+		}
+		j.RepoTags = append(j.RepoTags, ref)
+		repo := ref
+		if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+			repo = ref[:i]
+		}
+		if d := repo + "@" + id; !digests[d] {
+			digests[d] = true
+			j.RepoDigests = append(j.RepoDigests, d)
+		}
+	}
+	sort.Strings(j.RepoTags)
+	sort.Strings(j.RepoDigests)
+	return inspect.Format(format, j)
+}
+
+// UsernsRemap returns Userns
+func (f *Engine) UsernsRemap(ctx context.Context) bool {
+	return f.Userns
+}
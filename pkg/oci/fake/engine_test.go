@@ -0,0 +1,209 @@
+package fake
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/state"
+	"github.com/medyagh/kic/pkg/config/cri"
+	"github.com/medyagh/kic/pkg/oci"
+)
+
+const testImage = "kindest/node:v1.16.3"
+
+func TestEngineLifecycle(t *testing.T) {
+	ctx := context.Background()
+	f := NewEngine()
+	ids, err := f.CreateContainer(ctx, testImage,
+		oci.WithName("kic"),
+		oci.WithLabels(map[string]string{"created_by.kic": "true"}),
+		oci.WithPortMappings([]cri.PortMapping{{ContainerPort: 6443}}))
+	if err != nil {
+		t.Fatalf("CreateContainer: %v", err)
+	}
+	if len(ids) != 1 || ids[0] == "" {
+		t.Fatalf("CreateContainer = %v, want one ID", ids)
+	}
+
+	info, err := f.ContainerInfo(ctx, "kic")
+	if err != nil {
+		t.Fatalf("ContainerInfo: %v", err)
+	}
+	if info.ID != ids[0] || info.Image != testImage || info.Labels["created_by.kic"] != "true" {
+		t.Errorf("ContainerInfo = %+v", info)
+	}
+	if len(info.Ports) != 1 || info.Ports[0].HostPort == 0 {
+		t.Errorf("ports = %+v, want 6443 published on a random host port", info.Ports)
+	}
+	if _, err := f.ContainerInfo(ctx, ids[0][:12]); err != nil {
+		t.Errorf("ContainerInfo by short ID: %v", err)
+	}
+
+	steps := []struct {
+		name string
+		do   func(context.Context, string) error
+		want state.State
+	}{
+		{"pause", f.Pause, state.Paused},
+		{"unpause", f.Unpause, state.Running},
+		{"stop", f.Stop, state.Stopped},
+		{"start", f.Start, state.Running},
+		{"restart", f.Restart, state.Running},
+	}
+	for _, s := range steps {
+		if err := s.do(ctx, "kic"); err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		if st, err := f.Status(ctx, "kic"); err != nil || st != s.want {
+			t.Errorf("status after %s = %v %v, want %v", s.name, st, err, s.want)
+		}
+	}
+	if err := f.Unpause(ctx, "kic"); err == nil {
+		t.Error("unpausing a running container succeeded")
+	}
+
+	names, err := f.ListContainers(ctx, "label=created_by.kic=true")
+	if err != nil || len(names) != 1 || names[0] != "kic" {
+		t.Errorf("ListContainers = %v %v", names, err)
+	}
+	if err := f.Remove(ctx, "kic"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, err := f.ContainerInfo(ctx, "kic"); !oci.IsNotFound(err) {
+		t.Errorf("ContainerInfo of a removed container = %v, want a *NotFoundError", err)
+	}
+}
+
+func TestEngineIPs(t *testing.T) {
+	ctx := context.Background()
+	f := NewEngine()
+	if err := f.CreateNetwork(ctx, "kic", oci.NetworkOptions{Subnet: "10.10.0.0/24"}); err != nil {
+		t.Fatalf("CreateNetwork: %v", err)
+	}
+	if err := f.CreateNetwork(ctx, "overlapping", oci.NetworkOptions{Subnet: "10.10.0.0/16"}); err == nil {
+		t.Error("creating an overlapping network succeeded")
+	}
+
+	ip := func(name string) string {
+		info, err := f.ContainerInfo(ctx, name)
+		if err != nil {
+			t.Fatalf("ContainerInfo %s: %v", name, err)
+		}
+		ipv4, _, err := info.IP("kic")
+		if err != nil {
+			t.Fatalf("IP of %s: %v", name, err)
+		}
+		return ipv4
+	}
+	create := func(name string, args ...string) error {
+		_, err := f.CreateContainer(ctx, testImage, oci.WithName(name), oci.WithRunArgs(append([]string{"--network", "kic"}, args...)...))
+		return err
+	}
+
+	if err := create("static", "--ip", "10.10.0.2"); err != nil {
+		t.Fatalf("creating with a static IP: %v", err)
+	}
+	if got := ip("static"); got != "10.10.0.2" {
+		t.Errorf("static IP = %s, want 10.10.0.2", got)
+	}
+	if err := create("dynamic"); err != nil {
+		t.Fatalf("creating with a dynamic IP: %v", err)
+	}
+	if got := ip("dynamic"); got != "10.10.0.3" {
+		t.Errorf("dynamic IP = %s, want the first free address 10.10.0.3", got)
+	}
+	if err := create("taken", "--ip", "10.10.0.3"); err == nil {
+		t.Error("creating with an address in use succeeded")
+	}
+	if err := create("outside", "--ip", "10.20.0.2"); err == nil {
+		t.Error("creating with an address outside of the subnet succeeded")
+	}
+
+	nw, err := f.NetworkInfo(ctx, "kic")
+	if err != nil {
+		t.Fatalf("NetworkInfo: %v", err)
+	}
+	if len(nw.Containers) != 2 || len(nw.Subnets) != 1 || nw.Subnets[0] != "10.10.0.0/24" || nw.Gateways[0] != "10.10.0.1" {
+		t.Errorf("NetworkInfo = %+v", nw)
+	}
+	if err := f.RemoveNetwork(ctx, "kic"); err == nil {
+		t.Error("removing a network in use succeeded")
+	}
+}
+
+func TestEngineConflicts(t *testing.T) {
+	ctx := context.Background()
+	labels := map[string]string{"created_by.kic": "true"}
+	tests := []struct {
+		name    string
+		policy  oci.ConflictPolicy
+		image   string
+		stopped bool
+		reused  bool
+		wantErr bool
+	}{
+		{name: "fail", policy: oci.ConflictFail, image: testImage, wantErr: true},
+		{name: "replace", policy: oci.ConflictReplace, image: testImage},
+		{name: "reuse running", policy: oci.ConflictReuseIfMatching, image: testImage, reused: true},
+		{name: "reuse stopped", policy: oci.ConflictReuseIfMatching, image: testImage, stopped: true, reused: true},
+		{name: "reuse other image", policy: oci.ConflictReuseIfMatching, image: "kindest/node:v1.17.0", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := NewEngine()
+			ids, err := f.CreateContainer(ctx, testImage, oci.WithName("kic"), oci.WithLabels(labels))
+			if err != nil {
+				t.Fatalf("CreateContainer: %v", err)
+			}
+			if tc.stopped {
+				if err := f.Stop(ctx, "kic"); err != nil {
+					t.Fatalf("Stop: %v", err)
+				}
+			}
+
+			again, err := f.CreateContainer(ctx, tc.image, oci.WithName("kic"), oci.WithLabels(labels), oci.WithConflictPolicy(tc.policy))
+			if tc.wantErr {
+				if !oci.IsConflict(err) || again != nil {
+					t.Fatalf("CreateContainer = %v %v, want a conflict and no IDs", again, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateContainer: %v", err)
+			}
+			if reused := again[0] == ids[0]; reused != tc.reused {
+				t.Errorf("reused = %v, want %v", reused, tc.reused)
+			}
+			if st, _ := f.Status(ctx, "kic"); st != state.Running {
+				t.Errorf("status = %v, want running", st)
+			}
+		})
+	}
+}
+
+func TestEngineImageDigests(t *testing.T) {
+	ctx := context.Background()
+	f := NewEngine()
+	f.AddImage(testImage)
+	if err := f.TagImage(testImage, "registry.local/kindest/node:latest"); err != nil {
+		t.Fatal(err)
+	}
+	id, err := oci.ImageID(ctx, f, testImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"kindest/node@" + id, "registry.local/kindest/node@" + id}
+	for _, image := range []string{testImage, id} {
+		digests, err := oci.ImageDigests(ctx, f, image)
+		if err != nil {
+			t.Fatalf("ImageDigests(%s): %v", image, err)
+		}
+		if !reflect.DeepEqual(digests, want) {
+			t.Errorf("ImageDigests(%s) = %v, want %v", image, digests, want)
+		}
+	}
+	if _, err := oci.ImageDigests(ctx, f, "kindest/node:missing"); err == nil {
+		t.Error("ImageDigests of a missing image succeeded")
+	}
+}
@@ -0,0 +1,201 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/medyagh/kic/pkg/oci"
+	"github.com/medyagh/kic/pkg/oci/dockerapi"
+	"github.com/medyagh/kic/pkg/oci/internal/inspect"
+	"github.com/pkg/errors"
+)
+
+// NetworkInspect formats the docker inspect json of networks
+func (f *Engine) NetworkInspect(ctx context.Context, networkNames []string, format string) ([]string, error) {
+	var lines []string
+	for _, name := range networkNames {
+		f.mu.Lock()
+		nw, err := f.network(name)
+		f.mu.Unlock()
+		if err != nil {
+			return []string{err.Error()}, err
+		}
+		l, err := inspect.Format(format, nw)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, l...)
+	}
+	return lines, nil
+}
+
+// NetworkInfo returns the low-level information about a network
+func (f *Engine) NetworkInfo(ctx context.Context, name string) (*oci.NetworkInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	nw, err := f.network(name)
+	if err != nil {
+		return nil, err
+	}
+	return oci.NewNetworkInfo(nw), nil
+}
+
+// network returns a copy of a network with the running containers attached to it
+func (f *Engine) network(name string) (*dockerapi.NetworkResource, error) {
+	nw, ok := f.networks[name]
+	if !ok {
+		return nil, &oci.NotFoundError{Kind: "network", Name: name}
+	}
+	result := *nw
+	result.Containers = map[string]dockerapi.EndpointResource{}
+	for cname, c := range f.containers {
+		ep := c.NetworkSettings.Networks[name]
+		if ep == nil || ep.IPAddress == "" {
+			continue
+		}
+		result.Containers[c.ID] = dockerapi.EndpointResource{
+			Name:        cname,
+			MacAddress:  ep.MacAddress,
+			IPv4Address: fmt.Sprintf("%s/%d", ep.IPAddress, ep.IPPrefixLen),
+		}
+	}
+	return &result, nil
+}
+
+// CreateNetwork creates a bridge network, picking a subnet if none is given
+func (f *Engine) CreateNetwork(ctx context.Context, name string, opts oci.NetworkOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.networks[name]; ok {
+		return errors.Errorf("network with name %s already exists", name)
+	}
+	subnet := opts.Subnet
+	if subnet == "" {
+		for i := 18; i < 32 && subnet == ""; i++ {
+			candidate := fmt.Sprintf("172.%d.0.0/16", i)
+			if !f.subnetUsed(candidate) {
+				subnet = candidate
+			}
+		}
+	}
+	ip, cidr, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return errors.Wrapf(err, "invalid subnet %s", subnet)
+	}
+	if f.subnetUsed(cidr.String()) {
+		return errors.Errorf("Pool overlaps with other one on this address space")
+	}
+	gateway := ip.Mask(cidr.Mask).To4()
+	gateway[3]++
+	nw := &dockerapi.NetworkResource{
+		Name:   name,
+		ID:     f.newID(name),
+		Driver: "bridge",
+		IPAM:   dockerapi.IPAM{Config: []dockerapi.IPAMConfig{{Subnet: cidr.String(), Gateway: gateway.String()}}},
+		Labels: map[string]string{},
+	}
+	if opts.IPv6Subnet != "" {
+		nw.EnableIPv6 = true
+		nw.IPAM.Config = append(nw.IPAM.Config, dockerapi.IPAMConfig{Subnet: opts.IPv6Subnet})
+	}
+	for k, v := range opts.Labels {
+		nw.Labels[k] = v
+	}
+	f.networks[name] = nw
+	return nil
+}
+
+// subnetUsed tells if a subnet overlaps the one of a network
+func (f *Engine) subnetUsed(subnet string) bool {
+	_, s, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return false
+	}
+	for _, nw := range f.networks {
+		for _, c := range nw.IPAM.Config {
+			if _, n, err := net.ParseCIDR(c.Subnet); err == nil && (n.Contains(s.IP) || s.Contains(n.IP)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ListNetworks lists the networks matching the name and label filters
+func (f *Engine) ListNetworks(ctx context.Context, filters ...string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := []string{}
+	for name, nw := range f.networks {
+		if matches(filters, name, nw.Labels, nil) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// RemoveNetwork removes a network no container is attached to
+func (f *Engine) RemoveNetwork(ctx context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.networks[name]; !ok {
+		return &oci.NotFoundError{Kind: "network", Name: name}
+	}
+	for cname, c := range f.containers {
+		if _, ok := c.NetworkSettings.Networks[name]; ok {
+			return errors.Errorf("error while removing network: network %s has active endpoints (%s)", name, cname)
+		}
+	}
+	delete(f.networks, name)
+	return nil
+}
+
+// CreateVolume creates a named volume, creating an existing volume is a no-op
+func (f *Engine) CreateVolume(ctx context.Context, name string, labels map[string]string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.volumes[name]; ok {
+		return nil
+	}
+	f.volumes[name] = map[string]string{}
+	for k, v := range labels {
+		f.volumes[name][k] = v
+	}
+	return nil
+}
+
+// ListVolumes lists the volumes matching the name and label filters
+func (f *Engine) ListVolumes(ctx context.Context, filters ...string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := []string{}
+	for name, labels := range f.volumes {
+		if matches(filters, name, labels, nil) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// RemoveVolume removes a named volume no container uses
+func (f *Engine) RemoveVolume(ctx context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.volumes[name]; !ok {
+		return errors.Errorf("Error: No such volume: %s", name)
+	}
+	for cname, c := range f.containers {
+		for _, bind := range c.HostConfig.Binds {
+			if strings.SplitN(bind, ":", 2)[0] == name {
+				return errors.Errorf("remove %s: volume is in use - [%s]", name, cname)
+			}
+		}
+	}
+	delete(f.volumes, name)
+	return nil
+}
@@ -0,0 +1,226 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/libmachine/state"
+	"github.com/medyagh/kic/pkg/config/cri"
+	"github.com/medyagh/kic/pkg/oci/dockerapi"
+	"github.com/pkg/errors"
+)
+
+// ContainerInfo is the low-level information about a container, as
+// returned by "docker/podman inspect"
+type ContainerInfo struct {
+	ID    string
+	Name  string
+	Image string // the image reference the container was created with
+	// ImageID is the local ID of the image the container runs, eg
+	// sha256:..., see ImageDigests for the digests of the image in registries
+	ImageID string
+	Labels  map[string]string
+	State   ContainerState
+	// Networks are the networks the container is attached to, by network name
+	Networks map[string]NetworkEndpoint
+	// Ports are the container ports published on the host
+	Ports     []cri.PortMapping
+	Mounts    []MountPoint
+	Resources Resources
+}
+
+// NetworkEndpoint is the addressing of a container on a network
+type NetworkEndpoint struct {
+	IPv4        string
+	IPv4Prefix  int
+	IPv6        string
+	Gateway     string
+	IPv6Gateway string
+	MacAddress  string
+}
+
+// MountPoint is a volume or bind mount of a container
+type MountPoint struct {
+	Type        string // bind, volume or tmpfs
+	Name        string // the volume name, for volume mounts
+	Source      string
+	Destination string
+	ReadOnly    bool
+}
+
+// Resources are the resource limits of a container, zero meaning unlimited
+type Resources struct {
+	CPUs   float64
+	Memory int64 // in bytes
+}
+
+// IP returns the addresses of the container on a network. When network is
+// empty the default network is used if the container is attached to it,
+// otherwise the first network by name.
+func (c *ContainerInfo) IP(network string) (ipv4 string, ipv6 string, err error) {
+	if network == "" {
+		network = c.defaultNetwork()
+	}
+	ep, ok := c.Networks[network]
+	if !ok {
+		return "", "", errors.Errorf("container %s is not attached to network %q", c.Name, network)
+	}
+	return ep.IPv4, ep.IPv6, nil
+}
+
+func (c *ContainerInfo) defaultNetwork() string {
+	if _, ok := c.Networks[defaultNetwork]; ok {
+		return defaultNetwork
+	}
+	names := make([]string, 0, len(c.Networks))
+	for n := range c.Networks {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return ""
+	}
+	return names[0]
+}
+
+// MachineState maps the container state to a libmachine state
+func (c *ContainerInfo) MachineState() state.State {
+	return c.State.MachineState()
+}
+
+// defaultNetwork is the network containers are attached to when none is specified
+const defaultNetwork = "bridge"
+
+// NotFoundError is returned when a container or a network does not exist
+type NotFoundError struct {
+	// Kind is what was not found, a container if empty
+	Kind string
+	Name string
+}
+
+func (e *NotFoundError) Error() string {
+	kind := e.Kind
+	if kind == "" {
+		kind = "container"
+	}
+	return fmt.Sprintf("No such %s: %s", kind, e.Name)
+}
+
+// IsNotFound returns true if err is a *NotFoundError
+func IsNotFound(err error) bool {
+	_, ok := errors.Cause(err).(*NotFoundError)
+	return ok
+}
+
+// ContainerInfo returns the low-level information about a container
+func (c *cli) ContainerInfo(ctx context.Context, containerNameOrID string) (*ContainerInfo, error) {
+	cmd := exec.CommandContext(ctx, c.bin, "inspect", "--type=container", containerNameOrID)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// docker prints "Error: No such container: name", podman "no such container name"
+		if strings.Contains(strings.ToLower(stderr.String()), "no such container") {
+			return nil, &NotFoundError{Name: containerNameOrID}
+		}
+		return nil, errors.Wrapf(err, "inspecting container %s: %s", containerNameOrID, strings.TrimSpace(stderr.String()))
+	}
+	var raw []dockerapi.ContainerJSON
+	if err := json.Unmarshal(stdout.Bytes(), &raw); err != nil {
+		return nil, errors.Wrapf(err, "decoding inspect output of container %s", containerNameOrID)
+	}
+	if len(raw) != 1 {
+		return nil, errors.Errorf("inspecting container %s should return one container, got %d", containerNameOrID, len(raw))
+	}
+	return NewContainerInfo(&raw[0]), nil
+}
+
+// ContainerInfo returns the low-level information about a container
+func (a *api) ContainerInfo(ctx context.Context, containerNameOrID string) (*ContainerInfo, error) {
+	raw, err := a.c.ContainerInspect(ctx, containerNameOrID)
+	if dockerapi.IsNotFound(err) {
+		return nil, &NotFoundError{Name: containerNameOrID}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "inspecting container %s", containerNameOrID)
+	}
+	return NewContainerInfo(raw), nil
+}
+
+// NewContainerInfo converts the inspect json of a container, as the docker
+// API returns it, to a ContainerInfo
+func NewContainerInfo(j *dockerapi.ContainerJSON) *ContainerInfo {
+	info := &ContainerInfo{
+		ID:       j.ID,
+		Name:     strings.TrimPrefix(j.Name, "/"),
+		ImageID:  j.Image,
+		Labels:   map[string]string{},
+		Networks: map[string]NetworkEndpoint{},
+	}
+	if j.Config != nil {
+		info.Image = j.Config.Image
+		for k, v := range j.Config.Labels {
+			info.Labels[k] = v
+		}
+	}
+	if j.State != nil {
+		info.State = newContainerState(j.State, j.RestartCount)
+	}
+	if j.HostConfig != nil {
+		info.Resources = Resources{
+			CPUs:   float64(j.HostConfig.NanoCPUs) / 1e9,
+			Memory: j.HostConfig.Memory,
+		}
+	}
+	if j.NetworkSettings != nil {
+		for name, ep := range j.NetworkSettings.Networks {
+			if ep == nil {
+				continue
+			}
+			info.Networks[name] = NetworkEndpoint{
+				IPv4:        ep.IPAddress,
+				IPv4Prefix:  ep.IPPrefixLen,
+				IPv6:        ep.GlobalIPv6Address,
+				Gateway:     ep.Gateway,
+				IPv6Gateway: ep.IPv6Gateway,
+				MacAddress:  ep.MacAddress,
+			}
+		}
+		for port, bindings := range j.NetworkSettings.Ports {
+			containerPort, err := strconv.Atoi(strings.Split(port, "/")[0])
+			if err != nil {
+				continue
+			}
+			for _, b := range bindings {
+				hostPort, err := strconv.Atoi(b.HostPort)
+				if err != nil {
+					continue
+				}
+				info.Ports = append(info.Ports, cri.PortMapping{
+					ContainerPort: int32(containerPort),
+					HostPort:      int32(hostPort),
+					ListenAddress: b.HostIP,
+				})
+			}
+		}
+		sort.Slice(info.Ports, func(i, k int) bool {
+			return info.Ports[i].ContainerPort < info.Ports[k].ContainerPort
+		})
+	}
+	for _, m := range j.Mounts {
+		info.Mounts = append(info.Mounts, MountPoint{
+			Type:        m.Type,
+			Name:        m.Name,
+			Source:      m.Source,
+			Destination: m.Destination,
+			ReadOnly:    !m.RW,
+		})
+	}
+	return info
+}
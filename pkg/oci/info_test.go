@@ -0,0 +1,166 @@
+package oci
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/libmachine/state"
+	"github.com/medyagh/kic/pkg/config/cri"
+)
+
+func TestIsNotFound(t *testing.T) {
+	ctx := context.Background()
+	c, _, stop := newFakePodman(t)
+	defer stop()
+	api, stopAPI := newAPIEngine(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/containers/broken/json" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"No such container: kic"}`))
+	}))
+	defer stopAPI()
+
+	for _, e := range []Engine{c, api} {
+		if _, err := e.ContainerInfo(ctx, "kic"); !IsNotFound(err) {
+			t.Errorf("%s: ContainerInfo of a missing container = %v, want a *NotFoundError", e.Name(), err)
+		}
+	}
+	if _, err := api.ContainerInfo(ctx, "broken"); err == nil || IsNotFound(err) {
+		t.Errorf("ContainerInfo failing on the daemon = %v, want an error other than not found", err)
+	}
+}
+
+// fakeDocker answers inspect of p1-control-plane with testdata/container-inspect.json,
+// recorded from docker, and the repo digests of kindest/node:v1.16.3. No
+// network exists.
+const fakeDocker = `#!/bin/sh
+case "$1 $2 $3" in
+"inspect --type=container p1-control-plane")
+	cat "$(dirname "$0")/container-inspect.json"
+	;;
+"inspect --type=container "*)
+	echo "Error: No such container: $3" >&2
+	exit 1
+	;;
+"image inspect -f")
+	if [ "$5" != "kindest/node:v1.16.3" ]; then
+		echo "Error: No such image: $5" >&2
+		exit 1
+	fi
+	echo '["kindest/node@sha256:bced4bc71380b59873ea3917afe9fb35b00e174d22f50c7cab9188eac2b0fb88"]'
+	;;
+"network inspect "*)
+	echo "Error: No such network: $3" >&2
+	exit 1
+	;;
+"network rm "*)
+	echo "Error response from daemon: network $3 not found" >&2
+	exit 1
+	;;
+*)
+	exit 1
+	;;
+esac
+`
+
+// newFakeDocker returns a cli Engine running fakeDocker, and a func removing it
+func newFakeDocker(t *testing.T) (*cli, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := ioutil.ReadFile(filepath.Join("testdata", "container-inspect.json"))
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "container-inspect.json"), payload, 0644)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "docker"), []byte(fakeDocker), 0755)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return &cli{bin: filepath.Join(dir, "docker")}, func() { os.RemoveAll(dir) }
+}
+
+func TestContainerInfoDecode(t *testing.T) {
+	ctx := context.Background()
+	c, stop := newFakeDocker(t)
+	defer stop()
+
+	info, err := c.ContainerInfo(ctx, "p1-control-plane")
+	if err != nil {
+		t.Fatalf("ContainerInfo: %v", err)
+	}
+	started, _ := time.Parse(time.RFC3339Nano, "2019-12-10T18:22:32.402773219Z")
+	want := &ContainerInfo{
+		ID:      "0c4e3d7a9b8f21e6c5d4a3b2f1e0d9c8b7a6f5e4d3c2b1a0f9e8d7c6b5a4f3e2",
+		Name:    "p1-control-plane",
+		Image:   "kindest/node:v1.16.3",
+		ImageID: "sha256:84b5c1a5e1f1c0ef4a4c9a1d8b8a2f7d6e0c5b4a39281706f5e4d3c2b1a09f8e",
+		Labels: map[string]string{
+			"io.k8s.sigs.kind.cluster": "p1",
+			"io.k8s.sigs.kind.role":    "control-plane",
+		},
+		State: ContainerState{
+			Status:    "running",
+			Running:   true,
+			StartedAt: started,
+		},
+		Networks: map[string]NetworkEndpoint{
+			"kic-p1": {
+				IPv4:        "172.18.0.2",
+				IPv4Prefix:  16,
+				IPv6:        "fc00:f853:ccd:e793::2",
+				Gateway:     "172.18.0.1",
+				IPv6Gateway: "fc00:f853:ccd:e793::1",
+				MacAddress:  "02:42:ac:12:00:02",
+			},
+		},
+		Ports: []cri.PortMapping{{ContainerPort: 6443, HostPort: 32768, ListenAddress: "127.0.0.1"}},
+		Mounts: []MountPoint{
+			{Type: "volume", Name: "p1-control-plane", Source: "/var/lib/docker/volumes/p1-control-plane/_data", Destination: "/var"},
+			{Type: "bind", Source: "/lib/modules", Destination: "/lib/modules", ReadOnly: true},
+		},
+		Resources: Resources{CPUs: 2, Memory: 2 << 30},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("ContainerInfo =\n%+v\nwant\n%+v", info, want)
+	}
+	if got := info.MachineState(); got != state.Running {
+		t.Errorf("MachineState = %s, want Running", got)
+	}
+
+	if _, err := c.ContainerInfo(ctx, "p2-control-plane"); !IsNotFound(err) {
+		t.Errorf("ContainerInfo of a missing container = %v, want a *NotFoundError", err)
+	} else if nf := err.(*NotFoundError); nf.Name != "p2-control-plane" {
+		t.Errorf("NotFoundError.Name = %q, want p2-control-plane", nf.Name)
+	}
+}
+
+func TestImageDigests(t *testing.T) {
+	ctx := context.Background()
+	c, stop := newFakeDocker(t)
+	defer stop()
+
+	digests, err := ImageDigests(ctx, c, "kindest/node:v1.16.3")
+	if err != nil {
+		t.Fatalf("ImageDigests: %v", err)
+	}
+	want := []string{"kindest/node@sha256:bced4bc71380b59873ea3917afe9fb35b00e174d22f50c7cab9188eac2b0fb88"}
+	if !reflect.DeepEqual(digests, want) {
+		t.Errorf("ImageDigests = %v, want %v", digests, want)
+	}
+	if _, err := ImageDigests(ctx, c, "kindest/node:missing"); err == nil {
+		t.Error("ImageDigests of a missing image succeeded")
+	}
+}
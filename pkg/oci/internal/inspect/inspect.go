@@ -0,0 +1,50 @@
+// Package inspect formats the inspect json of containers, networks and
+// images like "docker inspect -f" does, for the engines that get the json
+// rather than a formatted output
+package inspect
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// Format executes a "docker inspect -f" style go template against the json
+// encoding of v and returns the output lines
+func Format(format string, v interface{}) ([]string, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return FormatRaw(format, raw)
+}
+
+// FormatRaw executes a "docker inspect -f" style go template against raw json
+// and returns the output lines
+func FormatRaw(format string, raw []byte) ([]string, error) {
+	var obj interface{}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, errors.Wrap(err, "decoding inspect output")
+	}
+	t, err := template.New("format").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+		"join":  strings.Join,
+		"split": strings.Split,
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+	}).Parse(format)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing format %q", format)
+	}
+	var buff bytes.Buffer
+	if err := t.Execute(&buff, obj); err != nil {
+		return nil, errors.Wrapf(err, "executing format %q", format)
+	}
+	return strings.Split(strings.TrimSuffix(buff.String(), "\n"), "\n"), nil
+}
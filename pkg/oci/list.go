@@ -0,0 +1,43 @@
+package oci
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ListContainers lists the names of all the containers (including stopped ones)
+// matching the filters, for example "label=io.k8s.sigs.kic.cluster"
+func (c *cli) ListContainers(ctx context.Context, filters ...string) ([]string, error) {
+	args := []string{
+		"ps",
+		"-a",         // show stopped containers
+		"--no-trunc", // don't truncate
+		"--format", "{{.Names}}",
+	}
+	for _, f := range filters {
+		args = append(args, "--filter", f)
+	}
+	cmd := exec.CommandContext(ctx, c.bin, args...)
+	var buff bytes.Buffer
+	cmd.Stdout = &buff
+	cmd.Stderr = &buff
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "failed to list containers: %s", buff.String())
+	}
+
+	names := []string{}
+	scanner := bufio.NewScanner(&buff)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		names = append(names, strings.Split(line, ",")...)
+	}
+	return names, nil
+}
@@ -0,0 +1,81 @@
+package oci
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/medyagh/kic/pkg/oci/dockerapi"
+	"github.com/pkg/errors"
+)
+
+// LogsOptions are the options of Engine.Logs
+type LogsOptions struct {
+	Follow     bool      // keep streaming new output
+	Since      time.Time // zero for all the logs
+	Tail       int       // the number of lines from the end, zero for all
+	Timestamps bool      // prefix every line with its timestamp
+}
+
+// Logs returns the output of a container, stdout and stderr interleaved.
+// The caller must close it, which stops following the logs.
+func (c *cli) Logs(ctx context.Context, ociID string, opts LogsOptions) (io.ReadCloser, error) {
+	args := []string{"logs"}
+	if opts.Follow {
+		args = append(args, "--follow")
+	}
+	if !opts.Since.IsZero() {
+		args = append(args, "--since", strconv.FormatInt(opts.Since.Unix(), 10))
+	}
+	if opts.Tail > 0 {
+		args = append(args, "--tail", strconv.Itoa(opts.Tail))
+	}
+	if opts.Timestamps {
+		args = append(args, "--timestamps")
+	}
+	args = append(args, ociID)
+
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := exec.CommandContext(ctx, c.bin, args...)
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, errors.Wrapf(err, "failed to get logs of %s", ociID)
+	}
+	go func() {
+		pw.CloseWithError(cmd.Wait())
+	}()
+	return &cmdReader{PipeReader: pr, cancel: cancel}, nil
+}
+
+// Logs returns the output of a container, stdout and stderr interleaved.
+// The caller must close it, which stops following the logs.
+func (a *api) Logs(ctx context.Context, ociID string, opts LogsOptions) (io.ReadCloser, error) {
+	r, err := a.c.ContainerLogs(ctx, ociID, dockerapi.LogsConfig{
+		Follow:     opts.Follow,
+		Since:      opts.Since,
+		Tail:       opts.Tail,
+		Timestamps: opts.Timestamps,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get logs of %s", ociID)
+	}
+	return r, nil
+}
+
+// cmdReader is the output of a command, closing it kills the command
+type cmdReader struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+func (r *cmdReader) Close() error {
+	r.once.Do(r.cancel)
+	return r.PipeReader.Close()
+}
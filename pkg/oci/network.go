@@ -0,0 +1,296 @@
+package oci
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/medyagh/kic/pkg/oci/dockerapi"
+	"github.com/pkg/errors"
+)
+
+// NetworkOptions are the options of a network created with CreateNetwork
+type NetworkOptions struct {
+	// Subnet of the network in CIDR notation, eg 192.168.49.0/24
+	Subnet string
+	// IPv6Subnet is an optional IPv6 subnet, enabling IPv6 on the network
+	IPv6Subnet string
+	Labels     map[string]string
+}
+
+// NetworkInfo is the low-level information about a network
+type NetworkInfo struct {
+	ID       string
+	Name     string
+	Driver   string
+	Subnets  []string
+	Gateways []string
+	Labels   map[string]string
+	// Containers are the addresses of the containers attached to the
+	// network, by container name. Not all engines report them.
+	Containers map[string]NetworkEndpoint
+}
+
+// GetSubnets returns a slice of subnets for a specified network name
+// For example for the "bridge" network it returns 172.17.0.0/16
+func GetSubnets(ctx context.Context, e Engine, networkName string) ([]string, error) {
+	info, err := e.NetworkInfo(ctx, networkName)
+	if err != nil {
+		return nil, err
+	}
+	if len(info.Subnets) == 0 {
+		return nil, fmt.Errorf("no subnets found for network %s", networkName)
+	}
+	return info.Subnets, nil
+}
+
+// privateSubnets are the candidate subnets for new networks, in order of preference
+var privateSubnets = func() []string {
+	var subnets []string
+	for i := 49; i < 255; i += 9 {
+		subnets = append(subnets, fmt.Sprintf("192.168.%d.0/24", i))
+	}
+	for i := 18; i < 32; i++ {
+		subnets = append(subnets, fmt.Sprintf("172.%d.0.0/16", i))
+	}
+	return subnets
+}()
+
+// privateIPv6Subnets are the candidate IPv6 subnets for new networks, unique
+// local /64s starting with the one kind uses
+var privateIPv6Subnets = func() []string {
+	var subnets []string
+	for i := 0x93; i <= 0xff; i++ {
+		subnets = append(subnets, fmt.Sprintf("fc00:f853:ccd:e7%02x::/64", i))
+	}
+	return subnets
+}()
+
+// interfaceAddrs returns the addresses of the host interfaces, the subnets
+// of which are routed on the host
+var interfaceAddrs = net.InterfaceAddrs
+
+// FreeSubnet returns a private subnet that overlaps neither the subnets of
+// the existing networks of the engine, the host interfaces nor exclude,
+// for example the pod and service subnets of a cluster
+func FreeSubnet(ctx context.Context, e Engine, exclude ...string) (string, error) {
+	return freeSubnet(ctx, e, "IPv4", privateSubnets, exclude)
+}
+
+// FreeIPv6Subnet is like FreeSubnet for the IPv6 subnet of a network
+func FreeIPv6Subnet(ctx context.Context, e Engine, exclude ...string) (string, error) {
+	return freeSubnet(ctx, e, "IPv6", privateIPv6Subnets, exclude)
+}
+
+// freeSubnet returns the first of candidates, subnets of the family, that
+// overlaps neither the subnets of the existing networks, the host interfaces
+// nor exclude
+func freeSubnet(ctx context.Context, e Engine, family string, candidates, exclude []string) (string, error) {
+	var taken []*net.IPNet
+	names, err := e.ListNetworks(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range names {
+		info, err := e.NetworkInfo(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		exclude = append(exclude, info.Subnets...)
+	}
+	for _, cidr := range exclude {
+		if _, n, err := net.ParseCIDR(cidr); err == nil {
+			taken = append(taken, n)
+		}
+	}
+	if addrs, err := interfaceAddrs(); err == nil {
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok {
+				taken = append(taken, n)
+			}
+		}
+	}
+
+	for _, candidate := range candidates {
+		_, c, _ := net.ParseCIDR(candidate)
+		free := true
+		for _, t := range taken {
+			if c.Contains(t.IP) || t.Contains(c.IP) {
+				free = false
+				break
+			}
+		}
+		if free {
+			return candidate, nil
+		}
+	}
+	return "", errors.Errorf("no free private %s subnet found", family)
+}
+
+// CreateNetwork creates a bridge network
+func (c *cli) CreateNetwork(ctx context.Context, name string, opts NetworkOptions) error {
+	args := []string{"network", "create", "--driver=bridge"}
+	if opts.Subnet != "" {
+		args = append(args, "--subnet="+opts.Subnet)
+	}
+	if opts.IPv6Subnet != "" {
+		args = append(args, "--ipv6", "--subnet="+opts.IPv6Subnet)
+	}
+	keys := make([]string, 0, len(opts.Labels))
+	for k := range opts.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", k, opts.Labels[k]))
+	}
+	args = append(args, name)
+	cmd := exec.CommandContext(ctx, c.bin, args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "error creating network %s: %s", name, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// NetworkInfo returns the low-level information about a network
+func (c *cli) NetworkInfo(ctx context.Context, name string) (*NetworkInfo, error) {
+	out, err := c.networkInspect(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var raw []dockerapi.NetworkResource
+	if err := json.Unmarshal(out, &raw); err != nil || len(raw) != 1 {
+		return nil, errors.Errorf("unexpected inspect output for network %s: %v", name, err)
+	}
+	return NewNetworkInfo(&raw[0]), nil
+}
+
+// networkInspect returns the raw json output of "network inspect"
+func (c *cli) networkInspect(ctx context.Context, name string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, c.bin, "network", "inspect", name)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if noSuchNetwork(stderr.String()) {
+			return nil, &NotFoundError{Kind: "network", Name: name}
+		}
+		return nil, errors.Wrapf(err, "inspecting network %s: %s", name, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// ListNetworks lists the names of the networks matching the filters, for
+// example "label=io.k8s.sigs.kic.cluster"
+func (c *cli) ListNetworks(ctx context.Context, filters ...string) ([]string, error) {
+	args := []string{"network", "ls", "--format", "{{.Name}}"}
+	for _, f := range filters {
+		args = append(args, "--filter", f)
+	}
+	cmd := exec.CommandContext(ctx, c.bin, args...)
+	var buff bytes.Buffer
+	cmd.Stdout = &buff
+	cmd.Stderr = &buff
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "failed to list networks: %s", buff.String())
+	}
+	names := []string{}
+	scanner := bufio.NewScanner(&buff)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			names = append(names, line)
+		}
+	}
+	return names, nil
+}
+
+// RemoveNetwork removes a network
+func (c *cli) RemoveNetwork(ctx context.Context, name string) error {
+	cmd := exec.CommandContext(ctx, c.bin, "network", "rm", name)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if noSuchNetwork(string(out)) {
+			return &NotFoundError{Kind: "network", Name: name}
+		}
+		return errors.Wrapf(err, "error removing network %s: %s", name, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// noSuchNetwork tells if the output of a failed network command reports the
+// network does not exist. docker prints "Error: No such network: name" or
+// "network name not found", podman "unable to find network with name or ID
+// name: network not found".
+func noSuchNetwork(out string) bool {
+	out = strings.ToLower(out)
+	return strings.Contains(out, "no such network") || strings.Contains(out, "not found")
+}
+
+// NetworkInfo returns the low-level information about a network. podman
+// reports networks in its own format, which lacks the attached containers.
+func (p *podman) NetworkInfo(ctx context.Context, name string) (*NetworkInfo, error) {
+	out, err := p.networkInspect(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var raw []struct {
+		ID      string `json:"id"`
+		Name    string `json:"name"`
+		Driver  string `json:"driver"`
+		Subnets []struct {
+			Subnet  string `json:"subnet"`
+			Gateway string `json:"gateway"`
+		} `json:"subnets"`
+		Labels map[string]string `json:"labels"`
+	}
+	if err := json.Unmarshal(out, &raw); err != nil || len(raw) != 1 {
+		return nil, errors.Errorf("unexpected inspect output for network %s: %v", name, err)
+	}
+	info := &NetworkInfo{
+		ID:         raw[0].ID,
+		Name:       raw[0].Name,
+		Driver:     raw[0].Driver,
+		Labels:     raw[0].Labels,
+		Containers: map[string]NetworkEndpoint{},
+	}
+	for _, s := range raw[0].Subnets {
+		info.Subnets = append(info.Subnets, s.Subnet)
+		info.Gateways = append(info.Gateways, s.Gateway)
+	}
+	return info, nil
+}
+
+// NewNetworkInfo converts the inspect json of a network, as the docker API
+// returns it, to a NetworkInfo
+func NewNetworkInfo(j *dockerapi.NetworkResource) *NetworkInfo {
+	info := &NetworkInfo{
+		ID:         j.ID,
+		Name:       j.Name,
+		Driver:     j.Driver,
+		Labels:     j.Labels,
+		Containers: map[string]NetworkEndpoint{},
+	}
+	for _, c := range j.IPAM.Config {
+		if c.Subnet != "" {
+			info.Subnets = append(info.Subnets, c.Subnet)
+			info.Gateways = append(info.Gateways, c.Gateway)
+		}
+	}
+	for _, ep := range j.Containers {
+		e := NetworkEndpoint{MacAddress: ep.MacAddress}
+		if ip, n, err := net.ParseCIDR(ep.IPv4Address); err == nil {
+			e.IPv4 = ip.String()
+			e.IPv4Prefix, _ = n.Mask.Size()
+		}
+		if ip, _, err := net.ParseCIDR(ep.IPv6Address); err == nil {
+			e.IPv6 = ip.String()
+		}
+		info.Containers[ep.Name] = e
+	}
+	return info
+}
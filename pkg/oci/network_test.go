@@ -0,0 +1,137 @@
+package oci
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+)
+
+// subnetsEngine has a network per subnet
+type subnetsEngine struct {
+	Engine
+	subnets []string
+}
+
+func (s subnetsEngine) ListNetworks(ctx context.Context, filters ...string) ([]string, error) {
+	return s.subnets, nil
+}
+
+func (s subnetsEngine) NetworkInfo(ctx context.Context, name string) (*NetworkInfo, error) {
+	return &NetworkInfo{Name: name, Subnets: []string{name}}, nil
+}
+
+// stubInterfaceAddrs makes the host interfaces have addrs, returning a
+// func restoring them
+func stubInterfaceAddrs(t *testing.T, addrs ...string) func() {
+	var stub []net.Addr
+	for _, a := range addrs {
+		ip, n, err := net.ParseCIDR(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stub = append(stub, &net.IPNet{IP: ip, Mask: n.Mask})
+	}
+	orig := interfaceAddrs
+	interfaceAddrs = func() ([]net.Addr, error) { return stub, nil }
+	return func() { interfaceAddrs = orig }
+}
+
+func TestFreeSubnet(t *testing.T) {
+	tests := []struct {
+		name     string
+		ipv6     bool
+		networks []string
+		host     []string
+		exclude  []string
+		want     string // empty if no subnet is free
+	}{
+		{
+			name: "first subnet",
+			host: []string{"127.0.0.1/8", "10.0.2.15/24"},
+			want: "192.168.49.0/24",
+		},
+		{
+			name:     "skips the subnets of networks",
+			networks: []string{"172.17.0.0/16", "192.168.49.0/24", "192.168.58.0/24"},
+			want:     "192.168.67.0/24",
+		},
+		{
+			name:    "skips excluded subnets",
+			exclude: []string{"192.168.0.0/16"},
+			want:    "172.18.0.0/16",
+		},
+		{
+			name: "skips subnets overlapping host routes",
+			host: []string{"192.168.49.10/24", "192.168.56.1/21"},
+			want: "192.168.67.0/24",
+		},
+		{
+			name:    "skips subnets containing host routes",
+			host:    []string{"172.18.5.1/30"},
+			exclude: []string{"192.168.0.0/16"},
+			want:    "172.19.0.0/16",
+		},
+		{
+			name:    "exhausted",
+			host:    []string{"172.16.0.1/12"},
+			exclude: []string{"192.168.0.0/16"},
+		},
+		{
+			name: "first IPv6 subnet",
+			ipv6: true,
+			host: []string{"::1/128", "fe80::1/64", "192.168.49.1/24"},
+			want: "fc00:f853:ccd:e793::/64",
+		},
+		{
+			name:     "skips the IPv6 subnets of networks",
+			ipv6:     true,
+			networks: []string{"192.168.49.0/24", "fc00:f853:ccd:e793::/64"},
+			want:     "fc00:f853:ccd:e794::/64",
+		},
+		{
+			name: "skips IPv6 subnets overlapping host routes",
+			ipv6: true,
+			host: []string{"fc00:f853:ccd:e793::1/64", "fc00:f853:ccd:e794::/63"},
+			want: "fc00:f853:ccd:e796::/64",
+		},
+		{
+			name:    "IPv6 exhausted",
+			ipv6:    true,
+			exclude: []string{"fc00:f853:ccd:e700::/56"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			defer stubInterfaceAddrs(t, tc.host...)()
+			e := subnetsEngine{subnets: tc.networks}
+			free := FreeSubnet
+			if tc.ipv6 {
+				free = FreeIPv6Subnet
+			}
+			got, err := free(context.Background(), e, tc.exclude...)
+			if tc.want == "" {
+				if err == nil || !strings.Contains(err.Error(), "no free private") {
+					t.Errorf("got %s %v, want no free subnet", got, err)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Errorf("got %s %v, want %s", got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestMissingNetwork(t *testing.T) {
+	ctx := context.Background()
+	c, stop := newFakeDocker(t)
+	defer stop()
+
+	if _, err := c.NetworkInfo(ctx, "kic-p1"); !IsNotFound(err) || err.Error() != "No such network: kic-p1" {
+		t.Errorf("NetworkInfo of a missing network = %v, want a *NotFoundError", err)
+	}
+	if err := c.RemoveNetwork(ctx, "kic-p1"); !IsNotFound(err) {
+		t.Errorf("RemoveNetwork of a missing network = %v, want a *NotFoundError", err)
+	}
+}
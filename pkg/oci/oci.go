@@ -3,24 +3,20 @@ package oci
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"net"
 	"os/exec"
 	"strings"
-	"time"
 
-	"github.com/cenkalti/backoff"
 	"github.com/medyagh/kic/pkg/config/cri"
 	"github.com/pkg/errors"
 )
 
-// can be podman
-const DefaultOCI = "docker"
-
 // Inspect return low-level information on containers
-func Inspect(containerNameOrID, format string) ([]string, error) {
-
-	cmd := exec.Command(DefaultOCI, "inspect",
+func (c *cli) Inspect(ctx context.Context, containerNameOrID, format string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, c.bin, "inspect",
 		"-f", format,
 		containerNameOrID) // ... against the "node" container
 	var buff bytes.Buffer
@@ -36,10 +32,10 @@ func Inspect(containerNameOrID, format string) ([]string, error) {
 }
 
 // NetworkInspect displays detailed information on one or more networks
-func NetworkInspect(networkNames []string, format string) ([]string, error) {
-	cmd := exec.Command("docker", "network", "inspect",
-		"-f", format,
-		strings.Join(networkNames, " "))
+func (c *cli) NetworkInspect(ctx context.Context, networkNames []string, format string) ([]string, error) {
+	args := []string{"network", "inspect", "-f", format}
+	args = append(args, networkNames...)
+	cmd := exec.CommandContext(ctx, c.bin, args...)
 	var buff bytes.Buffer
 	cmd.Stdout = &buff
 	cmd.Stderr = &buff
@@ -52,23 +48,11 @@ func NetworkInspect(networkNames []string, format string) ([]string, error) {
 	return lines, err
 }
 
-// GetSubnets returns a slice of subnets for a specified network name
-// For example the command : docker network inspect -f '{{range (index (index . "IPAM") "Config")}}{{index . "Subnet"}} {{end}}' bridge
-// returns 172.17.0.0/16
-func GetSubnets(networkName string) ([]string, error) {
-	format := `{{range (index (index . "IPAM") "Config")}}{{index . "Subnet"}} {{end}}`
-	lines, err := NetworkInspect([]string{networkName}, format)
-	if err != nil {
-		return nil, err
-	}
-	return strings.Split(lines[0], " "), nil
-}
-
 // ImageInspect return low-level information on containers images
-func ImageInspect(containerNameOrID, format string) ([]string, error) {
-	cmd := exec.Command("docker", "image", "inspect",
+func (c *cli) ImageInspect(ctx context.Context, image, format string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, c.bin, "image", "inspect",
 		"-f", format,
-		containerNameOrID,
+		image,
 	)
 	var buff bytes.Buffer
 	cmd.Stdout = &buff
@@ -83,17 +67,32 @@ func ImageInspect(containerNameOrID, format string) ([]string, error) {
 }
 
 // ImageID return the Id of the container image
-func ImageID(containerNameOrID string) (string, error) {
-	lines, err := ImageInspect(containerNameOrID, "{{ .Id }}")
+func ImageID(ctx context.Context, e Engine, image string) (string, error) {
+	lines, err := e.ImageInspect(ctx, image, "{{ .Id }}")
 	if err != nil {
 		return "", err
 	}
 	if len(lines) != 1 {
-		return "", fmt.Errorf("docker image ID should only be one line, got %d lines", len(lines))
+		return "", fmt.Errorf("image ID should only be one line, got %d lines", len(lines))
 	}
 	return lines[0], nil
 }
 
+// ImageDigests returns the repo digests of an image, eg
+// kindest/node@sha256:..., which identify it in a registry unlike its local
+// ID. An image that was built or loaded rather than pulled has none.
+func ImageDigests(ctx context.Context, e Engine, image string) ([]string, error) {
+	lines, err := e.ImageInspect(ctx, image, "{{json .RepoDigests}}")
+	if err != nil {
+		return nil, errors.Wrapf(err, "inspecting image %s: %s", image, strings.Join(lines, "\n"))
+	}
+	var digests []string
+	if err := json.Unmarshal([]byte(strings.Join(lines, "\n")), &digests); err != nil {
+		return nil, errors.Wrapf(err, "decoding the repo digests of image %s", image)
+	}
+	return digests, nil
+}
+
 /*
 This is adapated from:
 https://github.com/kubernetes/kubernetes/blob/07a5488b2a8f67add543da72e8819407d8314204/pkg/kubelet/dockershim/helpers.go#L115-L155
@@ -140,34 +139,9 @@ func generateMountBindings(mounts ...cri.Mount) []string {
 	return result
 }
 
-// PullIfNotPresent pulls docker image if not present back off exponentially
-func PullIfNotPresent(image string, forceUpdate bool, maxWait time.Duration) error {
-	cmd := exec.Command(DefaultOCI, "inspect", "--type=image", image)
-	err := cmd.Run()
-	if err == nil && !forceUpdate {
-		return nil // if presents locally and not force
-	}
-	b := backoff.NewExponentialBackOff()
-	b.MaxElapsedTime = maxWait
-	f := func() error {
-		return pull(image)
-	}
-	return backoff.Retry(f, b)
-}
-
-// Pull pulls an image, retrying up to retries times
-func pull(image string) error {
-	cmd := exec.Command(DefaultOCI, "pull", image)
-	err := cmd.Run()
-	if err != nil {
-		return fmt.Errorf("error pull image %s : %v", image, err)
-	}
-	return err
-}
-
 // UsernsRemap checks if userns-remap is enabled in dockerd
-func UsernsRemap() bool {
-	cmd := exec.Command(DefaultOCI, "info", "--format", "'{{json .SecurityOptions}}'")
+func (c *cli) UsernsRemap(ctx context.Context) bool {
+	cmd := exec.CommandContext(ctx, c.bin, "info", "--format", "'{{json .SecurityOptions}}'")
 	var buff bytes.Buffer
 	cmd.Stdout = &buff
 	cmd.Stderr = &buff
@@ -204,8 +178,8 @@ func generatePortMappings(portMappings ...cri.PortMapping) []string {
 }
 
 // Save saves an image archive "docker/podman save"
-func Save(ociBinary string, image, dest string) error {
-	cmd := exec.Command(ociBinary, "save", "-o", dest, image)
+func (c *cli) Save(ctx context.Context, image, dest string) error {
+	cmd := exec.CommandContext(ctx, c.bin, "save", "-o", dest, image)
 	var buff bytes.Buffer
 	cmd.Stdout = &buff
 	cmd.Stderr = &buff
@@ -216,7 +190,7 @@ func Save(ociBinary string, image, dest string) error {
 		lines = append(lines, scanner.Text())
 	}
 	if err != nil {
-		return errors.Wrapf(err, "saving image to tar failed, output %s", lines[0])
+		return errors.Wrapf(err, "saving image to tar failed, output %s", strings.Join(lines, "\n"))
 	}
 	return nil
 }
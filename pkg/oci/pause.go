@@ -1,17 +1,28 @@
 package oci
 
 import (
+	"context"
 	"os/exec"
 
 	"github.com/pkg/errors"
 )
 
 // Pause pauses a container
-func Pause(ociBinary string, ociID string) error {
-	cmd := exec.Command(ociBinary, "pause", ociID)
+func (c *cli) Pause(ctx context.Context, ociID string) error {
+	cmd := exec.CommandContext(ctx, c.bin, "pause", ociID)
 	if err := cmd.Run(); err != nil {
 		return errors.Wrapf(err, "error pausing node %s", ociID)
 	}
 
 	return nil
 }
+
+// Unpause resumes all processes within a paused container
+func (c *cli) Unpause(ctx context.Context, ociID string) error {
+	cmd := exec.CommandContext(ctx, c.bin, "unpause", ociID)
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "error unpausing node %s", ociID)
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package oci
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/pkg/errors"
+)
+
+// PullEvent is a progress report of an image pull
+type PullEvent struct {
+	// Layer is the ID of the layer the event is about, empty for the image
+	Layer string
+	// Status is what is happening, eg "Downloading" or "Pull complete"
+	Status string
+	// Current and Total are the bytes done and to do of the current step,
+	// when the engine reports them. Only the docker api engine does, the
+	// command line clients print byte counts to terminals only, so they are
+	// always 0 for their events.
+	Current int64
+	Total   int64
+}
+
+// PullProgress is called for every progress event of an image pull
+type PullProgress func(PullEvent)
+
+// PullOptions are the options of PullImage
+type PullOptions struct {
+	// Force pulls the image even if it is present locally
+	Force bool
+	// MaxWait is how long to retry a failing pull, retries are backed off
+	// exponentially. 0 means DefaultPullMaxWait.
+	MaxWait time.Duration
+	// Progress, if not nil, receives the progress events of the pull
+	Progress PullProgress
+}
+
+// PullError is the error of a failed pull
+type PullError struct {
+	Image string
+	Err   error
+	// Permanent is set when retrying the pull can't succeed, for example
+	// when the image doesn't exist
+	Permanent bool
+}
+
+func (e *PullError) Error() string {
+	return "error pulling image " + e.Image + ": " + e.Err.Error()
+}
+
+// IsPermanentPullError tells if err is a pull failure that retrying won't fix
+func IsPermanentPullError(err error) bool {
+	pe, ok := errors.Cause(err).(*PullError)
+	return ok && pe.Permanent
+}
+
+// DefaultPullMaxWait is how long PullImage retries a failing pull by default
+const DefaultPullMaxWait = 3 * time.Minute
+
+// permanentPullErrors match the messages of the daemons and registries for
+// the pull failures that can't be retried
+var permanentPullErrors = []*regexp.Regexp{
+	// the tag or digest doesn't exist, eg "manifest for busybox:nope not found: manifest unknown"
+	regexp.MustCompile(`manifest unknown`),
+	regexp.MustCompile(`manifest for \S+ not found`),
+	// the repository doesn't exist or is private
+	regexp.MustCompile(`pull access denied for \S+, repository does not exist`),
+	regexp.MustCompile(`requested access to the resource is denied`),
+	regexp.MustCompile(`name unknown: repository name not known to registry`),
+	// the credentials are missing or wrong
+	regexp.MustCompile(`unauthorized: authentication required`),
+	regexp.MustCompile(`unauthorized: incorrect username or password`),
+	regexp.MustCompile(`invalid reference format`),
+}
+
+// newPullError classifies a pull failure by the output of the engine
+func newPullError(image string, err error, output string) *PullError {
+	pe := &PullError{Image: image, Err: err}
+	for _, re := range permanentPullErrors {
+		if re.MatchString(output) {
+			pe.Permanent = true
+			break
+		}
+	}
+	return pe
+}
+
+// PullImage pulls an image unless it is present locally and opts.Force is
+// not set. It retries failing pulls until opts.MaxWait has elapsed, except
+// for permanent failures, and gives up as soon as ctx is done.
+func PullImage(ctx context.Context, e Engine, image string, opts PullOptions) error {
+	_, err := e.ImageInspect(ctx, image, "{{.Id}}")
+	if err == nil && !opts.Force {
+		return nil // if presents locally and not force
+	}
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = opts.MaxWait
+	if b.MaxElapsedTime <= 0 {
+		b.MaxElapsedTime = DefaultPullMaxWait
+	}
+	f := func() error {
+		err := e.Pull(ctx, image, opts.Progress)
+		if IsPermanentPullError(err) || ctx.Err() != nil {
+			return backoff.Permanent(err)
+		}
+		return err
+	}
+	if err := backoff.Retry(f, backoff.WithContext(b, ctx)); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// PullIfNotPresent pulls docker image if not present back off exponentially,
+// it gives up when maxWait has elapsed or ctx is done
+func PullIfNotPresent(ctx context.Context, e Engine, image string, forceUpdate bool, maxWait time.Duration) error {
+	return PullImage(ctx, e, image, PullOptions{Force: forceUpdate, MaxWait: maxWait})
+}
+
+// Pull pulls an image, reporting the lines of the command output as progress.
+// The output is not a terminal, so the events have no byte counts.
+func (c *cli) Pull(ctx context.Context, image string, progress PullProgress) error {
+	cmd := exec.CommandContext(ctx, c.bin, "pull", image)
+	// docker reports progress on stdout, podman on stderr
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	if err := cmd.Start(); err != nil {
+		return &PullError{Image: image, Err: err}
+	}
+	done := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		pw.Close()
+		done <- err
+	}()
+
+	var lines []string
+	scanner := bufio.NewScanner(pr)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		lines = append(lines, line)
+		if progress != nil {
+			progress(parsePullLine(line))
+		}
+	}
+	// drain the output if the scanner stopped early so the command can exit
+	_, _ = io.Copy(ioutil.Discard, pr)
+	if err := <-done; err != nil {
+		return newPullError(image, err, strings.Join(lines, "\n"))
+	}
+	return nil
+}
+
+// parsePullLine parses a line of "docker pull" output, which is in the form
+// of "<layer>: <status>" for layers
+func parsePullLine(line string) PullEvent {
+	i := strings.Index(line, ": ")
+	if i > 0 && isLayerID(line[:i]) {
+		return PullEvent{Layer: line[:i], Status: line[i+2:]}
+	}
+	return PullEvent{Status: line}
+}
+
+// isLayerID tells if s looks like a short layer ID
+func isLayerID(s string) bool {
+	if len(s) != 12 {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
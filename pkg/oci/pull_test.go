@@ -0,0 +1,72 @@
+package oci
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestNewPullError(t *testing.T) {
+	tests := []struct {
+		output    string
+		permanent bool
+	}{
+		{"Error response from daemon: manifest for busybox:nope not found: manifest unknown: manifest unknown", true},
+		{"Error response from daemon: pull access denied for kindest/nope, repository does not exist or may require 'docker login': denied: requested access to the resource is denied", true},
+		{"Error: initializing source docker://quay.io/kic/nope:latest: reading manifest latest in quay.io/kic/nope: name unknown: repository name not known to registry", true},
+		{"Error response from daemon: Head https://registry.example.com/v2/kic/manifests/latest: unauthorized: authentication required", true},
+		{"invalid reference format: repository name must be lowercase", true},
+		{"Error response from daemon: Get https://registry-1.docker.io/v2/: net/http: TLS handshake timeout", false},
+		{"error pulling image configuration: download failed after attempts=6: blob sha256:0123 not found", false},
+		{"Error response from daemon: received unexpected HTTP status: 503 Service Unavailable", false},
+		{"Error response from daemon: Get https://registry.example.com/v2/: unauthorized", false},
+		{"toomanyrequests: You have reached your pull rate limit", false},
+	}
+	for _, tc := range tests {
+		if pe := newPullError("busybox", errors.New("exit status 1"), tc.output); pe.Permanent != tc.permanent {
+			t.Errorf("%q is permanent: %v, want %v", tc.output, pe.Permanent, tc.permanent)
+		}
+	}
+}
+
+// flakyPullEngine fails its first pulls with output, then has the image
+type flakyPullEngine struct {
+	Engine
+	failures int
+	output   string
+	pulls    int
+	pulled   bool
+}
+
+func (f *flakyPullEngine) ImageInspect(ctx context.Context, image, format string) ([]string, error) {
+	if !f.pulled {
+		return nil, errors.New("Error: No such image: " + image)
+	}
+	return []string{"sha256:0123"}, nil
+}
+
+func (f *flakyPullEngine) Pull(ctx context.Context, image string, progress PullProgress) error {
+	f.pulls++
+	if f.pulls <= f.failures {
+		return newPullError(image, errors.New("exit status 1"), f.output)
+	}
+	f.pulled = true
+	return nil
+}
+
+func TestPullImage(t *testing.T) {
+	ctx := context.Background()
+	e := &flakyPullEngine{failures: 1, output: "net/http: TLS handshake timeout"}
+	// a zero MaxWait retries too
+	if err := PullImage(ctx, e, "kindest/node:v1.16.3", PullOptions{}); err != nil || e.pulls != 2 {
+		t.Errorf("PullImage = %v after %d pulls, want the transient failure to be retried", err, e.pulls)
+	}
+	if err := PullImage(ctx, e, "kindest/node:v1.16.3", PullOptions{}); err != nil || e.pulls != 2 {
+		t.Errorf("PullImage = %v after %d pulls, want a present image not to be pulled", err, e.pulls)
+	}
+
+	e = &flakyPullEngine{failures: 5, output: "manifest for busybox:nope not found: manifest unknown"}
+	if err := PullImage(ctx, e, "busybox:nope", PullOptions{}); !IsPermanentPullError(err) || e.pulls != 1 {
+		t.Errorf("PullImage = %v after %d pulls, want a permanent failure without retries", err, e.pulls)
+	}
+}
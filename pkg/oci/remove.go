@@ -1,15 +1,16 @@
 package oci
 
 import (
+	"context"
 	"os/exec"
 
 	"github.com/pkg/errors"
 )
 
 // Remove removes a container
-func Remove(ociBinary string, ociID string) error {
+func (c *cli) Remove(ctx context.Context, ociID string) error {
 	// TODO: force remove should be an option
-	cmd := exec.Command(ociBinary, "rm", "-f", "-v", ociID)
+	cmd := exec.CommandContext(ctx, c.bin, "rm", "-f", "-v", ociID)
 	if err := cmd.Run(); err != nil {
 		return errors.Wrapf(err, "error removing node %s", ociID)
 	}
@@ -0,0 +1,28 @@
+package oci
+
+import (
+	"context"
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// Start starts a stopped container
+func (c *cli) Start(ctx context.Context, ociID string) error {
+	cmd := exec.CommandContext(ctx, c.bin, "start", ociID)
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "error starting node %s", ociID)
+	}
+
+	return nil
+}
+
+// Restart stops and starts a container
+func (c *cli) Restart(ctx context.Context, ociID string) error {
+	cmd := exec.CommandContext(ctx, c.bin, "restart", ociID)
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "error restarting node %s", ociID)
+	}
+
+	return nil
+}
@@ -1,47 +1,169 @@
 package oci
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/docker/machine/libmachine/state"
+	"github.com/medyagh/kic/pkg/config/resource"
+	"github.com/medyagh/kic/pkg/oci/dockerapi"
 	"github.com/pkg/errors"
 )
 
-// Status stops a container
-func Status(ociBinary string, ociID string) (state.State, error) {
-	cmd := exec.Command(ociBinary, "inspect", "-f", "{{.State.Status}}", ociID)
-	out, err := cmd.CombinedOutput()
-	o := strings.Trim(string(out), "\n")
-	s := state.Error
-	if o == "running" { // TODO: parse all kind of states
-		s = state.Running
-	}
-	if o == "exited" {
-		s = state.Stopped
-	}
-
-	if o == "paused" {
-		s = state.Paused
-	}
-
+// Status returns the state of a container
+func (c *cli) Status(ctx context.Context, ociID string) (state.State, error) {
+	info, err := c.ContainerInfo(ctx, ociID)
 	if err != nil {
-		return state.Error, errors.Wrapf(err, "error stop node %s", ociID)
+		return state.Error, errors.Wrapf(err, "error getting status of node %s", ociID)
 	}
-	return s, nil
+	return info.MachineState(), nil
 }
 
 // SystemStatus checks if the oci container engine is running
-func SystemStatus(ociBinary string, ociID string) (state.State, error) {
-	_, err := exec.LookPath(ociBinary)
+func (c *cli) SystemStatus(ctx context.Context) (state.State, error) {
+	_, err := exec.LookPath(c.bin)
 	if err != nil {
 		return state.Error, err
 	}
 
-	err = exec.Command("docker", "info").Run()
+	err = exec.CommandContext(ctx, c.bin, "info").Run()
 	if err != nil {
 		return state.Error, err
 	}
 
 	return state.Running, nil
 }
+
+// HostCapacity returns the CPUs and memory available to containers
+func (c *cli) HostCapacity(ctx context.Context) (resource.Host, error) {
+	var info dockerapi.Info
+	if err := c.info(ctx, &info); err != nil {
+		return resource.Host{}, err
+	}
+	return resource.Host{CPUs: info.NCPU, Memory: resource.Memory(info.MemTotal)}, nil
+}
+
+// HostCapacity returns the CPUs and memory available to containers
+func (p *podman) HostCapacity(ctx context.Context) (resource.Host, error) {
+	var info struct {
+		Host struct {
+			CPUs     int   `json:"cpus"`
+			MemTotal int64 `json:"memTotal"`
+		} `json:"host"`
+	}
+	if err := p.info(ctx, &info); err != nil {
+		return resource.Host{}, err
+	}
+	return resource.Host{CPUs: info.Host.CPUs, Memory: resource.Memory(info.Host.MemTotal)}, nil
+}
+
+// info decodes the json output of "docker/podman info" into v
+func (c *cli) info(ctx context.Context, v interface{}) error {
+	cmd := exec.CommandContext(ctx, c.bin, "info", "--format", "{{json .}}")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "%s info: %s", c.bin, strings.TrimSpace(stderr.String()))
+	}
+	if err := json.Unmarshal(stdout.Bytes(), v); err != nil {
+		return errors.Wrapf(err, "decoding %s info", c.bin)
+	}
+	return nil
+}
+
+// ContainerState is the complete state of a container
+type ContainerState struct {
+	// Status is one of created, running, paused, restarting, removing, exited or dead
+	Status     string
+	Running    bool
+	Paused     bool
+	Restarting bool
+	OOMKilled  bool
+	Dead       bool
+	// ExitCode is the exit code of the last run of the container
+	ExitCode int
+	// Error is the error the engine reported for the last run, if any
+	Error string
+	// RestartCount is how many times the engine restarted the container
+	RestartCount int
+	// Health is one of starting, healthy or unhealthy and empty if the
+	// container has no healthcheck
+	Health        string
+	FailingStreak int
+	// StartedAt and FinishedAt are zero if the container never started or finished
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// MachineState maps the container state to a libmachine state
+func (s ContainerState) MachineState() state.State {
+	switch s.Status {
+	case "running":
+		switch s.Health {
+		case "starting":
+			return state.Starting
+		case "unhealthy":
+			return state.Error
+		}
+		return state.Running
+	case "restarting":
+		return state.Starting
+	case "paused":
+		return state.Paused
+	case "removing":
+		return state.Stopping
+	case "created", "configured", "exited", "stopped":
+		// created and configured (podman) containers were never started
+		return state.Stopped
+	}
+	// dead containers could not be removed and are unusable
+	return state.Error
+}
+
+// NeverStarted returns true if the container was created but never ran
+func (s ContainerState) NeverStarted() bool {
+	return s.StartedAt.IsZero() && !s.Running
+}
+
+// CrashLooping returns true if the container keeps exiting and being
+// restarted by the engine's restart policy
+func (s ContainerState) CrashLooping() bool {
+	return s.RestartCount > 0 && (s.Restarting || (!s.Running && s.ExitCode != 0))
+}
+
+// newContainerState converts the engine's inspect json to a ContainerState
+func newContainerState(j *dockerapi.ContainerState, restartCount int) ContainerState {
+	s := ContainerState{
+		Status:       j.Status,
+		Running:      j.Running,
+		Paused:       j.Paused,
+		Restarting:   j.Restarting,
+		OOMKilled:    j.OOMKilled,
+		Dead:         j.Dead,
+		ExitCode:     j.ExitCode,
+		Error:        j.Error,
+		RestartCount: restartCount,
+		StartedAt:    parseStateTime(j.StartedAt),
+		FinishedAt:   parseStateTime(j.FinishedAt),
+	}
+	if j.Health != nil {
+		s.Health = j.Health.Status
+		s.FailingStreak = j.Health.FailingStreak
+	}
+	return s
+}
+
+// parseStateTime parses the RFC 3339 times of the engine, which uses
+// 0001-01-01T00:00:00Z for events that did not happen
+func parseStateTime(v string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil || t.Year() <= 1 {
+		return time.Time{}
+	}
+	return t
+}
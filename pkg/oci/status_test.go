@@ -0,0 +1,154 @@
+package oci
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/machine/libmachine/state"
+	"github.com/medyagh/kic/pkg/config/resource"
+	"github.com/medyagh/kic/pkg/oci/dockerapi"
+)
+
+const never = "0001-01-01T00:00:00Z"
+
+func TestContainerState(t *testing.T) {
+	tests := []struct {
+		name         string
+		state        dockerapi.ContainerState
+		restarts     int
+		want         state.State
+		neverStarted bool
+		crashLooping bool
+	}{
+		{
+			name:         "created",
+			state:        dockerapi.ContainerState{Status: "created", StartedAt: never, FinishedAt: never},
+			want:         state.Stopped,
+			neverStarted: true,
+		},
+		{
+			name:  "running",
+			state: dockerapi.ContainerState{Status: "running", Running: true, StartedAt: "2019-12-10T18:22:32.402773219Z", FinishedAt: never},
+			want:  state.Running,
+		},
+		{
+			name: "running and starting its healthcheck",
+			state: dockerapi.ContainerState{Status: "running", Running: true, StartedAt: "2019-12-10T18:22:32Z", FinishedAt: never,
+				Health: &dockerapi.Health{Status: "starting"}},
+			want: state.Starting,
+		},
+		{
+			name: "running and unhealthy",
+			state: dockerapi.ContainerState{Status: "running", Running: true, StartedAt: "2019-12-10T18:22:32Z", FinishedAt: never,
+				Health: &dockerapi.Health{Status: "unhealthy", FailingStreak: 3}},
+			want: state.Error,
+		},
+		{
+			name:  "paused",
+			state: dockerapi.ContainerState{Status: "paused", Running: true, Paused: true, StartedAt: "2019-12-10T18:22:32Z", FinishedAt: never},
+			want:  state.Paused,
+		},
+		{
+			name:  "exited cleanly",
+			state: dockerapi.ContainerState{Status: "exited", StartedAt: "2019-12-10T18:22:32Z", FinishedAt: "2019-12-10T18:30:01Z"},
+			want:  state.Stopped,
+		},
+		{
+			name:         "exited with restarts",
+			state:        dockerapi.ContainerState{Status: "exited", ExitCode: 1, StartedAt: "2019-12-10T18:22:32Z", FinishedAt: "2019-12-10T18:22:33Z"},
+			restarts:     5,
+			want:         state.Stopped,
+			crashLooping: true,
+		},
+		{
+			name:         "restarting",
+			state:        dockerapi.ContainerState{Status: "restarting", Restarting: true, ExitCode: 1, StartedAt: "2019-12-10T18:22:32Z", FinishedAt: "2019-12-10T18:22:33Z"},
+			restarts:     2,
+			want:         state.Starting,
+			crashLooping: true,
+		},
+		{
+			name: "exited with FinishedAt zero",
+			state: dockerapi.ContainerState{Status: "exited", ExitCode: 128, StartedAt: never, FinishedAt: never,
+				Error: "OCI runtime create failed: container_linux.go:346: starting container process caused \"exec: \\\"/sbin/init\\\": no such file or directory\""},
+			want:         state.Stopped,
+			neverStarted: true,
+		},
+		{
+			name:  "dead",
+			state: dockerapi.ContainerState{Status: "dead", Dead: true, StartedAt: "2019-12-10T18:22:32Z", FinishedAt: "2019-12-10T18:30:01Z"},
+			want:  state.Error,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newContainerState(&tc.state, tc.restarts)
+			if got := s.MachineState(); got != tc.want {
+				t.Errorf("MachineState = %s, want %s", got, tc.want)
+			}
+			if got := s.NeverStarted(); got != tc.neverStarted {
+				t.Errorf("NeverStarted = %t, want %t", got, tc.neverStarted)
+			}
+			if got := s.CrashLooping(); got != tc.crashLooping {
+				t.Errorf("CrashLooping = %t, want %t", got, tc.crashLooping)
+			}
+			if tc.state.FinishedAt == never && !s.FinishedAt.IsZero() {
+				t.Errorf("FinishedAt = %s, want zero", s.FinishedAt)
+			}
+		})
+	}
+}
+
+// fakeInfo prints the info recorded in info.json as "docker/podman info
+// --format {{json .}}" does
+const fakeInfo = `#!/bin/sh
+if [ "$*" != "info --format {{json .}}" ]; then
+	exit 1
+fi
+cat "$(dirname "$0")/info.json"
+`
+
+func TestHostCapacity(t *testing.T) {
+	tests := []struct {
+		engine  string
+		payload string
+		want    resource.Host
+	}{
+		{engine: "docker", payload: "docker-info.json", want: resource.Host{CPUs: 8, Memory: 16701911040}},
+		{engine: "podman", payload: "podman-info.json", want: resource.Host{CPUs: 4, Memory: 8241594368}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.engine, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", tc.engine)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			payload, err := ioutil.ReadFile(filepath.Join("testdata", tc.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, "info.json"), payload, 0644); err != nil {
+				t.Fatal(err)
+			}
+			bin := filepath.Join(dir, tc.engine)
+			if err := ioutil.WriteFile(bin, []byte(fakeInfo), 0755); err != nil {
+				t.Fatal(err)
+			}
+			var e Engine = &cli{bin: bin}
+			if tc.engine == "podman" {
+				e = &podman{cli{bin: bin}}
+			}
+			got, err := e.HostCapacity(context.Background())
+			if err != nil {
+				t.Fatalf("HostCapacity: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("HostCapacity = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
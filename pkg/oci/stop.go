@@ -1,14 +1,15 @@
 package oci
 
 import (
+	"context"
 	"os/exec"
 
 	"github.com/pkg/errors"
 )
 
 // Stop stops a container
-func Stop(ociID string) error {
-	cmd := exec.Command(DefaultOCI, "stop", ociID)
+func (c *cli) Stop(ctx context.Context, ociID string) error {
+	cmd := exec.CommandContext(ctx, c.bin, "stop", ociID)
 	err := cmd.Run()
 	if err != nil {
 		return errors.Wrapf(err, "error stop node %s", ociID)
@@ -0,0 +1,118 @@
+package oci
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CreateVolume creates a named volume, creating an existing volume is a no-op.
+// podman fails to create a volume that already exists, unlike docker, so
+// existing volumes are looked up first.
+func (c *cli) CreateVolume(ctx context.Context, name string, labels map[string]string) error {
+	exists, err := c.volumeExists(ctx, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	args := []string{"volume", "create"}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", k, labels[k]))
+	}
+	args = append(args, name)
+	cmd := exec.CommandContext(ctx, c.bin, args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		// the volume may have been created concurrently since it was looked up
+		if exists, _ := c.volumeExists(ctx, name); exists {
+			return nil
+		}
+		return errors.Wrapf(err, "error creating volume %s: %s", name, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// volumeExists checks if a volume is named name, the name filter of the
+// engines also matches names containing it
+func (c *cli) volumeExists(ctx context.Context, name string) (bool, error) {
+	names, err := c.ListVolumes(ctx, "name="+name)
+	if err != nil {
+		return false, err
+	}
+	for _, n := range names {
+		if n == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ListVolumes lists the names of the volumes matching the filters, for
+// example "label=io.k8s.sigs.kic.cluster"
+func (c *cli) ListVolumes(ctx context.Context, filters ...string) ([]string, error) {
+	args := []string{"volume", "ls", "--quiet"}
+	for _, f := range filters {
+		args = append(args, "--filter", f)
+	}
+	cmd := exec.CommandContext(ctx, c.bin, args...)
+	var buff bytes.Buffer
+	cmd.Stdout = &buff
+	cmd.Stderr = &buff
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "failed to list volumes: %s", buff.String())
+	}
+	names := []string{}
+	scanner := bufio.NewScanner(&buff)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			names = append(names, line)
+		}
+	}
+	return names, nil
+}
+
+// RemoveVolume removes a named volume, which must not be used by a container
+func (c *cli) RemoveVolume(ctx context.Context, name string) error {
+	cmd := exec.CommandContext(ctx, c.bin, "volume", "rm", name)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "error removing volume %s: %s", name, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// CreateVolume creates a named volume, creating an existing volume is a no-op
+func (a *api) CreateVolume(ctx context.Context, name string, labels map[string]string) error {
+	if err := a.c.VolumeCreate(ctx, name, labels); err != nil {
+		return errors.Wrapf(err, "error creating volume %s", name)
+	}
+	return nil
+}
+
+// ListVolumes lists the names of the volumes matching the filters
+func (a *api) ListVolumes(ctx context.Context, filters ...string) ([]string, error) {
+	names, err := a.c.VolumeList(ctx, filters...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list volumes")
+	}
+	return names, nil
+}
+
+// RemoveVolume removes a named volume, which must not be used by a container
+func (a *api) RemoveVolume(ctx context.Context, name string) error {
+	if err := a.c.VolumeRemove(ctx, name); err != nil {
+		return errors.Wrapf(err, "error removing volume %s", name)
+	}
+	return nil
+}
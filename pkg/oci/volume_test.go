@@ -0,0 +1,35 @@
+package oci
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCLICreateVolumeExisting(t *testing.T) {
+	c, dir, stop := newFakePodman(t)
+	defer stop()
+	ctx := context.Background()
+
+	for _, name := range []string{"p1-control-plane2", "p1-control-plane", "p1-control-plane"} {
+		if err := c.CreateVolume(ctx, name, map[string]string{"io.k8s.sigs.kic.cluster": "p1"}); err != nil {
+			t.Fatalf("CreateVolume(%s): %v", name, err)
+		}
+	}
+	names, err := c.ListVolumes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, " ") != "p1-control-plane p1-control-plane2" {
+		t.Errorf("volumes = %v, want p1-control-plane and p1-control-plane2", names)
+	}
+	calls, err := ioutil.ReadFile(filepath.Join(dir, "calls"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(calls), "volume create"); n != 2 {
+		t.Errorf("volume create was run %d times, want 2 as the existing volume is looked up:\n%s", n, calls)
+	}
+}
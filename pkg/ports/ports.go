@@ -0,0 +1,324 @@
+// Package ports allocates host ports to the port mappings of clusters,
+// keeping track of the reservations of every profile in a file so that
+// clusters started concurrently don't race for the same ports
+package ports
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/medyagh/kic/pkg/config/cri"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/util/homedir"
+)
+
+const (
+	// DefaultMin and DefaultMax are the default range ports are allocated in
+	DefaultMin = 32768
+	DefaultMax = 60999
+
+	// lockTimeout is how long to wait for another process to release the
+	// reservations, a lock older than that is considered stale
+	lockTimeout = 10 * time.Second
+)
+
+// DefaultPath returns the default path of the reservations file
+func DefaultPath() string {
+	return filepath.Join(homedir.HomeDir(), ".kic", "ports.json")
+}
+
+// Reservation is a host port reserved for a profile
+type Reservation struct {
+	// Name identifies the reservation in the profile, eg "apiserver"
+	Name          string `json:"name"`
+	ListenAddress string `json:"listenAddress,omitempty"`
+	HostPort      int32  `json:"hostPort"`
+}
+
+// Allocator reserves host ports in a range
+type Allocator struct {
+	path        string
+	min, max    int32
+	lockTimeout time.Duration
+}
+
+// NewAllocator returns an Allocator persisting its reservations in path and
+// allocating ports between min and max included
+func NewAllocator(path string, min, max int32) (*Allocator, error) {
+	if min <= 0 || max > 65535 || min > max {
+		return nil, fmt.Errorf("invalid port range %d-%d", min, max)
+	}
+	return &Allocator{path: path, min: min, max: max, lockTimeout: lockTimeout}, nil
+}
+
+// Reserve reserves a host port for name in a profile, free on listenAddress.
+// Reserving the same name again returns the same port.
+func (a *Allocator) Reserve(profile, name, listenAddress string) (int32, error) {
+	var port int32
+	err := a.update(func(all map[string][]Reservation) error {
+		for _, r := range all[profile] {
+			if r.Name == name {
+				port = r.HostPort
+				return nil
+			}
+		}
+		p, err := a.free(all, listenAddress)
+		if err != nil {
+			return err
+		}
+		all[profile] = append(all[profile], Reservation{Name: name, ListenAddress: listenAddress, HostPort: p})
+		port = p
+		return nil
+	})
+	return port, err
+}
+
+// ReserveMappings reserves the host ports of the port mappings of a node of
+// a profile and returns the mappings with their host ports. Mappings without
+// a host port get one allocated, the others are checked for collisions with
+// each other, with the other reservations and with ports in use on the host.
+// Reserving the mappings of the node again returns the same ports.
+func (a *Allocator) ReserveMappings(profile, node string, mappings []cri.PortMapping) ([]cri.PortMapping, error) {
+	result := make([]cri.PortMapping, len(mappings))
+	copy(result, mappings)
+	err := a.update(func(all map[string][]Reservation) error {
+		seen := map[int32]int{}
+		for i, pm := range result {
+			name := mappingName(node, i, pm)
+			if pm.HostPort == 0 {
+				if r, ok := find(all[profile], name); ok {
+					result[i].HostPort = r.HostPort
+					continue
+				}
+				p, err := a.free(all, pm.ListenAddress)
+				if err != nil {
+					return err
+				}
+				result[i].HostPort = p
+				all[profile] = append(all[profile], Reservation{Name: name, ListenAddress: pm.ListenAddress, HostPort: p})
+				continue
+			}
+			if j, ok := seen[pm.HostPort]; ok {
+				return fmt.Errorf("port mappings %d and %d both use host port %d", j, i, pm.HostPort)
+			}
+			seen[pm.HostPort] = i
+			owner, r := reservedBy(all, pm.HostPort)
+			switch {
+			case owner == profile && r.Name == name:
+				continue
+			case owner == profile:
+				return fmt.Errorf("host port %d is already reserved for %s", pm.HostPort, r.Name)
+			case owner != "":
+				return fmt.Errorf("host port %d is reserved by profile %s", pm.HostPort, owner)
+			}
+			if !available(pm.ListenAddress, pm.HostPort) {
+				return fmt.Errorf("host port %d is already in use", pm.HostPort)
+			}
+			// the mapping may have used another host port before
+			all[profile] = append(remove(all[profile], name), Reservation{Name: name, ListenAddress: pm.ListenAddress, HostPort: pm.HostPort})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// mappingName names the reservation of the i-th port mapping of a node, a
+// container port may be mapped several times
+func mappingName(node string, i int, pm cri.PortMapping) string {
+	return fmt.Sprintf("%s/%d/%d", node, i, pm.ContainerPort)
+}
+
+// Reserved returns the reservations of a profile
+func (a *Allocator) Reserved(profile string) ([]Reservation, error) {
+	all, err := a.load()
+	if err != nil {
+		return nil, err
+	}
+	return all[profile], nil
+}
+
+// Release releases all the ports reserved for a profile
+func (a *Allocator) Release(profile string) error {
+	return a.update(func(all map[string][]Reservation) error {
+		delete(all, profile)
+		return nil
+	})
+}
+
+// ReleaseNode releases the ports reserved for the port mappings of a node
+// of a profile by ReserveMappings
+func (a *Allocator) ReleaseNode(profile, node string) error {
+	return a.update(func(all map[string][]Reservation) error {
+		var kept []Reservation
+		for _, r := range all[profile] {
+			if !strings.HasPrefix(r.Name, node+"/") {
+				kept = append(kept, r)
+			}
+		}
+		if len(kept) == 0 {
+			delete(all, profile)
+		} else {
+			all[profile] = kept
+		}
+		return nil
+	})
+}
+
+// free returns a port of the range that is neither reserved nor in use
+func (a *Allocator) free(all map[string][]Reservation, listenAddress string) (int32, error) {
+	for p := a.min; p <= a.max; p++ {
+		if owner, _ := reservedBy(all, p); owner == "" && available(listenAddress, p) {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("no free port in range %d-%d", a.min, a.max)
+}
+
+func find(reservations []Reservation, name string) (Reservation, bool) {
+	for _, r := range reservations {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Reservation{}, false
+}
+
+// remove returns the reservations without the one named name
+func remove(reservations []Reservation, name string) []Reservation {
+	var kept []Reservation
+	for _, r := range reservations {
+		if r.Name != name {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// reservedBy returns the profile a port is reserved by and its reservation,
+// if any
+func reservedBy(all map[string][]Reservation, port int32) (string, Reservation) {
+	profiles := make([]string, 0, len(all))
+	for p := range all {
+		profiles = append(profiles, p)
+	}
+	sort.Strings(profiles)
+	for _, p := range profiles {
+		for _, r := range all[p] {
+			if r.HostPort == port {
+				return p, r
+			}
+		}
+	}
+	return "", Reservation{}
+}
+
+// available checks that nothing listens on a port of the host
+func available(listenAddress string, port int32) bool {
+	l, err := net.Listen("tcp", net.JoinHostPort(listenAddress, strconv.Itoa(int(port))))
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
+
+// update applies f to the reservations while holding the lock and saves
+// them if f succeeds
+func (a *Allocator) update(f func(map[string][]Reservation) error) error {
+	unlock, err := a.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	all, err := a.load()
+	if err != nil {
+		return err
+	}
+	if err := f(all); err != nil {
+		return err
+	}
+	return a.save(all)
+}
+
+func (a *Allocator) load() (map[string][]Reservation, error) {
+	all := map[string][]Reservation{}
+	data, err := ioutil.ReadFile(a.path)
+	if os.IsNotExist(err) {
+		return all, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "reading port reservations")
+	}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, errors.Wrapf(err, "decoding port reservations %s", a.path)
+	}
+	return all, nil
+}
+
+func (a *Allocator) save(all map[string][]Reservation) error {
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write then rename so readers never see a partial file
+	tmp := a.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Wrap(err, "writing port reservations")
+	}
+	return os.Rename(tmp, a.path)
+}
+
+// lock takes a lock file next to the reservations, for other processes
+func (a *Allocator) lock() (unlock func(), err error) {
+	if err := os.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+		return nil, errors.Wrap(err, "creating port reservations directory")
+	}
+	path := a.path + ".lock"
+	deadline := time.Now().Add(a.lockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, errors.Wrap(err, "locking port reservations")
+		}
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > a.lockTimeout {
+			// the process holding the lock died
+			takeOver(path, fi)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.Errorf("timed out waiting for lock %s", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// takeOver removes the stale lock file at path. Other processes may find it
+// stale at the same time and remove it then take the lock, so it is renamed
+// first, which only one of them can do. The others rename the lock taken
+// since, told apart by its modification time, and put it back.
+func takeOver(path string, stale os.FileInfo) {
+	tmp := fmt.Sprintf("%s.%d.%d", path, os.Getpid(), time.Now().UnixNano())
+	if err := os.Rename(path, tmp); err != nil {
+		// another process renamed it first
+		return
+	}
+	defer os.Remove(tmp)
+	if fi, err := os.Stat(tmp); err == nil && !fi.ModTime().Equal(stale.ModTime()) {
+		// a link fails rather than replacing a lock taken in the meantime
+		os.Link(tmp, path)
+	}
+}
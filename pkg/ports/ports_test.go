@@ -0,0 +1,323 @@
+package ports
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/medyagh/kic/pkg/config/cri"
+)
+
+const localhost = "127.0.0.1"
+
+// newTestAllocator returns an Allocator keeping its reservations in a temp
+// dir, and a func removing it
+func newTestAllocator(t *testing.T) (*Allocator, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "ports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewAllocator(filepath.Join(dir, "kic", "ports.json"), 47100, 47999)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return a, func() { os.RemoveAll(dir) }
+}
+
+func TestReserve(t *testing.T) {
+	a, cleanup := newTestAllocator(t)
+	defer cleanup()
+
+	api, err := a.Reserve("p1", "apiserver", localhost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := a.Reserve("p1", "apiserver", localhost)
+	if err != nil || again != api {
+		t.Errorf("reserving apiserver again = %d %v, want %d", again, err, api)
+	}
+	other, err := a.Reserve("p2", "apiserver", localhost)
+	if err != nil || other == api {
+		t.Errorf("reserving apiserver for p2 = %d %v, want another port than %d", other, err, api)
+	}
+	// the reservations outlive the allocator
+	b, err := NewAllocator(a.path, a.min, a.max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reserved, err := b.Reserved("p1")
+	if err != nil || len(reserved) != 1 || reserved[0].HostPort != api || reserved[0].Name != "apiserver" {
+		t.Errorf("Reserved(p1) = %+v %v, want apiserver on %d", reserved, err, api)
+	}
+}
+
+func TestReserveMappings(t *testing.T) {
+	a, cleanup := newTestAllocator(t)
+	defer cleanup()
+
+	// a container port mapped twice gets two host ports
+	mappings := []cri.PortMapping{
+		{ContainerPort: 80, ListenAddress: localhost},
+		{ContainerPort: 80, ListenAddress: localhost},
+		{ContainerPort: 443, HostPort: 47998, ListenAddress: localhost},
+	}
+	got, err := a.ReserveMappings("p1", "p1-worker", mappings)
+	if err != nil {
+		t.Fatalf("ReserveMappings: %v", err)
+	}
+	if got[0].HostPort == 0 || got[1].HostPort == 0 || got[0].HostPort == got[1].HostPort || got[2].HostPort != 47998 {
+		t.Errorf("ReserveMappings = %+v, want two allocated ports and 47998", got)
+	}
+	if mappings[0].HostPort != 0 {
+		t.Errorf("ReserveMappings changed the mappings it was given")
+	}
+	again, err := a.ReserveMappings("p1", "p1-worker", mappings)
+	if err != nil {
+		t.Fatalf("ReserveMappings again: %v", err)
+	}
+	for i := range got {
+		if again[i] != got[i] {
+			t.Errorf("reserving mapping %d again = %+v, want %+v", i, again[i], got[i])
+		}
+	}
+
+	tests := []struct {
+		name     string
+		profile  string
+		node     string
+		mappings []cri.PortMapping
+		wantErr  string
+	}{
+		{
+			name:     "port of another node",
+			profile:  "p1",
+			node:     "p1-worker2",
+			mappings: []cri.PortMapping{{ContainerPort: 8443, HostPort: 47998, ListenAddress: localhost}},
+			wantErr:  "already reserved for p1-worker/2/443",
+		},
+		{
+			name:     "port of another mapping of the node",
+			profile:  "p1",
+			node:     "p1-worker",
+			mappings: []cri.PortMapping{{ContainerPort: 443, HostPort: 47998, ListenAddress: localhost}},
+			wantErr:  "already reserved for p1-worker/2/443",
+		},
+		{
+			name:     "port of another profile",
+			profile:  "p2",
+			node:     "p2-worker",
+			mappings: []cri.PortMapping{{ContainerPort: 443, HostPort: 47998, ListenAddress: localhost}},
+			wantErr:  "reserved by profile p1",
+		},
+		{
+			name:    "port mapped twice",
+			profile: "p2",
+			node:    "p2-worker",
+			mappings: []cri.PortMapping{
+				{ContainerPort: 80, HostPort: 47990, ListenAddress: localhost},
+				{ContainerPort: 81, HostPort: 47990, ListenAddress: localhost},
+			},
+			wantErr: "both use host port 47990",
+		},
+	}
+	for _, tc := range tests {
+		_, err := a.ReserveMappings(tc.profile, tc.node, tc.mappings)
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: ReserveMappings = %v, want an error containing %q", tc.name, err, tc.wantErr)
+		}
+	}
+
+	// ports allocated to other profiles are skipped
+	p2, err := a.ReserveMappings("p2", "p2-worker", []cri.PortMapping{{ContainerPort: 80, ListenAddress: localhost}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pm := range got {
+		if p2[0].HostPort == pm.HostPort {
+			t.Errorf("p2 got host port %d of p1", pm.HostPort)
+		}
+	}
+}
+
+func TestRelease(t *testing.T) {
+	a, cleanup := newTestAllocator(t)
+	defer cleanup()
+
+	api, err := a.Reserve("p1", "apiserver", localhost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range []string{"p1-worker", "p1-worker2"} {
+		if _, err := a.ReserveMappings("p1", node, []cri.PortMapping{{ContainerPort: 80, ListenAddress: localhost}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := a.Reserve("p2", "apiserver", localhost); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.ReleaseNode("p1", "p1-worker"); err != nil {
+		t.Fatal(err)
+	}
+	reserved, err := a.Reserved("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range reserved {
+		names = append(names, r.Name)
+	}
+	if strings.Join(names, " ") != "apiserver p1-worker2/0/80" {
+		t.Errorf("reservations after releasing p1-worker = %v", names)
+	}
+
+	if err := a.Release("p1"); err != nil {
+		t.Fatal(err)
+	}
+	if reserved, _ := a.Reserved("p1"); len(reserved) != 0 {
+		t.Errorf("reservations of p1 after Release = %+v", reserved)
+	}
+	if reserved, _ := a.Reserved("p2"); len(reserved) != 1 {
+		t.Errorf("reservations of p2 after releasing p1 = %+v, want them kept", reserved)
+	}
+	// a released port is allocated again
+	if again, err := a.Reserve("p3", "apiserver", localhost); err != nil || again != api {
+		t.Errorf("Reserve after Release = %d %v, want the released port %d", again, err, api)
+	}
+}
+
+func TestStaleLock(t *testing.T) {
+	a, cleanup := newTestAllocator(t)
+	defer cleanup()
+	a.lockTimeout = 200 * time.Millisecond
+
+	lock := a.path + ".lock"
+	if err := os.MkdirAll(filepath.Dir(lock), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// a lock held by a live process is waited for until it gets stale
+	start := time.Now()
+	if _, err := a.Reserve("p1", "apiserver", localhost); err != nil {
+		t.Errorf("Reserve with the lock held: %v", err)
+	}
+	if waited := time.Since(start); waited < 150*time.Millisecond {
+		t.Errorf("Reserve with the lock held returned after %s, want it to wait for the lock", waited)
+	}
+
+	// the lock of a process that died is taken over right away
+	if err := ioutil.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatal(err)
+	}
+	start = time.Now()
+	if _, err := a.Reserve("p1", "etcd", localhost); err != nil {
+		t.Errorf("Reserve with a stale lock: %v", err)
+	}
+	if waited := time.Since(start); waited > 100*time.Millisecond {
+		t.Errorf("Reserve with a stale lock took %s", waited)
+	}
+	files, err := ioutil.ReadDir(filepath.Dir(a.path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if f.Name() != "ports.json" {
+			t.Errorf("%s was left behind", f.Name())
+		}
+	}
+}
+
+func TestTakeOverLiveLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	lock := filepath.Join(dir, "ports.json.lock")
+	if err := ioutil.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatal(err)
+	}
+	stale, err := os.Stat(lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// another process took over the stale lock, then locked again
+	if err := os.Remove(lock); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	takeOver(lock, stale)
+	if _, err := os.Stat(lock); err != nil {
+		t.Errorf("the lock taken since it was found stale was removed: %v", err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("files left = %d, want only the lock", len(files))
+	}
+}
+
+func TestConcurrentAllocators(t *testing.T) {
+	a, cleanup := newTestAllocator(t)
+	defer cleanup()
+	b, err := NewAllocator(a.path, a.min, a.max)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	ports := make([]int32, 2*n)
+	errs := make([]error, 2*n)
+	for i := 0; i < 2*n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			alloc := a
+			if i%2 == 1 {
+				alloc = b
+			}
+			ports[i], errs[i] = alloc.Reserve(fmt.Sprintf("p%d", i%3), fmt.Sprintf("port%d", i), localhost)
+		}(i)
+	}
+	wg.Wait()
+
+	owners := map[int32]int{}
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Reserve %d: %v", i, err)
+		}
+		if j, ok := owners[ports[i]]; ok {
+			t.Errorf("reservations %d and %d got the same port %d", j, i, ports[i])
+		}
+		owners[ports[i]] = i
+	}
+	total := 0
+	for p := 0; p < 3; p++ {
+		reserved, err := a.Reserved(fmt.Sprintf("p%d", p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += len(reserved)
+	}
+	if total != 2*n {
+		t.Errorf("%d reservations were saved, want %d", total, 2*n)
+	}
+}